@@ -0,0 +1,89 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/auth"
+)
+
+// runKeyring implements "apikey-gen keyring add|list|retire".
+func runKeyring(args []string) {
+	fs := flag.NewFlagSet("keyring", flag.ExitOnError)
+	keyringPath := fs.String("keyring", "", "Keyring file (or use AUTH_KEYRING_FILE env var)")
+	fs.Usage = func() {
+		fmt.Println("Usage:")
+		fmt.Println("  apikey-gen keyring add <secretID>     Add a secret and make it the primary")
+		fmt.Println("  apikey-gen keyring list               List secrets")
+		fmt.Println("  apikey-gen keyring retire <secretID>  Stop accepting keys signed with a secret")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+	command := args[0]
+	fs.Parse(args[1:])
+
+	path := *keyringPath
+	if path == "" {
+		path = os.Getenv("AUTH_KEYRING_FILE")
+	}
+	if path == "" {
+		log.Fatal("Error: Keyring file is required via -keyring flag or AUTH_KEYRING_FILE env var")
+	}
+
+	keyring, err := auth.LoadKeyring(path)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+
+	switch command {
+	case "add":
+		if fs.NArg() != 1 {
+			log.Fatal("Error: keyring add takes a secret ID, e.g. 2026-10")
+		}
+		secret, err := keyring.Add(fs.Arg(0))
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if err := keyring.Save(path); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Printf("Added secret '%s', new keys will be signed with it\n", secret.ID)
+
+	case "retire":
+		if fs.NArg() != 1 {
+			log.Fatal("Error: keyring retire takes a secret ID")
+		}
+		if err := keyring.Retire(fs.Arg(0)); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if err := keyring.Save(path); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Printf("Retired secret '%s', keys signed with it are no longer accepted (primary: %s)\n", fs.Arg(0), keyring.Primary)
+
+	case "list":
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tSTATUS\tCREATED\tRETIRED")
+		for _, s := range keyring.Secrets {
+			status, retired := "active", "-"
+			if s.Retired() {
+				status, retired = "retired", s.RetiredAt.Format(time.RFC3339)
+			} else if s.ID == keyring.Primary {
+				status = "primary"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.ID, status, s.CreatedAt.Format(time.RFC3339), retired)
+		}
+		w.Flush()
+
+	default:
+		fs.Usage()
+		os.Exit(1)
+	}
+}
@@ -5,49 +5,128 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/predatorx7/logtopus/pkg/auth"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "keyring" {
+		runKeyring(os.Args[2:])
+		return
+	}
+
 	clientID := flag.String("client", "", "Client ID to issue key for")
+	scopes := flag.String("scopes", "ingest,query", "Comma-separated scopes: ingest, query, admin")
+	ttl := flag.Duration("ttl", 0, "Key lifetime, e.g. 720h (default: never expires)")
 	verifyKey := flag.String("verify", "", "API Key to verify")
+	revokeID := flag.String("revoke", "", "Key ID to revoke")
+	reason := flag.String("reason", "", "Comment recorded with -revoke")
+	revocations := flag.String("revocations", "", "Revocation list file (or use AUTH_REVOCATION_FILE env var)")
 	secret := flag.String("secret", "", "Master secret key (or use AUTH_SECRET env var)")
+	keyringPath := flag.String("keyring", "", "Keyring file (or use AUTH_KEYRING_FILE env var); new keys are signed with its primary secret")
 	flag.Parse()
 
+	keyringFile := *keyringPath
+	if keyringFile == "" {
+		keyringFile = os.Getenv("AUTH_KEYRING_FILE")
+	}
+
+	revocationFile := *revocations
+	if revocationFile == "" {
+		revocationFile = os.Getenv("AUTH_REVOCATION_FILE")
+	}
+
+	// Revocation Mode
+	if *revokeID != "" {
+		if revocationFile == "" {
+			log.Fatal("Error: Revocation list is required via -revocations flag or AUTH_REVOCATION_FILE env var")
+		}
+		list, err := auth.NewRevocationList(revocationFile)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		if err := list.Revoke(*revokeID, *reason); err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		fmt.Printf("Revoked key %s (%s)\n", *revokeID, revocationFile)
+		return
+	}
+
 	secretKey := *secret
 	if secretKey == "" {
 		secretKey = os.Getenv("AUTH_SECRET")
 	}
-	if secretKey == "" {
-		log.Fatal("Error: Secret is required via -secret flag or AUTH_SECRET env var")
+	if secretKey == "" && keyringFile == "" {
+		log.Fatal("Error: Secret is required via -secret flag, AUTH_SECRET env var or a keyring")
 	}
 
 	// Verification Mode
 	if *verifyKey != "" {
-		valid, extractedClient, err := auth.VerifyAPIKey(*verifyKey, []byte(secretKey))
+		verifier, err := auth.NewVerifier(auth.VerifierConfig{
+			Secret:         secretKey,
+			KeyringFile:    keyringFile,
+			RevocationFile: revocationFile,
+		})
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+		identity, err := verifier.Verify(*verifyKey)
 		if err != nil {
 			fmt.Printf("Invalid Key: %v\n", err)
 			os.Exit(1)
 		}
-		if valid {
-			fmt.Printf("Valid API Key for Client ID: %s\n", extractedClient)
-			os.Exit(0)
-		} else {
-			fmt.Println("Invalid API Key (Signature mismatch)")
-			os.Exit(1)
+		fmt.Printf("Valid API Key for Client ID: %s\n", identity.ClientID)
+		fmt.Printf("  Key ID:  %s\n", identity.KeyID)
+		fmt.Printf("  Scopes:  %s\n", strings.Join(identity.Scopes, ","))
+		if identity.SecretID != "" {
+			fmt.Printf("  Secret:  %s\n", identity.SecretID)
+		}
+		if !identity.ExpiresAt.IsZero() {
+			fmt.Printf("  Expires: %s\n", identity.ExpiresAt.UTC().Format(time.RFC3339))
 		}
+		os.Exit(0)
 	}
 
 	// Generation Mode
 	if *clientID == "" {
 		fmt.Println("Usage:")
-		fmt.Println("  Generate: apikey-gen -client <clientID> [-secret <secret>]")
-		fmt.Println("  Verify:   apikey-gen -verify <apiKey> [-secret <secret>]")
+		fmt.Println("  Generate: apikey-gen -client <clientID> [-scopes ingest,query] [-ttl 720h] [-secret <secret> | -keyring <file>]")
+		fmt.Println("  Verify:   apikey-gen -verify <apiKey> [-revocations <file>] [-secret <secret>]")
+		fmt.Println("  Revoke:   apikey-gen -revoke <keyID> [-reason <text>] -revocations <file>")
+		fmt.Println("  Keyring:  apikey-gen keyring add|list|retire [-keyring <file>] [<secretID>]")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
 
-	key := auth.IssueAPIKey(*clientID, []byte(secretKey))
-	fmt.Printf("Issued API Key for '%s':\n%s\n", *clientID, key)
+	keyScopes, err := auth.ParseScopes(*scopes)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	opts := auth.KeyOptions{Scopes: keyScopes}
+	if *ttl > 0 {
+		opts.ExpiresAt = time.Now().Add(*ttl)
+	}
+
+	signingKey := []byte(secretKey)
+	if *secret == "" && keyringFile != "" {
+		// Prefer the keyring's primary secret so keys survive rotation.
+		keyring, err := auth.LoadKeyring(keyringFile)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+		primary, ok := keyring.PrimarySecret()
+		if !ok {
+			log.Fatalf("Error: keyring %s has no active primary secret, run 'apikey-gen keyring add <id>'", keyringFile)
+		}
+		signingKey, opts.SecretID = primary.Key, primary.ID
+	}
+
+	key, keyID, err := auth.IssueScopedKey(*clientID, signingKey, opts)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	fmt.Printf("Issued API Key for '%s' (key id %s, scopes %s):\n%s\n", *clientID, keyID, strings.Join(keyScopes, ","), key)
 }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/broker"
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/ratelimit"
+	"github.com/predatorx7/logtopus/pkg/retention"
+	"github.com/predatorx7/logtopus/pkg/segment"
+	"github.com/predatorx7/logtopus/pkg/subscriber/file"
+)
+
+// backpressureFromEnv reads <prefix>_BACKPRESSURE and <prefix>_BLOCK_TIMEOUT.
+// It returns nil when no mode is configured for the prefix.
+func backpressureFromEnv(prefix string) (*broker.BackpressurePolicy, error) {
+	modeStr := os.Getenv(prefix + "_BACKPRESSURE")
+	if modeStr == "" {
+		return nil, nil
+	}
+
+	mode, err := broker.ParseBackpressureMode(modeStr)
+	if err != nil {
+		return nil, fmt.Errorf("%s_BACKPRESSURE: %w", prefix, err)
+	}
+	policy := &broker.BackpressurePolicy{Mode: mode}
+
+	if timeoutStr := os.Getenv(prefix + "_BLOCK_TIMEOUT"); timeoutStr != "" {
+		timeout, err := time.ParseDuration(timeoutStr)
+		if err != nil {
+			return nil, fmt.Errorf("%s_BLOCK_TIMEOUT: %w", prefix, err)
+		}
+		policy.Timeout = timeout
+	}
+	return policy, nil
+}
+
+// rateLimitsFromEnv reads per-client overrides from RATE_LIMIT_FILE, then lets
+// RATE_LIMIT_ENTRIES_PER_SEC, RATE_LIMIT_BYTES_PER_SEC, QUOTA_DAILY_ENTRIES and
+// QUOTA_DAILY_BYTES set the defaults for every other client.
+func rateLimitsFromEnv() (ratelimit.Config, error) {
+	var cfg ratelimit.Config
+	if path := os.Getenv("RATE_LIMIT_FILE"); path != "" {
+		var err error
+		if cfg, err = ratelimit.LoadConfig(path); err != nil {
+			return cfg, err
+		}
+	}
+
+	floats := map[string]*float64{
+		"RATE_LIMIT_ENTRIES_PER_SEC": &cfg.Default.EntriesPerSec,
+		"RATE_LIMIT_BYTES_PER_SEC":   &cfg.Default.BytesPerSec,
+	}
+	for name, field := range floats {
+		if v := os.Getenv(name); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil || f < 0 {
+				return cfg, fmt.Errorf("%s: invalid rate %q", name, v)
+			}
+			*field = f
+		}
+	}
+
+	ints := map[string]*int64{
+		"QUOTA_DAILY_ENTRIES": &cfg.Default.DailyEntries,
+		"QUOTA_DAILY_BYTES":   &cfg.Default.DailyBytes,
+	}
+	for name, field := range ints {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				return cfg, fmt.Errorf("%s: invalid quota %q", name, v)
+			}
+			*field = n
+		}
+	}
+	return cfg, nil
+}
+
+// validationLimitsFromEnv starts from model.DefaultValidationLimits and applies
+// MAX_MESSAGE_KB, MAX_STACKTRACE_KB, MAX_OBJECT_KB, MAX_CLOCK_SKEW and
+// MAX_ENTRY_AGE. A value of 0 disables that check.
+func validationLimitsFromEnv() (model.ValidationLimits, error) {
+	limits := model.DefaultValidationLimits
+
+	sizes := map[string]*int{
+		"MAX_MESSAGE_KB":    &limits.MaxMessageBytes,
+		"MAX_STACKTRACE_KB": &limits.MaxStacktraceBytes,
+		"MAX_OBJECT_KB":     &limits.MaxObjectBytes,
+	}
+	for name, field := range sizes {
+		if v := os.Getenv(name); v != "" {
+			kb, err := strconv.Atoi(v)
+			if err != nil || kb < 0 {
+				return limits, fmt.Errorf("%s: invalid size %q", name, v)
+			}
+			*field = kb << 10
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"MAX_CLOCK_SKEW": &limits.MaxFutureSkew,
+		"MAX_ENTRY_AGE":  &limits.MaxAge,
+	}
+	for name, field := range durations {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return limits, fmt.Errorf("%s: invalid duration %q", name, v)
+			}
+			*field = d
+		}
+	}
+	return limits, nil
+}
+
+// retentionFromEnv reads RETENTION_MAX_AGE, RETENTION_MAX_SIZE_MB,
+// RETENTION_CLIENT_MAX_AGE, RETENTION_DRY_RUN and RETENTION_INTERVAL (default
+// 1h, how often the policy is enforced).
+func retentionFromEnv() (retention.Config, time.Duration, error) {
+	cfg := retention.Config{DryRun: os.Getenv("RETENTION_DRY_RUN") == "true"}
+	interval := time.Hour
+
+	durations := map[string]*time.Duration{
+		"RETENTION_MAX_AGE":  &cfg.MaxAge,
+		"RETENTION_INTERVAL": &interval,
+	}
+	for name, field := range durations {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return cfg, 0, fmt.Errorf("%s: invalid duration %q", name, v)
+			}
+			*field = d
+		}
+	}
+	if interval <= 0 {
+		return cfg, 0, fmt.Errorf("RETENTION_INTERVAL must be positive")
+	}
+
+	if v := os.Getenv("RETENTION_MAX_SIZE_MB"); v != "" {
+		mb, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || mb < 0 {
+			return cfg, 0, fmt.Errorf("RETENTION_MAX_SIZE_MB: invalid size %q", v)
+		}
+		cfg.MaxBytes = mb << 20
+	}
+
+	if v := os.Getenv("RETENTION_CLIENT_MAX_AGE"); v != "" {
+		clients, err := retention.ParseClientAges(v)
+		if err != nil {
+			return cfg, 0, fmt.Errorf("RETENTION_CLIENT_MAX_AGE: %w", err)
+		}
+		cfg.Clients = clients
+	}
+	return cfg, interval, nil
+}
+
+// fileRotationFromEnv reads FILE_ROTATE_SIZE_MB, FILE_ROTATE_INTERVAL and
+// FILE_COMPRESSION. Without a size or interval sessions are not rotated.
+func fileRotationFromEnv() (file.Rotation, error) {
+	var rotation file.Rotation
+	if v := os.Getenv("FILE_ROTATE_SIZE_MB"); v != "" {
+		mb, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || mb < 0 {
+			return rotation, fmt.Errorf("FILE_ROTATE_SIZE_MB: invalid size %q", v)
+		}
+		rotation.MaxBytes = mb << 20
+	}
+	if v := os.Getenv("FILE_ROTATE_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			return rotation, fmt.Errorf("FILE_ROTATE_INTERVAL: invalid duration %q", v)
+		}
+		rotation.Interval = d
+	}
+	compression, err := segment.ParseCompression(os.Getenv("FILE_COMPRESSION"))
+	if err != nil {
+		return rotation, fmt.Errorf("FILE_COMPRESSION: %w", err)
+	}
+	rotation.Compression = compression
+	return rotation, nil
+}
+
+// fileWritesFromEnv reads FILE_MAX_OPEN, FILE_BUFFER_KB, FILE_FLUSH_INTERVAL,
+// FILE_IDLE_TIMEOUT and FILE_FSYNC. Unset values keep the subscriber defaults.
+func fileWritesFromEnv() (file.WriteOptions, error) {
+	var opts file.WriteOptions
+	ints := map[string]*int{
+		"FILE_MAX_OPEN":  &opts.MaxOpenFiles,
+		"FILE_BUFFER_KB": &opts.BufferSize,
+	}
+	for name, field := range ints {
+		if v := os.Getenv(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				return opts, fmt.Errorf("%s: invalid number %q", name, v)
+			}
+			*field = n
+		}
+	}
+	opts.BufferSize <<= 10
+
+	durations := map[string]*time.Duration{
+		"FILE_FLUSH_INTERVAL": &opts.FlushInterval,
+		"FILE_IDLE_TIMEOUT":   &opts.IdleTimeout,
+	}
+	for name, field := range durations {
+		if v := os.Getenv(name); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d < 0 {
+				return opts, fmt.Errorf("%s: invalid duration %q", name, v)
+			}
+			*field = d
+		}
+	}
+
+	fsync, err := file.ParseFsyncPolicy(os.Getenv("FILE_FSYNC"))
+	if err != nil {
+		return opts, fmt.Errorf("FILE_FSYNC: %w", err)
+	}
+	opts.Fsync = fsync
+	return opts, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultMaxBodyBytes caps the decompressed size of a request body.
+const defaultMaxBodyBytes = 32 << 20
+
+var (
+	errBodyTooLarge        = errors.New("request body too large")
+	errUnsupportedEncoding = errors.New("unsupported content encoding")
+)
+
+// decodeBody returns the request body decompressed according to its
+// Content-Encoding. Reads fail with errBodyTooLarge once more than limit
+// decompressed bytes have been produced, which protects against zip bombs.
+func decodeBody(r *http.Request, limit int64) (io.ReadCloser, error) {
+	encoding := strings.ToLower(strings.TrimSpace(r.Header.Get("Content-Encoding")))
+
+	var body io.ReadCloser
+	switch encoding {
+	case "", "identity":
+		body = r.Body
+	case "gzip", "x-gzip":
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid gzip body: %w", err)
+		}
+		body = zr
+	case "zstd":
+		zr, err := zstd.NewReader(r.Body,
+			zstd.WithDecoderConcurrency(1),
+			zstd.WithDecoderMaxMemory(uint64(limit)),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zstd body: %w", err)
+		}
+		body = zr.IOReadCloser()
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedEncoding, encoding)
+	}
+
+	return &cappedReader{rc: body, remaining: limit}, nil
+}
+
+// cappedReader fails with errBodyTooLarge instead of silently truncating
+// like io.LimitReader, so callers can tell a large body from a short one.
+type cappedReader struct {
+	rc        io.ReadCloser
+	remaining int64
+}
+
+func (c *cappedReader) Read(p []byte) (int, error) {
+	if c.remaining <= 0 {
+		// Probe for one more byte to distinguish "exactly at the limit" from "over it".
+		var probe [1]byte
+		n, err := c.rc.Read(probe[:])
+		if n > 0 {
+			return 0, errBodyTooLarge
+		}
+		return 0, err
+	}
+
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.rc.Read(p)
+	c.remaining -= int64(n)
+	return n, err
+}
+
+func (c *cappedReader) Close() error {
+	return c.rc.Close()
+}
+
+// bodyErrorStatus maps an error from decodeBody, or from reading its result,
+// to a response status and message.
+func bodyErrorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, errBodyTooLarge):
+		return http.StatusRequestEntityTooLarge, "Payload Too Large"
+	case errors.Is(err, errUnsupportedEncoding):
+		return http.StatusUnsupportedMediaType, err.Error()
+	case errors.Is(err, zstd.ErrDecoderSizeExceeded), errors.Is(err, zstd.ErrWindowSizeExceeded):
+		return http.StatusRequestEntityTooLarge, "Payload Too Large"
+	default:
+		return http.StatusBadRequest, "Invalid Payload"
+	}
+}
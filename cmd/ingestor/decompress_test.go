@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+func gzipBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func zstdBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	zw, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatalf("Failed to create zstd writer: %v", err)
+	}
+	defer zw.Close()
+	return zw.EncodeAll(data, nil)
+}
+
+func TestHandler_CompressedBodies(t *testing.T) {
+	payload := []byte(`[{"message":"compressed","level":"INFO"}]`)
+
+	tests := []struct {
+		name     string
+		encoding string
+		body     []byte
+		maxBytes int64
+		want     int
+	}{
+		{"gzip", "gzip", gzipBytes(t, payload), defaultMaxBodyBytes, http.StatusAccepted},
+		{"zstd", "zstd", zstdBytes(t, payload), defaultMaxBodyBytes, http.StatusAccepted},
+		{"identity", "identity", payload, defaultMaxBodyBytes, http.StatusAccepted},
+		{"corrupt gzip", "gzip", []byte("not gzip"), defaultMaxBodyBytes, http.StatusBadRequest},
+		{"unsupported", "br", payload, defaultMaxBodyBytes, http.StatusUnsupportedMediaType},
+		{"plain over limit", "", payload, 10, http.StatusRequestEntityTooLarge},
+		{
+			// A tiny compressed body that expands far beyond the cap.
+			"gzip bomb", "gzip",
+			gzipBytes(t, []byte(`[{"message":"`+strings.Repeat("A", 1<<20)+`"}]`)),
+			64 << 10, http.StatusRequestEntityTooLarge,
+		},
+		{
+			"zstd bomb", "zstd",
+			zstdBytes(t, []byte(`[{"message":"`+strings.Repeat("A", 1<<20)+`"}]`)),
+			64 << 10, http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockBroker := &MockBroker{}
+			handler := NewHandler(mockBroker, mockVerifierValid)
+			handler.MaxBodyBytes = tt.maxBytes
+
+			req := httptest.NewRequest("POST", "/v1/logs", bytes.NewReader(tt.body))
+			req.Header.Set("X-API-Key", "valid-key")
+			req.Header.Set("Content-Encoding", tt.encoding)
+			w := httptest.NewRecorder()
+			handler.HandleLogs(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("Expected %d, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if tt.want == http.StatusAccepted && (len(mockBroker.PublishedLogs) != 1 || mockBroker.PublishedLogs[0].Message != "compressed") {
+				t.Errorf("Unexpected published logs: %+v", mockBroker.PublishedLogs)
+			}
+		})
+	}
+}
+
+func TestHandler_CompressedNDJSON(t *testing.T) {
+	mockBroker := &MockBroker{}
+	handler := NewHandler(mockBroker, mockVerifierValid)
+
+	body := gzipBytes(t, []byte("{\"message\":\"a\"}\n{\"message\":\"b\"}\n"))
+	req := httptest.NewRequest("POST", "/v1/logs/ndjson", bytes.NewReader(body))
+	req.Header.Set("X-API-Key", "valid-key")
+	req.Header.Set("Content-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	handler.HandleNDJSON(w, req)
+
+	if w.Code != http.StatusAccepted || len(mockBroker.PublishedLogs) != 2 {
+		t.Errorf("Expected 2 logs accepted, got %d with %d logs", w.Code, len(mockBroker.PublishedLogs))
+	}
+
+	// Over the cap mid-stream
+	handler.MaxBodyBytes = 20
+	req = httptest.NewRequest("POST", "/v1/logs/ndjson", bytes.NewReader(body))
+	req.Header.Set("X-API-Key", "valid-key")
+	req.Header.Set("Content-Encoding", "gzip")
+	w = httptest.NewRecorder()
+	handler.HandleNDJSON(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413, got %d", w.Code)
+	}
+}
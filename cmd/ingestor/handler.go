@@ -1,57 +1,200 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/predatorx7/logtopus/pkg/auth"
 	"github.com/predatorx7/logtopus/pkg/broker"
 	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/ratelimit"
 )
 
 type Handler struct {
 	Broker   broker.Broker
-	Verifier func(string) (bool, string, error)
+	Verifier func(string) (auth.Identity, error)
+	// MaxBodyBytes caps the decompressed size of a request body.
+	MaxBodyBytes int64
+	// Limiter applies per-client rate limits and quotas. Optional.
+	Limiter *ratelimit.Limiter
+	// Validation bounds individual entries on the JSON and NDJSON endpoints.
+	Validation model.ValidationLimits
 }
 
-func NewHandler(b broker.Broker, verifier func(string) (bool, string, error)) *Handler {
+// EntryError describes an entry rejected from a JSON batch.
+type EntryError struct {
+	Index  int                `json:"index"`
+	Errors []model.FieldError `json:"errors"`
+}
+
+// BatchResponse is returned by the JSON batch endpoint.
+type BatchResponse struct {
+	Status   string       `json:"status"`
+	Accepted int          `json:"accepted"`
+	Rejected []EntryError `json:"rejected,omitempty"`
+}
+
+func NewHandler(b broker.Broker, verifier func(string) (auth.Identity, error)) *Handler {
 	return &Handler{
-		Broker:   b,
-		Verifier: verifier,
+		Broker:       b,
+		Verifier:     verifier,
+		MaxBodyBytes: defaultMaxBodyBytes,
+		Validation:   model.DefaultValidationLimits,
 	}
 }
 
 func (h *Handler) HandleLogs(w http.ResponseWriter, r *http.Request) {
-	// Authentication Placeholder
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == ndjsonContentType {
+		h.HandleNDJSON(w, r)
+		return
+	}
+
 	// Authentication
-	apiKey := r.Header.Get("X-API-Key")
-	if apiKey == "" {
-		http.Error(w, "Missing API Key", http.StatusUnauthorized)
+	identity, ok := h.authenticate(w, r)
+	if !ok {
 		return
 	}
 
-	valid, _, err := h.Verifier(apiKey)
-	if !valid || err != nil {
-		http.Error(w, "Invalid API Key", http.StatusUnauthorized)
+	body, err := decodeBody(r, h.MaxBodyBytes)
+	if err != nil {
+		status, msg := bodyErrorStatus(err)
+		http.Error(w, msg, status)
 		return
 	}
+	defer body.Close()
 
-	// Decode Batch
-	var logs []model.LogEntry
-	if err := json.NewDecoder(r.Body).Decode(&logs); err != nil {
-		http.Error(w, "Invalid Payload", http.StatusBadRequest)
+	// Decode Batch. Elements are decoded one by one so a bad entry only
+	// rejects itself.
+	counted := &countingReader{r: body}
+	var raw []json.RawMessage
+	if err := json.NewDecoder(counted).Decode(&raw); err != nil {
+		status, msg := bodyErrorStatus(err)
+		http.Error(w, msg, status)
 		return
 	}
 
-	// Enrichment
-	clientIP := r.RemoteAddr
-	// If behind proxy, RealIP middleware handles it, but here we take what's available
-	// or trust the middleware to have set it in RemoteAddr or standard headers if we used a helper.
+	resp := BatchResponse{Status: "accepted"}
+	logs := make([]model.LogEntry, 0, len(raw))
+	for i, data := range raw {
+		entry, errs := h.decodeEntry(data)
+		if errs != nil {
+			resp.Rejected = append(resp.Rejected, EntryError{Index: i, Errors: errs})
+			continue
+		}
+		logs = append(logs, entry)
+	}
+	if len(logs) == 0 && len(resp.Rejected) > 0 {
+		resp.Status = "rejected"
+		writeJSON(w, http.StatusBadRequest, resp)
+		return
+	}
+
+	h.enrich(r, identity, logs)
+
+	// Publish to Broker
+	if err := h.publish(r.Context(), identity, logs, counted.n); err != nil {
+		status, msg := publishErrorStatus(w, err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	resp.Accepted = len(logs)
+	writeJSON(w, http.StatusAccepted, resp)
+}
+
+// decodeEntry unmarshals, normalises the level of and validates a single
+// entry, returning why it was rejected if it was.
+func (h *Handler) decodeEntry(data []byte) (model.LogEntry, model.ValidationErrors) {
+	var entry model.LogEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		field := "entry"
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			field = typeErr.Field
+		}
+		return entry, model.ValidationErrors{{Field: field, Error: err.Error()}}
+	}
+
+	if level, ok := model.ParseLevel(string(entry.Level)); ok {
+		entry.Level = level
+	}
+
+	var errs model.ValidationErrors
+	if err := entry.Validate(h.Validation, time.Now()); errors.As(err, &errs) {
+		return entry, errs
+	}
+	return entry, nil
+}
+
+// authenticate verifies the X-API-Key header, writing a 401 when it is
+// missing, invalid, expired or revoked, and a 403 when the key may not ingest.
+// It returns the identity the key was issued for.
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (auth.Identity, bool) {
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" {
+		http.Error(w, "Missing API Key", http.StatusUnauthorized)
+		return auth.Identity{}, false
+	}
+
+	identity, err := h.Verifier(apiKey)
+	if err != nil {
+		http.Error(w, authErrorMessage(err), http.StatusUnauthorized)
+		return auth.Identity{}, false
+	}
+	if !identity.HasScope(auth.ScopeIngest) {
+		http.Error(w, "API Key lacks the ingest scope", http.StatusForbidden)
+		return auth.Identity{}, false
+	}
+	return identity, true
+}
+
+// authErrorMessage tells clients why their key was refused without echoing
+// anything about the key itself.
+func authErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrExpiredKey):
+		return "API Key expired"
+	case errors.Is(err, auth.ErrRevokedKey):
+		return "API Key revoked"
+	default:
+		return "Invalid API Key"
+	}
+}
+
+// enrich fills in request-derived fields and defaults. ClientID always comes
+// from the verified key, so a caller cannot write entries for another client;
+// a differing claimed value is kept in Extra for auditing. Entries without a
+// trace ID inherit the request's traceparent header.
+func (h *Handler) enrich(r *http.Request, identity auth.Identity, logs []model.LogEntry) {
 	// Since we used middleware.RealIP, r.RemoteAddr is updated.
+	clientIP := r.RemoteAddr
+	traceID, spanID, traceFlags, hasTrace := model.ParseTraceparent(r.Header.Get("traceparent"))
 
 	for i := range logs {
 		logs[i].ClientIP = clientIP
 
+		if logs[i].TraceID == "" && hasTrace {
+			logs[i].TraceID, logs[i].SpanID, logs[i].TraceFlags = traceID, spanID, traceFlags
+		}
+		logs[i].TraceID = strings.ToLower(logs[i].TraceID)
+		logs[i].SpanID = strings.ToLower(logs[i].SpanID)
+
+		if logs[i].Extra == nil {
+			logs[i].Extra = make(map[string]interface{})
+		}
+		if claimed := logs[i].ClientID; claimed != "" && claimed != identity.ClientID {
+			logs[i].Extra["claimed_client_id"] = claimed
+		}
+		logs[i].ClientID = identity.ClientID
+		logs[i].Extra["api_key_id"] = identity.KeyID
+
 		// Default Level
 		if logs[i].Level == "" {
 			logs[i].Level = model.LogLevelInfo
@@ -62,13 +205,64 @@ func (h *Handler) HandleLogs(w http.ResponseWriter, r *http.Request) {
 			logs[i].Time = time.Now()
 		}
 	}
+}
 
-	// Publish to Broker
-	if err := h.Broker.Publish(r.Context(), logs); err != nil {
-		http.Error(w, "Failed to ingest logs", http.StatusInternalServerError)
-		return
+// publish applies the client's rate limits and quotas to a batch of size
+// bytes, then hands it to the broker.
+func (h *Handler) publish(ctx context.Context, identity auth.Identity, logs []model.LogEntry, size int64) error {
+	return publishLimited(ctx, h.Broker, h.Limiter, identity.ClientID, logs, size)
+}
+
+// publishLimited charges a batch of size bytes to clientID on limiter, which
+// may be nil, and publishes it. A batch the broker refuses is refunded.
+func publishLimited(ctx context.Context, b broker.Broker, limiter *ratelimit.Limiter, clientID string, logs []model.LogEntry, size int64) error {
+	if limiter != nil {
+		if err := limiter.Allow(clientID, len(logs), size); err != nil {
+			return err
+		}
+	}
+	if err := b.Publish(ctx, logs); err != nil {
+		if limiter != nil {
+			limiter.Refund(clientID, len(logs), size)
+		}
+		return err
+	}
+	return nil
+}
+
+// publishErrorStatus maps a publish error to a response status and message,
+// setting Retry-After when the client should back off.
+func publishErrorStatus(w http.ResponseWriter, err error) (int, string) {
+	var limitErr *ratelimit.LimitError
+	if errors.As(err, &limitErr) {
+		w.Header().Set("Retry-After", retryAfterSeconds(limitErr.RetryAfter))
+		return http.StatusTooManyRequests, "Client exceeded " + limitErr.Reason + " limit"
+	}
+	var bpErr *broker.BackpressureError
+	if errors.As(err, &bpErr) {
+		w.Header().Set("Retry-After", retryAfterSeconds(bpErr.RetryAfter))
+		return http.StatusServiceUnavailable, "Ingestion queue is full, retry later"
+	}
+	return http.StatusInternalServerError, "Failed to ingest logs"
+}
+
+// retryAfterSeconds formats d for the Retry-After header, rounding up to at least one second.
+func retryAfterSeconds(d time.Duration) string {
+	secs := int((d + time.Second - 1) / time.Second)
+	if secs < 1 {
+		secs = 1
 	}
+	return strconv.Itoa(secs)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
 
-	w.WriteHeader(http.StatusAccepted)
-	w.Write([]byte(`{"status":"accepted"}`))
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
 }
@@ -5,17 +5,23 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/predatorx7/logtopus/pkg/auth"
 	"github.com/predatorx7/logtopus/pkg/broker"
 	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/ratelimit"
 )
 
 // MockBroker for testing Handler
 type MockBroker struct {
 	PublishedLogs []model.LogEntry
+	PublishCalls  int
 	PublishErr    error
 }
 
@@ -23,11 +29,12 @@ func (m *MockBroker) Publish(ctx context.Context, logs []model.LogEntry) error {
 	if m.PublishErr != nil {
 		return m.PublishErr
 	}
+	m.PublishCalls++
 	m.PublishedLogs = append(m.PublishedLogs, logs...)
 	return nil
 }
 
-func (m *MockBroker) Subscribe(ctx context.Context) (<-chan []model.LogEntry, error) {
+func (m *MockBroker) Subscribe(ctx context.Context, opts ...broker.SubscribeOption) (<-chan []model.LogEntry, error) {
 	return nil, nil
 }
 
@@ -35,17 +42,29 @@ func (m *MockBroker) Stats() (uint64, uint64) {
 	return uint64(len(m.PublishedLogs)), 0
 }
 
+func (m *MockBroker) SubscriberStats() []broker.SubscriberStats {
+	return nil
+}
+
+func (m *MockBroker) Close() error {
+	return nil
+}
+
 // MockVerifier
-func mockVerifierValid(key string) (bool, string, error) {
-	return true, "test-client", nil
+func mockVerifierValid(key string) (auth.Identity, error) {
+	return auth.Identity{ClientID: "test-client", KeyID: "test-key", Scopes: []string{auth.ScopeIngest}}, nil
+}
+
+func mockVerifierInvalid(key string) (auth.Identity, error) {
+	return auth.Identity{}, auth.ErrInvalidKey
 }
 
-func mockVerifierInvalid(key string) (bool, string, error) {
-	return false, "", nil
+func mockVerifierRevoked(key string) (auth.Identity, error) {
+	return auth.Identity{}, auth.ErrRevokedKey
 }
 
-func mockVerifierError(key string) (bool, string, error) {
-	return false, "", errors.New("verify error")
+func mockVerifierQueryOnly(key string) (auth.Identity, error) {
+	return auth.Identity{ClientID: "test-client", KeyID: "test-key", Scopes: []string{auth.ScopeQuery}}, nil
 }
 
 func TestHandler_HandleLogs(t *testing.T) {
@@ -70,8 +89,25 @@ func TestHandler_HandleLogs(t *testing.T) {
 	if len(mockBroker.PublishedLogs) != 1 {
 		t.Errorf("Expected 1 log published, got %d", len(mockBroker.PublishedLogs))
 	}
-	if mockBroker.PublishedLogs[0].ClientID != "" {
-		// Verify enrichment if any (we don't strictly set ClientID in handler yet, only remove APIKey)
+	if got := mockBroker.PublishedLogs[0].ClientID; got != "test-client" {
+		t.Errorf("Expected ClientID from the verified key, got %q", got)
+	}
+	if got := mockBroker.PublishedLogs[0].Extra["api_key_id"]; got != "test-key" {
+		t.Errorf("Expected api_key_id test-key, got %v", got)
+	}
+
+	// Case 1b: Spoofed ClientID is overwritten
+	spoofed, _ := json.Marshal([]model.LogEntry{{Message: "msg2", ClientID: "someone-else"}})
+	req = httptest.NewRequest("POST", "/v1/logs", bytes.NewReader(spoofed))
+	req.Header.Set("X-API-Key", "valid-key")
+	w = httptest.NewRecorder()
+	handler.HandleLogs(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Errorf("Expected 202, got %d", w.Code)
+	}
+	last := mockBroker.PublishedLogs[len(mockBroker.PublishedLogs)-1]
+	if last.ClientID != "test-client" || last.Extra["claimed_client_id"] != "someone-else" {
+		t.Errorf("Expected spoofed ClientID to be replaced, got %q (extra %v)", last.ClientID, last.Extra)
 	}
 
 	// Case 2: Missing API Key
@@ -92,6 +128,24 @@ func TestHandler_HandleLogs(t *testing.T) {
 		t.Errorf("Expected 401 on invalid key, got %d", w.Code)
 	}
 
+	// Case 3b: Revoked API Key
+	req = httptest.NewRequest("POST", "/v1/logs", bytes.NewReader(body))
+	req.Header.Set("X-API-Key", "revoked-key")
+	w = httptest.NewRecorder()
+	NewHandler(mockBroker, mockVerifierRevoked).HandleLogs(w, req)
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "revoked") {
+		t.Errorf("Expected 401 revoked, got %d %q", w.Code, w.Body.String())
+	}
+
+	// Case 3c: Key without the ingest scope
+	req = httptest.NewRequest("POST", "/v1/logs", bytes.NewReader(body))
+	req.Header.Set("X-API-Key", "query-key")
+	w = httptest.NewRecorder()
+	NewHandler(mockBroker, mockVerifierQueryOnly).HandleLogs(w, req)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for query-only key, got %d", w.Code)
+	}
+
 	// Case 4: Invalid JSON
 	req = httptest.NewRequest("POST", "/v1/logs", bytes.NewReader([]byte("{bad json")))
 	req.Header.Set("X-API-Key", "valid-key")
@@ -110,7 +164,247 @@ func TestHandler_HandleLogs(t *testing.T) {
 	if w.Code != http.StatusInternalServerError {
 		t.Errorf("Expected 500 on broker error, got %d", w.Code)
 	}
+
+	// Case 6: Broker Backpressure
+	mockBroker.PublishErr = &broker.BackpressureError{Subscriber: "file", RetryAfter: 1500 * time.Millisecond}
+	req = httptest.NewRequest("POST", "/v1/logs", bytes.NewReader(body))
+	req.Header.Set("X-API-Key", "valid-key")
+	w = httptest.NewRecorder()
+	handler.HandleLogs(w, req)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 on backpressure, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "2" {
+		t.Errorf("Expected Retry-After 2, got %q", got)
+	}
+
+	// Case 7: Client Rate Limit
+	mockBroker.PublishErr = nil
+	handler.Limiter = ratelimit.NewLimiter(ratelimit.Config{Default: ratelimit.Limits{EntriesPerSec: 1}})
+	for i, want := range []int{http.StatusAccepted, http.StatusTooManyRequests} {
+		req = httptest.NewRequest("POST", "/v1/logs", bytes.NewReader(body))
+		req.Header.Set("X-API-Key", "valid-key")
+		w = httptest.NewRecorder()
+		handler.HandleLogs(w, req)
+		if w.Code != want {
+			t.Errorf("Request %d: expected %d, got %d", i, want, w.Code)
+		}
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("Expected Retry-After on 429")
+	}
+	if stats := handler.Limiter.Stats(); len(stats) != 1 || stats[0].ClientID != "test-client" || stats[0].RateLimited != 1 {
+		t.Errorf("Unexpected client stats: %+v", stats)
+	}
+
+	// Case 8: A request the broker refuses is not charged
+	handler.Limiter = ratelimit.NewLimiter(ratelimit.Config{Default: ratelimit.Limits{EntriesPerSec: 1}})
+	mockBroker.PublishErr = &broker.BackpressureError{Subscriber: "file", RetryAfter: time.Second}
+	for i, want := range []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable} {
+		req = httptest.NewRequest("POST", "/v1/logs", bytes.NewReader(body))
+		req.Header.Set("X-API-Key", "valid-key")
+		w = httptest.NewRecorder()
+		handler.HandleLogs(w, req)
+		if w.Code != want {
+			t.Errorf("Refused request %d: expected %d, got %d", i, want, w.Code)
+		}
+	}
+	if stats := handler.Limiter.Stats(); stats[0].AcceptedEntries != 0 || stats[0].RateLimited != 0 {
+		t.Errorf("Expected refused requests to be refunded, got %+v", stats)
+	}
+}
+
+func TestHandler_HandleLogs_Validation(t *testing.T) {
+	mockBroker := &MockBroker{}
+	handler := NewHandler(mockBroker, mockVerifierValid)
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	body := `[
+		{"message":"ok"},
+		{"message":""},
+		{"message":"bad level","level":"LOUD"},
+		{"message":"from the future","time":"` + future + `"},
+		{"message":"wrong type","sequence":"one"},
+		{"message":"also ok","level":"error"},
+		{"message":"numeric","level":30}
+	]`
+	req := httptest.NewRequest("POST", "/v1/logs", strings.NewReader(body))
+	req.Header.Set("X-API-Key", "valid-key")
+	w := httptest.NewRecorder()
+	handler.HandleLogs(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Accepted != 3 || len(mockBroker.PublishedLogs) != 3 {
+		t.Fatalf("Expected 3 accepted, got %d (published %d)", resp.Accepted, len(mockBroker.PublishedLogs))
+	}
+	for i, want := range []model.LogLevel{model.LogLevelInfo, model.LogLevelSevere, model.LogLevelWarning} {
+		if got := mockBroker.PublishedLogs[i].Level; got != want {
+			t.Errorf("Entry %d: expected level %s, got %s", i, want, got)
+		}
+	}
+
+	wantFields := map[int]string{1: "message", 2: "level", 3: "time", 4: "sequence"}
+	if len(resp.Rejected) != len(wantFields) {
+		t.Fatalf("Expected %d rejects, got %+v", len(wantFields), resp.Rejected)
+	}
+	for _, rej := range resp.Rejected {
+		if len(rej.Errors) == 0 || rej.Errors[0].Field != wantFields[rej.Index] {
+			t.Errorf("Index %d: expected %s error, got %+v", rej.Index, wantFields[rej.Index], rej.Errors)
+		}
+	}
+
+	// Every entry rejected
+	req = httptest.NewRequest("POST", "/v1/logs", strings.NewReader(`[{"message":"  "}]`))
+	req.Header.Set("X-API-Key", "valid-key")
+	w = httptest.NewRecorder()
+	handler.HandleLogs(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"index":0`) {
+		t.Errorf("Expected 400 with report, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandler_HandleLogs_Traceparent(t *testing.T) {
+	mockBroker := &MockBroker{}
+	handler := NewHandler(mockBroker, mockVerifierValid)
+
+	body := `[{"message":"inherits"},{"message":"own","trace_id":"0AF7651916CD43DD8448EB211C80319C","span_id":"b7ad6b7169203331"}]`
+	req := httptest.NewRequest("POST", "/v1/logs", strings.NewReader(body))
+	req.Header.Set("X-API-Key", "valid-key")
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	handler.HandleLogs(w, req)
+
+	if w.Code != http.StatusAccepted || len(mockBroker.PublishedLogs) != 2 {
+		t.Fatalf("Expected 2 accepted, got %d: %s", w.Code, w.Body.String())
+	}
+	inherited, own := mockBroker.PublishedLogs[0], mockBroker.PublishedLogs[1]
+	if inherited.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || inherited.SpanID != "00f067aa0ba902b7" || inherited.TraceFlags != 1 {
+		t.Errorf("Expected trace context from header, got %q %q %d", inherited.TraceID, inherited.SpanID, inherited.TraceFlags)
+	}
+	if own.TraceID != "0af7651916cd43dd8448eb211c80319c" || own.SpanID != "b7ad6b7169203331" {
+		t.Errorf("Expected entry's own trace context, got %q %q", own.TraceID, own.SpanID)
+	}
+
+	// Malformed IDs are rejected per entry
+	req = httptest.NewRequest("POST", "/v1/logs", strings.NewReader(`[{"message":"x","trace_id":"abc"}]`))
+	req.Header.Set("X-API-Key", "valid-key")
+	w = httptest.NewRecorder()
+	handler.HandleLogs(w, req)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "trace_id") {
+		t.Errorf("Expected 400 for malformed trace_id, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestHandler_HandleNDJSON(t *testing.T) {
+	mockBroker := &MockBroker{}
+	handler := NewHandler(mockBroker, mockVerifierValid)
+
+	// Build a stream larger than one sub-batch with a few bad lines mixed in.
+	var body bytes.Buffer
+	total := ndjsonBatchSize + 10
+	for i := 1; i <= total; i++ {
+		switch i {
+		case 3:
+			body.WriteString("{bad json\n")
+		case 5:
+			body.WriteString(`{"message":"x","level":"LOUD"}` + "\n")
+		case 7:
+			body.WriteString("\n") // blank lines are skipped
+		case 9:
+			body.WriteString(`{"message":"` + strings.Repeat("x", maxNDJSONLineBytes) + `"}` + "\n")
+		default:
+			fmt.Fprintf(&body, `{"message":"line %d","sequence":%d}`+"\n", i, i)
+		}
+	}
+	body.WriteString(`{"message":"no trailing newline"}`)
+
+	req := httptest.NewRequest("POST", "/v1/logs", &body)
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req.Header.Set("X-API-Key", "valid-key")
+	w := httptest.NewRecorder()
+	handler.HandleLogs(w, req)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var resp IngestResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if resp.Accepted != total-3 {
+		t.Errorf("Expected %d accepted, got %d", total-3, resp.Accepted)
+	}
+	if len(resp.Rejected) != 3 || resp.Rejected[0].Line != 3 || resp.Rejected[1].Line != 5 || resp.Rejected[2].Line != 9 {
+		t.Fatalf("Unexpected rejects: %+v", resp.Rejected)
+	}
+	if fields := resp.Rejected[1].Fields; len(fields) != 1 || fields[0].Field != "level" {
+		t.Errorf("Expected level validation error, got %+v", fields)
+	}
+	if mockBroker.PublishCalls != 2 {
+		t.Errorf("Expected 2 sub-batches, got %d", mockBroker.PublishCalls)
+	}
+	if got := mockBroker.PublishedLogs[len(mockBroker.PublishedLogs)-1].Message; got != "no trailing newline" {
+		t.Errorf("Expected last line to be ingested, got %q", got)
+	}
+
+	// Every line rejected
+	req = httptest.NewRequest("POST", "/v1/logs/ndjson", strings.NewReader("nope\n[1]\n"))
+	req.Header.Set("X-API-Key", "valid-key")
+	w = httptest.NewRecorder()
+	handler.HandleNDJSON(w, req)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when every line is rejected, got %d", w.Code)
+	}
+
+	// Broker failure reports how far the stream got
+	mockBroker.PublishErr = errors.New("broker fail")
+	req = httptest.NewRequest("POST", "/v1/logs/ndjson", strings.NewReader(`{"message":"a"}`+"\n"))
+	req.Header.Set("X-API-Key", "valid-key")
+	w = httptest.NewRecorder()
+	handler.HandleNDJSON(w, req)
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 on broker error, got %d", w.Code)
+	}
 }
 
 // Ensure the MockBroker satisfies the interface
 var _ broker.Broker = &MockBroker{}
+
+func TestHandleStatus_ClientsOnlyForAdmins(t *testing.T) {
+	limiter := ratelimit.NewLimiter(ratelimit.Config{Default: ratelimit.Limits{EntriesPerSec: 10}})
+	limiter.Allow("test-client", 1, 10)
+	verifier := func(key string) (auth.Identity, error) {
+		if key == "admin-key" {
+			return auth.Identity{ClientID: "ops", Scopes: []string{auth.ScopeAdmin}}, nil
+		}
+		return mockVerifierValid(key)
+	}
+	status := HandleStatus(&MockBroker{}, verifier, limiter, nil, nil)
+
+	for _, tt := range []struct {
+		key     string
+		clients int
+	}{{"", 0}, {"valid-key", 0}, {"admin-key", 1}} {
+		req := httptest.NewRequest("GET", "/status", nil)
+		if tt.key != "" {
+			req.Header.Set("X-API-Key", tt.key)
+		}
+		w := httptest.NewRecorder()
+		status(w, req)
+
+		var resp StatusResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("Failed to decode status: %v", err)
+		}
+		if resp.Status != "ok" || len(resp.Clients) != tt.clients {
+			t.Errorf("Key %q: expected %d client sections, got %+v", tt.key, tt.clients, resp)
+		}
+	}
+}
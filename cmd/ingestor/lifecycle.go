@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/broker"
+)
+
+// workerGroup runs long-lived components such as subscribers. Workers are
+// expected to return on their own once the broker is closed and their queue is
+// drained; their context is only cancelled when draining takes too long.
+type workerGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	// cancelGrace bounds how long Drain waits for workers to return once
+	// their context is cancelled.
+	cancelGrace time.Duration
+
+	mu      sync.Mutex
+	running map[string]struct{}
+	wg      sync.WaitGroup
+}
+
+func newWorkerGroup() *workerGroup {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &workerGroup{
+		ctx:         ctx,
+		cancel:      cancel,
+		cancelGrace: 5 * time.Second,
+		running:     make(map[string]struct{}),
+	}
+}
+
+// Go starts run in its own goroutine under the given name.
+func (g *workerGroup) Go(name string, run func(ctx context.Context) error) {
+	g.mu.Lock()
+	g.running[name] = struct{}{}
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		defer func() {
+			g.mu.Lock()
+			delete(g.running, name)
+			g.mu.Unlock()
+		}()
+
+		if err := run(g.ctx); err != nil && err != context.Canceled {
+			log.Printf("%s exited with error: %v", name, err)
+		}
+	}()
+}
+
+// Drain waits up to timeout for every worker to return, then cancels the
+// stragglers. It returns the names of workers that did not finish in time.
+// Workers that ignore the cancellation are left running after cancelGrace.
+func (g *workerGroup) Drain(timeout time.Duration) []string {
+	done := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-time.After(timeout):
+	}
+
+	g.mu.Lock()
+	stragglers := make([]string, 0, len(g.running))
+	for name := range g.running {
+		stragglers = append(stragglers, name)
+	}
+	g.mu.Unlock()
+
+	g.cancel()
+	select {
+	case <-done:
+	case <-time.After(g.cancelGrace):
+		log.Printf("Shutdown: workers still running %v after cancellation, giving up on them", g.cancelGrace)
+	}
+	return stragglers
+}
+
+// reportShutdown logs what each subscriber received and anything that never
+// made it to storage.
+func reportShutdown(b broker.Broker, stragglers []string) {
+	ingested, dropped := b.Stats()
+	log.Printf("Shutdown: %d logs ingested, %d dropped by the broker", ingested, dropped)
+
+	for _, s := range b.SubscriberStats() {
+		log.Printf("Shutdown: subscriber %s delivered=%d dropped=%d rejected=%d undelivered_batches=%d",
+			s.Name, s.Delivered, s.Dropped, s.Rejected, s.QueueDepth)
+	}
+	for _, name := range stragglers {
+		log.Printf("Shutdown: %s did not drain within the timeout, queued logs were abandoned", name)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestWorkerGroup_Drain(t *testing.T) {
+	g := newWorkerGroup()
+
+	finished := make(chan struct{})
+	g.Go("quick", func(ctx context.Context) error {
+		<-finished
+		return nil
+	})
+	g.Go("stuck", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	close(finished)
+	stragglers := g.Drain(50 * time.Millisecond)
+
+	if len(stragglers) != 1 || stragglers[0] != "stuck" {
+		t.Errorf("Expected only 'stuck' to be reported, got %v", stragglers)
+	}
+}
+
+func TestWorkerGroup_DrainIgnoresCancel(t *testing.T) {
+	g := newWorkerGroup()
+	g.cancelGrace = 20 * time.Millisecond
+
+	block := make(chan struct{})
+	defer close(block)
+	g.Go("unresponsive", func(ctx context.Context) error {
+		<-block
+		return nil
+	})
+
+	done := make(chan []string, 1)
+	go func() { done <- g.Drain(20 * time.Millisecond) }()
+	select {
+	case stragglers := <-done:
+		if len(stragglers) != 1 || stragglers[0] != "unresponsive" {
+			t.Errorf("Expected 'unresponsive' to be reported, got %v", stragglers)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Drain did not return for a worker ignoring cancellation")
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+const (
+	ndjsonContentType = "application/x-ndjson"
+	// ndjsonBatchSize bounds how many decoded entries are held before publishing.
+	ndjsonBatchSize = 500
+	// maxNDJSONLineBytes is the longest record accepted on a single line.
+	maxNDJSONLineBytes = 1 << 20
+)
+
+var errLineTooLong = fmt.Errorf("line exceeds %d bytes", maxNDJSONLineBytes)
+
+// LineError describes a record rejected from a streamed request.
+type LineError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+	// Fields is set when the record decoded but failed validation.
+	Fields []model.FieldError `json:"fields,omitempty"`
+}
+
+// IngestResponse is returned by the streaming endpoint.
+type IngestResponse struct {
+	Status   string      `json:"status"`
+	Accepted int         `json:"accepted"`
+	Rejected []LineError `json:"rejected,omitempty"`
+	// LinesProcessed is set when the request fails part way through. Every line
+	// up to it was either published or rejected, so clients can resume after it.
+	LinesProcessed int    `json:"lines_processed,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// HandleNDJSON ingests newline-delimited JSON log entries. Records are decoded
+// one line at a time and published in bounded sub-batches, so arbitrarily large
+// bodies never sit in memory at once. Bad lines are reported, not fatal.
+func (h *Handler) HandleNDJSON(w http.ResponseWriter, r *http.Request) {
+	identity, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	body, err := decodeBody(r, h.MaxBodyBytes)
+	if err != nil {
+		status, msg := bodyErrorStatus(err)
+		http.Error(w, msg, status)
+		return
+	}
+	defer body.Close()
+
+	resp := IngestResponse{Status: "accepted"}
+	batch := make([]model.LogEntry, 0, ndjsonBatchSize)
+	batchBytes := int64(0)
+	processed := 0 // lines fully handled, i.e. safe to skip on retry
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		h.enrich(r, identity, batch)
+		if err := h.publish(r.Context(), identity, batch, batchBytes); err != nil {
+			return err
+		}
+		resp.Accepted += len(batch)
+		// The broker may still hold the slice, start a fresh one.
+		batch = make([]model.LogEntry, 0, ndjsonBatchSize)
+		batchBytes = 0
+		return nil
+	}
+
+	reader := bufio.NewReaderSize(body, 64*1024)
+	for lineNo := 1; ; lineNo++ {
+		line, err := readLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != errLineTooLong {
+			// Publish what was decoded so far, the client resumes after it.
+			if flushErr := flush(); flushErr != nil {
+				h.writePublishError(w, resp, processed, flushErr)
+				return
+			}
+			status, msg := bodyErrorStatus(err)
+			resp.Status = "error"
+			resp.Error = msg
+			resp.LinesProcessed = lineNo - 1
+			writeJSON(w, status, resp)
+			return
+		}
+
+		if err == errLineTooLong {
+			resp.Rejected = append(resp.Rejected, LineError{Line: lineNo, Error: err.Error()})
+		} else if line = bytes.TrimSpace(line); len(line) > 0 {
+			if entry, errs := h.decodeEntry(line); errs != nil {
+				resp.Rejected = append(resp.Rejected, LineError{Line: lineNo, Error: errs.Error(), Fields: errs})
+			} else {
+				batch = append(batch, entry)
+				batchBytes += int64(len(line))
+			}
+		}
+
+		if len(batch) >= ndjsonBatchSize {
+			if err := flush(); err != nil {
+				h.writePublishError(w, resp, processed, err)
+				return
+			}
+			processed = lineNo
+		}
+		if len(batch) == 0 {
+			processed = lineNo
+		}
+	}
+
+	if err := flush(); err != nil {
+		h.writePublishError(w, resp, processed, err)
+		return
+	}
+
+	status := http.StatusAccepted
+	if resp.Accepted == 0 && len(resp.Rejected) > 0 {
+		resp.Status = "rejected"
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, resp)
+}
+
+func (h *Handler) writePublishError(w http.ResponseWriter, resp IngestResponse, processed int, err error) {
+	status, msg := publishErrorStatus(w, err)
+	resp.Status = "error"
+	resp.Error = msg
+	resp.LinesProcessed = processed
+	writeJSON(w, status, resp)
+}
+
+// readLine returns the next line without its terminator. Lines longer than
+// maxNDJSONLineBytes are consumed and reported as errLineTooLong.
+func readLine(r *bufio.Reader) ([]byte, error) {
+	var line []byte
+	tooLong := false
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if !tooLong {
+			if len(line)+len(chunk) > maxNDJSONLineBytes+1 {
+				tooLong, line = true, nil
+			} else {
+				line = append(line, chunk...)
+			}
+		}
+
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err == io.EOF && (len(line) > 0 || tooLong):
+			// Last line without a trailing newline.
+		case err != nil:
+			return nil, err
+		}
+
+		if tooLong {
+			return nil, errLineTooLong
+		}
+		return bytes.TrimSuffix(line, []byte("\n")), nil
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+const (
+	otlpProtobufContentType = "application/x-protobuf"
+	otlpJSONContentType     = "application/json"
+)
+
+// HandleOTLPLogs implements the OTLP/HTTP logs receiver (POST /v1/otlp/logs)
+// for both the binary protobuf and the JSON encodings.
+func (h *Handler) HandleOTLPLogs(w http.ResponseWriter, r *http.Request) {
+	identity, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if contentType != otlpProtobufContentType && contentType != otlpJSONContentType {
+		http.Error(w, "Unsupported Content-Type, expected application/x-protobuf or application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := decodeBody(r, h.MaxBodyBytes)
+	if err != nil {
+		status, msg := bodyErrorStatus(err)
+		http.Error(w, msg, status)
+		return
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		status, msg := bodyErrorStatus(err)
+		http.Error(w, msg, status)
+		return
+	}
+
+	req := &collogspb.ExportLogsServiceRequest{}
+	if contentType == otlpJSONContentType {
+		err = protojson.UnmarshalOptions{DiscardUnknown: true}.Unmarshal(data, req)
+	} else {
+		err = proto.Unmarshal(data, req)
+	}
+	if err != nil {
+		http.Error(w, "Invalid Payload", http.StatusBadRequest)
+		return
+	}
+
+	// Records are validated like JSON entries; invalid ones are reported as a
+	// partial success, and a request with nothing valid is rejected.
+	resp := &collogspb.ExportLogsServiceResponse{}
+	logs := otlpToEntries(req, contentType == otlpJSONContentType)
+	valid := logs[:0]
+	for i := range logs {
+		var errs model.ValidationErrors
+		if err := logs[i].Validate(h.Validation, time.Now()); errors.As(err, &errs) {
+			if resp.PartialSuccess == nil {
+				resp.PartialSuccess = &collogspb.ExportLogsPartialSuccess{
+					ErrorMessage: fmt.Sprintf("log record %d: %v", i, errs),
+				}
+			}
+			resp.PartialSuccess.RejectedLogRecords++
+			continue
+		}
+		valid = append(valid, logs[i])
+	}
+	if len(valid) == 0 && resp.PartialSuccess != nil {
+		http.Error(w, "Invalid log records: "+resp.PartialSuccess.ErrorMessage, http.StatusBadRequest)
+		return
+	}
+	if len(valid) > 0 {
+		h.enrich(r, identity, valid)
+		if err := h.publish(r.Context(), identity, valid, int64(len(data))); err != nil {
+			status, msg := publishErrorStatus(w, err)
+			http.Error(w, msg, status)
+			return
+		}
+	}
+
+	var out []byte
+	if contentType == otlpJSONContentType {
+		out, err = protojson.Marshal(resp)
+	} else {
+		out, err = proto.Marshal(resp)
+	}
+	if err != nil {
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(out)
+}
+
+// otlpToEntries flattens an export request into log entries:
+//   - service.name (resource) becomes Source and the scope name becomes LoggerName
+//   - record attributes become Object, except exception.* which fill Error/Stacktrace
+//   - trace and span IDs fill TraceID/SpanID/TraceFlags
+//   - resource and scope attributes and severity go into Extra
+func otlpToEntries(req *collogspb.ExportLogsServiceRequest, hexIDs bool) []model.LogEntry {
+	var logs []model.LogEntry
+
+	for _, rl := range req.GetResourceLogs() {
+		resourceAttrs := attributesToMap(rl.GetResource().GetAttributes())
+		source, _ := resourceAttrs["service.name"].(string)
+
+		for _, sl := range rl.GetScopeLogs() {
+			scope := sl.GetScope()
+			var scopeInfo map[string]interface{}
+			if scope.GetName() != "" || scope.GetVersion() != "" || len(scope.GetAttributes()) > 0 {
+				scopeInfo = map[string]interface{}{"name": scope.GetName()}
+				if scope.GetVersion() != "" {
+					scopeInfo["version"] = scope.GetVersion()
+				}
+				if attrs := attributesToMap(scope.GetAttributes()); len(attrs) > 0 {
+					scopeInfo["attributes"] = attrs
+				}
+			}
+
+			for _, rec := range sl.GetLogRecords() {
+				entry := model.LogEntry{
+					Level:      otlpSeverityToLevel(rec.GetSeverityNumber(), rec.GetSeverityText()),
+					Message:    anyValueToString(rec.GetBody()),
+					LoggerName: scope.GetName(),
+					Source:     source,
+					Extra:      map[string]interface{}{},
+				}
+
+				switch {
+				case rec.GetTimeUnixNano() != 0:
+					entry.Time = time.Unix(0, int64(rec.GetTimeUnixNano())).UTC()
+				case rec.GetObservedTimeUnixNano() != 0:
+					entry.Time = time.Unix(0, int64(rec.GetObservedTimeUnixNano())).UTC()
+				}
+
+				attrs := attributesToMap(rec.GetAttributes())
+				if v, ok := attrs["exception.message"].(string); ok {
+					entry.Error = v
+					delete(attrs, "exception.message")
+				} else if v, ok := attrs["exception.type"].(string); ok {
+					entry.Error = v
+				}
+				if v, ok := attrs["exception.stacktrace"].(string); ok {
+					entry.Stacktrace = v
+					delete(attrs, "exception.stacktrace")
+				}
+				if v, ok := attrs["session.id"].(string); ok {
+					entry.SessionID = v
+				}
+				if len(attrs) > 0 {
+					entry.Object = attrs
+				}
+
+				if len(resourceAttrs) > 0 {
+					entry.Extra["resource"] = resourceAttrs
+				}
+				if scopeInfo != nil {
+					entry.Extra["scope"] = scopeInfo
+				}
+				if rec.GetSeverityNumber() != logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED {
+					entry.Extra["severity_number"] = int32(rec.GetSeverityNumber())
+				}
+				if rec.GetSeverityText() != "" {
+					entry.Extra["severity_text"] = rec.GetSeverityText()
+				}
+				if rec.GetEventName() != "" {
+					entry.Extra["event_name"] = rec.GetEventName()
+				}
+				entry.TraceID = otlpID(rec.GetTraceId(), 16, hexIDs)
+				entry.SpanID = otlpID(rec.GetSpanId(), 8, hexIDs)
+				// Only the low byte carries the W3C trace flags.
+				entry.TraceFlags = uint8(rec.GetFlags() & 0xff)
+
+				logs = append(logs, entry)
+			}
+		}
+	}
+	return logs
+}
+
+// otlpSeverityToLevel follows the mapping used by the OpenTelemetry
+// java.util.logging bridge, falling back to the severity text and then to
+// INFO, so every record gets a valid level.
+func otlpSeverityToLevel(num logspb.SeverityNumber, text string) model.LogLevel {
+	switch {
+	case num >= logspb.SeverityNumber_SEVERITY_NUMBER_ERROR:
+		return model.LogLevelSevere
+	case num >= logspb.SeverityNumber_SEVERITY_NUMBER_WARN:
+		return model.LogLevelWarning
+	case num >= logspb.SeverityNumber_SEVERITY_NUMBER_INFO:
+		return model.LogLevelInfo
+	case num >= logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG3:
+		return model.LogLevelConfig
+	case num == logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG2:
+		return model.LogLevelFine
+	case num == logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG:
+		return model.LogLevelFiner
+	case num >= logspb.SeverityNumber_SEVERITY_NUMBER_TRACE:
+		return model.LogLevelFinest
+	}
+	if level, ok := model.ParseLevel(text); ok {
+		return level
+	}
+	return model.LogLevelInfo
+}
+
+// otlpID renders a trace or span ID as lowercase hex. The OTLP JSON encoding
+// carries IDs as hex strings, which protojson decodes as base64 into a slice of
+// the wrong length; re-encoding that slice recovers the original hex string.
+func otlpID(id []byte, size int, hexIDs bool) string {
+	if len(id) == 0 {
+		return ""
+	}
+	if hexIDs && len(id) != size {
+		if decoded, err := hex.DecodeString(base64.StdEncoding.EncodeToString(id)); err == nil {
+			id = decoded
+		}
+	}
+	for _, b := range id {
+		if b != 0 {
+			return hex.EncodeToString(id)
+		}
+	}
+	return "" // all-zero IDs are invalid
+}
+
+func attributesToMap(kvs []*commonpb.KeyValue) map[string]interface{} {
+	if len(kvs) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		m[kv.GetKey()] = anyValueToInterface(kv.GetValue())
+	}
+	return m
+}
+
+func anyValueToInterface(v *commonpb.AnyValue) interface{} {
+	switch val := v.GetValue().(type) {
+	case *commonpb.AnyValue_StringValue:
+		return val.StringValue
+	case *commonpb.AnyValue_BoolValue:
+		return val.BoolValue
+	case *commonpb.AnyValue_IntValue:
+		return val.IntValue
+	case *commonpb.AnyValue_DoubleValue:
+		return val.DoubleValue
+	case *commonpb.AnyValue_BytesValue:
+		return base64.StdEncoding.EncodeToString(val.BytesValue)
+	case *commonpb.AnyValue_ArrayValue:
+		out := make([]interface{}, 0, len(val.ArrayValue.GetValues()))
+		for _, item := range val.ArrayValue.GetValues() {
+			out = append(out, anyValueToInterface(item))
+		}
+		return out
+	case *commonpb.AnyValue_KvlistValue:
+		return attributesToMap(val.KvlistValue.GetValues())
+	}
+	return nil
+}
+
+// anyValueToString returns string bodies as-is and JSON-encodes structured ones.
+func anyValueToString(v *commonpb.AnyValue) string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.GetValue().(*commonpb.AnyValue_StringValue); ok {
+		return s.StringValue
+	}
+	val := anyValueToInterface(v)
+	if val == nil {
+		return ""
+	}
+	data, err := json.Marshal(val)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	collogspb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+func stringAttr(key, value string) *commonpb.KeyValue {
+	return &commonpb.KeyValue{Key: key, Value: &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: value}}}
+}
+
+func TestHandler_HandleOTLPLogs_Protobuf(t *testing.T) {
+	ts := time.Now().UTC().Truncate(time.Second)
+	req := &collogspb.ExportLogsServiceRequest{
+		ResourceLogs: []*logspb.ResourceLogs{{
+			Resource: &resourcepb.Resource{Attributes: []*commonpb.KeyValue{stringAttr("service.name", "checkout")}},
+			ScopeLogs: []*logspb.ScopeLogs{{
+				Scope: &commonpb.InstrumentationScope{Name: "com.example.Payment", Version: "1.2.0"},
+				LogRecords: []*logspb.LogRecord{{
+					TimeUnixNano:   uint64(ts.UnixNano()),
+					SeverityNumber: logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+					SeverityText:   "ERROR",
+					Body:           &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: "payment failed"}},
+					Attributes: []*commonpb.KeyValue{
+						stringAttr("order.id", "o-42"),
+						stringAttr("exception.message", "card declined"),
+						stringAttr("exception.stacktrace", "at Payment.charge"),
+					},
+					TraceId: []byte{0x5b, 0x8e, 0xff, 0xf7, 0x98, 0x03, 0x81, 0x03, 0xd2, 0x69, 0xb6, 0x33, 0x81, 0x3f, 0xc6, 0x0c},
+					SpanId:  []byte{0xee, 0xe1, 0x9b, 0x7e, 0xc3, 0xc1, 0xb1, 0x74},
+				}},
+			}},
+		}},
+	}
+	body, _ := proto.Marshal(req)
+
+	mockBroker := &MockBroker{}
+	handler := NewHandler(mockBroker, mockVerifierValid)
+
+	r := httptest.NewRequest("POST", "/v1/otlp/logs", bytes.NewReader(body))
+	r.Header.Set("X-API-Key", "valid-key")
+	r.Header.Set("Content-Type", "application/x-protobuf")
+	w := httptest.NewRecorder()
+	handler.HandleOTLPLogs(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if err := proto.Unmarshal(w.Body.Bytes(), &collogspb.ExportLogsServiceResponse{}); err != nil {
+		t.Errorf("Expected protobuf response, got %v", err)
+	}
+	if len(mockBroker.PublishedLogs) != 1 {
+		t.Fatalf("Expected 1 log published, got %d", len(mockBroker.PublishedLogs))
+	}
+
+	entry := mockBroker.PublishedLogs[0]
+	if entry.Message != "payment failed" || entry.Level != model.LogLevelSevere {
+		t.Errorf("Unexpected message/level: %q %q", entry.Message, entry.Level)
+	}
+	if entry.Source != "checkout" || entry.LoggerName != "com.example.Payment" {
+		t.Errorf("Unexpected source/logger: %q %q", entry.Source, entry.LoggerName)
+	}
+	if !entry.Time.Equal(ts) {
+		t.Errorf("Expected time %v, got %v", ts, entry.Time)
+	}
+	if entry.Error != "card declined" || entry.Stacktrace != "at Payment.charge" {
+		t.Errorf("Unexpected error/stacktrace: %q %q", entry.Error, entry.Stacktrace)
+	}
+	if entry.Object["order.id"] != "o-42" {
+		t.Errorf("Expected record attributes in Object, got %v", entry.Object)
+	}
+	if entry.TraceID != "5b8efff798038103d269b633813fc60c" || entry.SpanID != "eee19b7ec3c1b174" {
+		t.Errorf("Unexpected trace context: %q %q", entry.TraceID, entry.SpanID)
+	}
+}
+
+func TestHandler_HandleOTLPLogs_JSON(t *testing.T) {
+	body := fmt.Sprintf(`{
+	  "resourceLogs": [{
+	    "resource": {"attributes": [{"key": "service.name", "value": {"stringValue": "api"}}]},
+	    "scopeLogs": [{
+	      "scope": {"name": "http"},
+	      "logRecords": [{
+	        "timeUnixNano": "%d",
+	        "severityNumber": 13,
+	        "body": {"kvlistValue": {"values": [{"key": "status", "value": {"intValue": "503"}}]}},
+	        "traceId": "5b8efff798038103d269b633813fc60c",
+	        "spanId": "eee19b7ec3c1b174"
+	      }]
+	    }]
+	  }]
+	}`, time.Now().UnixNano())
+
+	mockBroker := &MockBroker{}
+	handler := NewHandler(mockBroker, mockVerifierValid)
+
+	r := httptest.NewRequest("POST", "/v1/otlp/logs", bytes.NewReader([]byte(body)))
+	r.Header.Set("X-API-Key", "valid-key")
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	handler.HandleOTLPLogs(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("Expected JSON response, got %q", ct)
+	}
+	if len(mockBroker.PublishedLogs) != 1 {
+		t.Fatalf("Expected 1 log published, got %d", len(mockBroker.PublishedLogs))
+	}
+
+	entry := mockBroker.PublishedLogs[0]
+	if entry.Level != model.LogLevelWarning || entry.Message != `{"status":503}` {
+		t.Errorf("Unexpected level/message: %q %q", entry.Level, entry.Message)
+	}
+	if entry.TraceID != "5b8efff798038103d269b633813fc60c" || entry.SpanID != "eee19b7ec3c1b174" {
+		t.Errorf("Expected hex trace context to survive JSON decoding, got %q %q", entry.TraceID, entry.SpanID)
+	}
+
+	// Unsupported encoding
+	r = httptest.NewRequest("POST", "/v1/otlp/logs", bytes.NewReader([]byte(body)))
+	r.Header.Set("X-API-Key", "valid-key")
+	r.Header.Set("Content-Type", "text/plain")
+	w = httptest.NewRecorder()
+	handler.HandleOTLPLogs(w, r)
+	if w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415, got %d", w.Code)
+	}
+}
+
+func TestOTLPSeverityToLevel(t *testing.T) {
+	tests := []struct {
+		num  logspb.SeverityNumber
+		text string
+		want model.LogLevel
+	}{
+		{logspb.SeverityNumber_SEVERITY_NUMBER_WARN, "", model.LogLevelWarning},
+		{logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, "warn", model.LogLevelWarning},
+		{logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, "Error", model.LogLevelSevere},
+		{logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, "notice-ish", model.LogLevelInfo},
+		{logspb.SeverityNumber_SEVERITY_NUMBER_UNSPECIFIED, "", model.LogLevelInfo},
+	}
+	for _, tt := range tests {
+		if got := otlpSeverityToLevel(tt.num, tt.text); got != tt.want {
+			t.Errorf("otlpSeverityToLevel(%v, %q) = %q, want %q", tt.num, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestHandler_HandleOTLPLogs_Validation(t *testing.T) {
+	record := func(body string) *logspb.LogRecord {
+		return &logspb.LogRecord{
+			TimeUnixNano: uint64(time.Now().UnixNano()),
+			Body:         &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: body}},
+		}
+	}
+	send := func(handler *Handler, records ...*logspb.LogRecord) *httptest.ResponseRecorder {
+		req := &collogspb.ExportLogsServiceRequest{ResourceLogs: []*logspb.ResourceLogs{{
+			ScopeLogs: []*logspb.ScopeLogs{{LogRecords: records}},
+		}}}
+		body, _ := proto.Marshal(req)
+		r := httptest.NewRequest("POST", "/v1/otlp/logs", bytes.NewReader(body))
+		r.Header.Set("X-API-Key", "valid-key")
+		r.Header.Set("Content-Type", "application/x-protobuf")
+		w := httptest.NewRecorder()
+		handler.HandleOTLPLogs(w, r)
+		return w
+	}
+
+	mockBroker := &MockBroker{}
+	handler := NewHandler(mockBroker, mockVerifierValid)
+	handler.Validation.MaxMessageBytes = 10
+
+	// Invalid records are dropped and reported as a partial success.
+	w := send(handler, record("ok"), record(""), record("far too long a message"))
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	resp := &collogspb.ExportLogsServiceResponse{}
+	if err := proto.Unmarshal(w.Body.Bytes(), resp); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if got := resp.GetPartialSuccess().GetRejectedLogRecords(); got != 2 || resp.GetPartialSuccess().GetErrorMessage() == "" {
+		t.Errorf("Expected 2 rejected records with a message, got %v", resp.GetPartialSuccess())
+	}
+	if len(mockBroker.PublishedLogs) != 1 || mockBroker.PublishedLogs[0].Message != "ok" {
+		t.Errorf("Expected only the valid record to be published, got %+v", mockBroker.PublishedLogs)
+	}
+
+	// Nothing valid at all is a bad request.
+	if w := send(handler, record("")); w.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 when every record is invalid, got %d", w.Code)
+	}
+}
@@ -5,19 +5,33 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/predatorx7/logtopus/pkg/auth"
 	"github.com/predatorx7/logtopus/pkg/broker"
+	"github.com/predatorx7/logtopus/pkg/ratelimit"
+	"github.com/predatorx7/logtopus/pkg/retention"
+	"github.com/predatorx7/logtopus/pkg/subscriber/file"
 )
 
 type StatusResponse struct {
-	Status       string `json:"status"`
-	Uptime       string `json:"uptime"`
-	IngestedLogs uint64 `json:"ingested_logs"`
-	DroppedLogs  uint64 `json:"dropped_logs"`
+	Status       string                   `json:"status"`
+	Uptime       string                   `json:"uptime"`
+	IngestedLogs uint64                   `json:"ingested_logs"`
+	DroppedLogs  uint64                   `json:"dropped_logs"`
+	Subscribers  []broker.SubscriberStats `json:"subscribers"`
+	Listeners    []SyslogListenerStats    `json:"listeners,omitempty"`
+	// Clients, FileWriter and Retention name clients and sessions, and are
+	// only reported to callers with an admin key.
+	Clients    []ratelimit.ClientStats `json:"clients,omitempty"`
+	FileWriter *file.Stats             `json:"file_writer,omitempty"`
+	Retention  *retention.Stats        `json:"retention,omitempty"`
 }
 
 var startTime = time.Now()
 
-func HandleStatus(b *broker.MemoryBroker) http.HandlerFunc {
+// HandleStatus reports the ingestor's counters. The endpoint needs no key, so
+// health checks keep working; the per-client sections are added when the
+// request carries a key with the admin scope.
+func HandleStatus(b broker.Broker, verifier func(string) (auth.Identity, error), limiter *ratelimit.Limiter, fileSub *file.FileSubscriber, retentionManager *retention.Manager, listeners ...*syslogListener) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		ingested, dropped := b.Stats()
 
@@ -26,9 +40,37 @@ func HandleStatus(b *broker.MemoryBroker) http.HandlerFunc {
 			Uptime:       time.Since(startTime).String(),
 			IngestedLogs: ingested,
 			DroppedLogs:  dropped,
+			Subscribers:  b.SubscriberStats(),
+		}
+		if isAdmin(r, verifier) {
+			if limiter != nil {
+				resp.Clients = limiter.Stats()
+			}
+			if fileSub != nil {
+				stats := fileSub.Stats()
+				resp.FileWriter = &stats
+			}
+			if retentionManager != nil {
+				stats := retentionManager.Stats()
+				resp.Retention = &stats
+			}
+		}
+		for _, l := range listeners {
+			resp.Listeners = append(resp.Listeners, l.Stats())
 		}
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(resp)
 	}
 }
+
+// isAdmin reports whether the request carries a valid key with the admin
+// scope.
+func isAdmin(r *http.Request, verifier func(string) (auth.Identity, error)) bool {
+	apiKey := r.Header.Get("X-API-Key")
+	if apiKey == "" {
+		return false
+	}
+	identity, err := verifier(apiKey)
+	return err == nil && identity.HasScope(auth.ScopeAdmin)
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+var errInvalidSyslog = errors.New("invalid syslog message")
+
+var syslogFacilities = [...]string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+var syslogSeverities = [...]string{
+	"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug",
+}
+
+// syslogSeverityToLevel maps a syslog severity (0-7) onto the JUL-style levels.
+func syslogSeverityToLevel(severity int) model.LogLevel {
+	switch {
+	case severity <= 3: // emerg, alert, crit, err
+		return model.LogLevelSevere
+	case severity == 4:
+		return model.LogLevelWarning
+	case severity <= 6: // notice, info
+		return model.LogLevelInfo
+	default:
+		return model.LogLevelFine
+	}
+}
+
+// parseSyslog parses a single RFC 5424 or RFC 3164 message. The hostname goes
+// to Source, the app-name (or tag) to LoggerName, and the remaining header
+// fields to Extra. now is used to complete RFC 3164 timestamps, which carry
+// neither a year nor a time zone.
+func parseSyslog(msg []byte, now time.Time) (model.LogEntry, error) {
+	msg = bytes.TrimRight(msg, "\r\n\x00")
+	if len(msg) == 0 {
+		return model.LogEntry{}, fmt.Errorf("%w: empty message", errInvalidSyslog)
+	}
+
+	// RFC 3164 4.3.3: messages without a PRI are treated as user.notice.
+	pri, rest := 13, msg
+	if msg[0] == '<' {
+		end := bytes.IndexByte(msg, '>')
+		if end < 2 || end > 4 {
+			return model.LogEntry{}, fmt.Errorf("%w: malformed PRI", errInvalidSyslog)
+		}
+		n, err := strconv.Atoi(string(msg[1:end]))
+		if err != nil || n < 0 || n > 191 {
+			return model.LogEntry{}, fmt.Errorf("%w: malformed PRI", errInvalidSyslog)
+		}
+		pri, rest = n, msg[end+1:]
+	}
+
+	facility, severity := pri/8, pri%8
+	entry := model.LogEntry{
+		Level: syslogSeverityToLevel(severity),
+		Extra: map[string]interface{}{
+			"facility": syslogFacilities[facility],
+			"severity": syslogSeverities[severity],
+		},
+	}
+
+	var err error
+	if bytes.HasPrefix(rest, []byte("1 ")) {
+		err = parseRFC5424(rest[2:], &entry)
+	} else {
+		parseRFC3164(rest, now, &entry)
+	}
+	if err != nil {
+		return model.LogEntry{}, err
+	}
+	return entry, nil
+}
+
+// parseRFC5424 parses everything after "<PRI>1 ":
+// TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA [MSG]
+func parseRFC5424(rest []byte, entry *model.LogEntry) error {
+	fields := make([]string, 5)
+	for i := range fields {
+		sp := bytes.IndexByte(rest, ' ')
+		if sp <= 0 {
+			return fmt.Errorf("%w: truncated RFC 5424 header", errInvalidSyslog)
+		}
+		fields[i], rest = string(rest[:sp]), rest[sp+1:]
+	}
+	timestamp, hostname, appName, procID, msgID := fields[0], fields[1], fields[2], fields[3], fields[4]
+
+	if timestamp != "-" {
+		t, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return fmt.Errorf("%w: bad timestamp %q", errInvalidSyslog, timestamp)
+		}
+		entry.Time = t
+	}
+	if hostname != "-" {
+		entry.Source = hostname
+	}
+	if appName != "-" {
+		entry.LoggerName = appName
+	}
+	if procID != "-" {
+		entry.Extra["procid"] = procID
+	}
+	if msgID != "-" {
+		entry.Extra["msgid"] = msgID
+	}
+
+	sd, rest, err := parseStructuredData(rest)
+	if err != nil {
+		return err
+	}
+	if len(sd) > 0 {
+		entry.Extra["structured_data"] = sd
+	}
+
+	rest = bytes.TrimPrefix(rest, []byte(" "))
+	rest = bytes.TrimPrefix(rest, []byte("\xef\xbb\xbf")) // UTF-8 BOM
+	entry.Message = string(rest)
+	return nil
+}
+
+// parseStructuredData parses "-" or one or more [SD-ID PARAM="VALUE" ...]
+// elements and returns what follows them.
+func parseStructuredData(rest []byte) (map[string]interface{}, []byte, error) {
+	if len(rest) > 0 && rest[0] == '-' {
+		return nil, rest[1:], nil
+	}
+
+	sd := make(map[string]interface{})
+	for len(rest) > 0 && rest[0] == '[' {
+		rest = rest[1:]
+		end := bytes.IndexAny(rest, " ]")
+		if end <= 0 {
+			return nil, nil, fmt.Errorf("%w: malformed structured data", errInvalidSyslog)
+		}
+		id := string(rest[:end])
+		rest = rest[end:]
+
+		params := make(map[string]interface{})
+		for len(rest) > 0 && rest[0] == ' ' {
+			rest = rest[1:]
+			eq := bytes.IndexByte(rest, '=')
+			if eq <= 0 || eq+1 >= len(rest) || rest[eq+1] != '"' {
+				return nil, nil, fmt.Errorf("%w: malformed structured data", errInvalidSyslog)
+			}
+			name := string(rest[:eq])
+			rest = rest[eq+2:]
+
+			var value strings.Builder
+			closed := false
+			for i := 0; i < len(rest); i++ {
+				c := rest[i]
+				if c == '\\' && i+1 < len(rest) && (rest[i+1] == '"' || rest[i+1] == '\\' || rest[i+1] == ']') {
+					value.WriteByte(rest[i+1])
+					i++
+					continue
+				}
+				if c == '"' {
+					rest, closed = rest[i+1:], true
+					break
+				}
+				value.WriteByte(c)
+			}
+			if !closed {
+				return nil, nil, fmt.Errorf("%w: unterminated structured data value", errInvalidSyslog)
+			}
+			params[name] = value.String()
+		}
+
+		if len(rest) == 0 || rest[0] != ']' {
+			return nil, nil, fmt.Errorf("%w: malformed structured data", errInvalidSyslog)
+		}
+		rest = rest[1:]
+		sd[id] = params
+	}
+	if len(sd) == 0 {
+		return nil, nil, fmt.Errorf("%w: malformed structured data", errInvalidSyslog)
+	}
+	return sd, rest, nil
+}
+
+// parseRFC3164 parses the BSD format: "Mmm dd hh:mm:ss HOSTNAME TAG[PID]: MSG".
+// The format is loosely followed in practice, so anything that does not fit is
+// kept as the message rather than rejected.
+func parseRFC3164(rest []byte, now time.Time, entry *model.LogEntry) {
+	const stampLen = len(time.Stamp)
+
+	parsed := false
+	if len(rest) > stampLen && rest[stampLen] == ' ' {
+		if t, err := time.ParseInLocation(time.Stamp, string(rest[:stampLen]), now.Location()); err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+			// A December message received in January belongs to last year.
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			entry.Time, rest, parsed = t, rest[stampLen+1:], true
+		}
+	}
+	if !parsed {
+		// Some daemons (rsyslog among them) send an RFC 3339 timestamp instead.
+		if sp := bytes.IndexByte(rest, ' '); sp > 0 {
+			if t, err := time.Parse(time.RFC3339Nano, string(rest[:sp])); err == nil {
+				entry.Time, rest, parsed = t, rest[sp+1:], true
+			}
+		}
+	}
+	if !parsed {
+		entry.Message = string(rest)
+		return
+	}
+
+	if sp := bytes.IndexByte(rest, ' '); sp > 0 {
+		entry.Source, rest = string(rest[:sp]), rest[sp+1:]
+	}
+
+	// TAG is terminated by "[" or ":". Without either, it is all message.
+	end := bytes.IndexAny(rest, "[: ")
+	if end > 0 && rest[end] != ' ' {
+		entry.LoggerName = string(rest[:end])
+		rest = rest[end:]
+		if rest[0] == '[' {
+			if closeIdx := bytes.IndexByte(rest, ']'); closeIdx > 0 {
+				entry.Extra["procid"] = string(rest[1:closeIdx])
+				rest = rest[closeIdx+1:]
+			}
+		}
+		rest = bytes.TrimPrefix(rest, []byte(":"))
+		rest = bytes.TrimPrefix(rest, []byte(" "))
+	}
+	entry.Message = string(rest)
+}
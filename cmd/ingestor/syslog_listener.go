@@ -0,0 +1,333 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/broker"
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/ratelimit"
+)
+
+const (
+	// maxSyslogMessageBytes bounds a single datagram or framed TCP message.
+	maxSyslogMessageBytes = 64 << 10
+	syslogBatchSize       = 500
+	syslogFlushInterval   = 200 * time.Millisecond
+)
+
+// SyslogListenerStats is reported per listener in /status.
+type SyslogListenerStats struct {
+	Name        string `json:"name"`
+	Addr        string `json:"addr"`
+	Received    uint64 `json:"received"`
+	Published   uint64 `json:"published"`
+	ParseErrors uint64 `json:"parse_errors"`
+	// Dropped counts parsed messages the rate limiter or broker refused.
+	Dropped     uint64 `json:"dropped"`
+	Connections int64  `json:"connections,omitempty"`
+}
+
+// syslogListener receives syslog messages over UDP or TCP and publishes them
+// to the broker in batches. TCP accepts both octet-counted and newline-framed
+// messages (RFC 6587), detected per message. Senders have no API key, so every
+// entry belongs to the configured client and counts against its limits.
+type syslogListener struct {
+	network  string // "udp" or "tcp"
+	addr     string
+	broker   broker.Broker
+	clientID string
+	limiter  *ratelimit.Limiter // optional
+	now      func() time.Time
+
+	packetConn net.PacketConn
+	listener   net.Listener
+
+	entries   chan syslogMessage
+	flushDone chan struct{}
+	conns     sync.WaitGroup
+
+	mu        sync.Mutex
+	closed    bool
+	openConns map[net.Conn]struct{}
+
+	received    atomic.Uint64
+	published   atomic.Uint64
+	parseErrors atomic.Uint64
+	dropped     atomic.Uint64
+	connections atomic.Int64
+}
+
+// syslogMessage is a parsed entry and the size of the message it came from.
+type syslogMessage struct {
+	entry model.LogEntry
+	size  int
+}
+
+func newSyslogListener(network, addr string, b broker.Broker, clientID string, limiter *ratelimit.Limiter) *syslogListener {
+	return &syslogListener{
+		network:   network,
+		addr:      addr,
+		broker:    b,
+		clientID:  clientID,
+		limiter:   limiter,
+		now:       time.Now,
+		entries:   make(chan syslogMessage, syslogBatchSize),
+		flushDone: make(chan struct{}),
+		openConns: make(map[net.Conn]struct{}),
+	}
+}
+
+// Listen binds the socket and starts serving in the background.
+func (l *syslogListener) Listen() error {
+	switch l.network {
+	case "udp":
+		pc, err := net.ListenPacket("udp", l.addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on udp %s: %w", l.addr, err)
+		}
+		l.packetConn = pc
+		l.addr = pc.LocalAddr().String()
+		l.conns.Add(1)
+		go l.serveUDP()
+	case "tcp":
+		ln, err := net.Listen("tcp", l.addr)
+		if err != nil {
+			return fmt.Errorf("failed to listen on tcp %s: %w", l.addr, err)
+		}
+		l.listener = ln
+		l.addr = ln.Addr().String()
+		l.conns.Add(1)
+		go l.serveTCP()
+	default:
+		return fmt.Errorf("unsupported syslog network %q", l.network)
+	}
+
+	go l.flushLoop()
+	return nil
+}
+
+// Close stops reading, then publishes whatever is still batched.
+func (l *syslogListener) Close() error {
+	l.mu.Lock()
+	if l.closed {
+		l.mu.Unlock()
+		return nil
+	}
+	l.closed = true
+	for conn := range l.openConns {
+		conn.Close()
+	}
+	l.mu.Unlock()
+
+	var err error
+	if l.packetConn != nil {
+		err = l.packetConn.Close()
+	}
+	if l.listener != nil {
+		err = l.listener.Close()
+	}
+
+	l.conns.Wait()
+	close(l.entries)
+	<-l.flushDone
+	return err
+}
+
+func (l *syslogListener) Stats() SyslogListenerStats {
+	return SyslogListenerStats{
+		Name:        "syslog-" + l.network,
+		Addr:        l.addr,
+		Received:    l.received.Load(),
+		Published:   l.published.Load(),
+		ParseErrors: l.parseErrors.Load(),
+		Dropped:     l.dropped.Load(),
+		Connections: l.connections.Load(),
+	}
+}
+
+func (l *syslogListener) serveUDP() {
+	defer l.conns.Done()
+
+	buf := make([]byte, maxSyslogMessageBytes)
+	for {
+		n, addr, err := l.packetConn.ReadFrom(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Syslog UDP read error: %v", err)
+			continue
+		}
+		l.handle(buf[:n], addr)
+	}
+}
+
+func (l *syslogListener) serveTCP() {
+	defer l.conns.Done()
+
+	for {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			log.Printf("Syslog TCP accept error: %v", err)
+			continue
+		}
+
+		l.mu.Lock()
+		if l.closed {
+			l.mu.Unlock()
+			conn.Close()
+			return
+		}
+		l.openConns[conn] = struct{}{}
+		l.conns.Add(1)
+		l.mu.Unlock()
+
+		go l.serveConn(conn)
+	}
+}
+
+func (l *syslogListener) serveConn(conn net.Conn) {
+	l.connections.Add(1)
+	defer func() {
+		l.mu.Lock()
+		delete(l.openConns, conn)
+		l.mu.Unlock()
+		conn.Close()
+		l.connections.Add(-1)
+		l.conns.Done()
+	}()
+
+	reader := bufio.NewReaderSize(conn, 64*1024)
+	for {
+		msg, err := readSyslogFrame(reader)
+		if err != nil {
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				log.Printf("Syslog TCP connection from %s closed: %v", conn.RemoteAddr(), err)
+			}
+			return
+		}
+		l.handle(msg, conn.RemoteAddr())
+	}
+}
+
+// readSyslogFrame reads one message from a TCP stream. Octet-counted frames
+// start with a digit ("LEN SP MSG"); anything else is newline-terminated.
+func readSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	first, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+
+	if first[0] >= '1' && first[0] <= '9' {
+		lenStr, err := r.ReadString(' ')
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(lenStr[:len(lenStr)-1])
+		if err != nil || n <= 0 || n > maxSyslogMessageBytes {
+			return nil, fmt.Errorf("invalid octet count %q", lenStr)
+		}
+		msg := make([]byte, n)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return nil, err
+		}
+		return msg, nil
+	}
+
+	var msg []byte
+	for {
+		chunk, err := r.ReadSlice('\n')
+		msg = append(msg, chunk...)
+		if len(msg) > maxSyslogMessageBytes {
+			return nil, fmt.Errorf("message exceeds %d bytes", maxSyslogMessageBytes)
+		}
+		switch {
+		case errors.Is(err, bufio.ErrBufferFull):
+			continue
+		case err == io.EOF && len(msg) > 0:
+			return msg, nil
+		case err != nil:
+			return nil, err
+		}
+		return msg, nil
+	}
+}
+
+func (l *syslogListener) handle(msg []byte, from net.Addr) {
+	if len(bytes.TrimSpace(msg)) == 0 {
+		return
+	}
+	l.received.Add(1)
+
+	entry, err := parseSyslog(msg, l.now())
+	if err != nil {
+		l.parseErrors.Add(1)
+		return
+	}
+	if host, _, err := net.SplitHostPort(from.String()); err == nil {
+		entry.ClientIP = host
+	}
+	entry.ClientID = l.clientID
+	entry.Extra["transport"] = "syslog/" + l.network
+	if entry.Time.IsZero() {
+		entry.Time = l.now()
+	}
+	l.entries <- syslogMessage{entry: entry, size: len(msg)}
+}
+
+// flushLoop publishes entries once a batch fills up or the flush interval
+// passes, and drains the channel after Close.
+func (l *syslogListener) flushLoop() {
+	defer close(l.flushDone)
+
+	batch := make([]model.LogEntry, 0, syslogBatchSize)
+	var size int64
+	ticker := time.NewTicker(syslogFlushInterval)
+	defer ticker.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := publishLimited(context.Background(), l.broker, l.limiter, l.clientID, batch, size); err != nil {
+			l.dropped.Add(uint64(len(batch)))
+			log.Printf("Syslog %s: failed to publish %d logs: %v", l.network, len(batch), err)
+		} else {
+			l.published.Add(uint64(len(batch)))
+		}
+		// The broker may still hold the slice, start a fresh one.
+		batch = make([]model.LogEntry, 0, syslogBatchSize)
+		size = 0
+	}
+
+	for {
+		select {
+		case msg, ok := <-l.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, msg.entry)
+			size += int64(msg.size)
+			if len(batch) >= syslogBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
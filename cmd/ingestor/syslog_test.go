@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/broker"
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/ratelimit"
+)
+
+func TestParseSyslog_RFC5424(t *testing.T) {
+	msg := `<165>1 2026-10-11T22:14:15.003Z mymachine.example.com evntslog 1234 ID47 [exampleSDID@32473 iut="3" eventSource="App\"lication"] An application event`
+
+	entry, err := parseSyslog([]byte(msg), time.Now())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	if entry.Level != model.LogLevelInfo {
+		t.Errorf("Expected INFO for notice, got %s", entry.Level)
+	}
+	if entry.Source != "mymachine.example.com" || entry.LoggerName != "evntslog" {
+		t.Errorf("Unexpected source/logger: %q %q", entry.Source, entry.LoggerName)
+	}
+	if entry.Message != "An application event" {
+		t.Errorf("Unexpected message: %q", entry.Message)
+	}
+	if want := time.Date(2026, 10, 11, 22, 14, 15, 3000000, time.UTC); !entry.Time.Equal(want) {
+		t.Errorf("Expected time %v, got %v", want, entry.Time)
+	}
+	if entry.Extra["facility"] != "local4" || entry.Extra["procid"] != "1234" || entry.Extra["msgid"] != "ID47" {
+		t.Errorf("Unexpected extra: %v", entry.Extra)
+	}
+	sd, _ := entry.Extra["structured_data"].(map[string]interface{})
+	params, _ := sd["exampleSDID@32473"].(map[string]interface{})
+	if params["eventSource"] != `App"lication` || params["iut"] != "3" {
+		t.Errorf("Unexpected structured data: %v", sd)
+	}
+
+	if _, err := parseSyslog([]byte("<34>1 2026-10-11T22:14:15Z host"), time.Now()); err == nil {
+		t.Error("Expected error for truncated header, got nil")
+	}
+	if _, err := parseSyslog([]byte("<999>oops"), time.Now()); err == nil {
+		t.Error("Expected error for out of range PRI, got nil")
+	}
+}
+
+func TestParseSyslog_RFC3164(t *testing.T) {
+	now := time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC)
+
+	entry, err := parseSyslog([]byte("<34>Dec 31 22:14:15 mymachine su[230]: 'su root' failed for lonvick on /dev/pts/8\n"), now)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if entry.Level != model.LogLevelSevere {
+		t.Errorf("Expected SEVERE for crit, got %s", entry.Level)
+	}
+	if entry.Source != "mymachine" || entry.LoggerName != "su" || entry.Extra["procid"] != "230" {
+		t.Errorf("Unexpected header fields: %q %q %v", entry.Source, entry.LoggerName, entry.Extra)
+	}
+	if entry.Message != "'su root' failed for lonvick on /dev/pts/8" {
+		t.Errorf("Unexpected message: %q", entry.Message)
+	}
+	// December seen in January belongs to the previous year.
+	if want := time.Date(2025, 12, 31, 22, 14, 15, 0, time.UTC); !entry.Time.Equal(want) {
+		t.Errorf("Expected time %v, got %v", want, entry.Time)
+	}
+
+	// No PRI and no header: user.notice, kept as message.
+	entry, err = parseSyslog([]byte("just some text"), now)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if entry.Message != "just some text" || entry.Extra["facility"] != "user" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+}
+
+func TestSyslogListener_TCPAndUDP(t *testing.T) {
+	b := broker.NewMemoryBroker()
+	defer b.Close()
+	ch, _ := b.Subscribe(context.Background())
+
+	tcp := newSyslogListener("tcp", "127.0.0.1:0", b, "devices", nil)
+	if err := tcp.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	udp := newSyslogListener("udp", "127.0.0.1:0", b, "devices", nil)
+	if err := udp.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+
+	conn, err := net.Dial("tcp", tcp.addr)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	counted := "<14>1 - host app - - - octet counted"
+	fmt.Fprintf(conn, "%d %s", len(counted), counted)
+	fmt.Fprint(conn, "<14>Oct 11 22:14:15 host app: newline framed\n")
+	fmt.Fprint(conn, "<999>garbage\n")
+	conn.Close()
+
+	uconn, err := net.Dial("udp", udp.addr)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	fmt.Fprint(uconn, "<11>1 - host app - - - over udp")
+	uconn.Close()
+
+	// Wait for the TCP connection to finish before closing the listeners.
+	deadline := time.Now().Add(2 * time.Second)
+	for (tcp.Stats().Received < 3 || tcp.Stats().Connections > 0 || udp.Stats().Received < 1) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	tcp.Close()
+	udp.Close()
+
+	messages := map[string]bool{}
+	timeout := time.After(2 * time.Second)
+	for len(messages) < 3 {
+		select {
+		case batch := <-ch:
+			for _, entry := range batch {
+				messages[entry.Message] = true
+				if entry.ClientID != "devices" {
+					t.Errorf("Expected client devices, got %q", entry.ClientID)
+				}
+			}
+		case <-timeout:
+			t.Fatalf("Timeout waiting for logs, got %v", messages)
+		}
+	}
+	for _, want := range []string{"octet counted", "newline framed", "over udp"} {
+		if !messages[want] {
+			t.Errorf("Missing message %q", want)
+		}
+	}
+
+	stats := tcp.Stats()
+	if stats.Received != 3 || stats.Published != 2 || stats.ParseErrors != 1 {
+		t.Errorf("Unexpected TCP stats: %+v", stats)
+	}
+	if stats := udp.Stats(); stats.Published != 1 || stats.Name != "syslog-udp" {
+		t.Errorf("Unexpected UDP stats: %+v", stats)
+	}
+}
+
+func TestSyslogListener_RateLimited(t *testing.T) {
+	b := broker.NewMemoryBroker()
+	defer b.Close()
+	limiter := ratelimit.NewLimiter(ratelimit.Config{Clients: map[string]ratelimit.Limits{"devices": {DailyBytes: 10}}})
+
+	udp := newSyslogListener("udp", "127.0.0.1:0", b, "devices", limiter)
+	if err := udp.Listen(); err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	conn, err := net.Dial("udp", udp.addr)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v", err)
+	}
+	fmt.Fprint(conn, "<11>1 - host app - - - longer than the daily quota")
+	conn.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for udp.Stats().Received < 1 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	udp.Close()
+
+	if stats := udp.Stats(); stats.Dropped != 1 || stats.Published != 0 {
+		t.Errorf("Expected the message to be dropped over quota, got %+v", stats)
+	}
+	if stats := limiter.Stats(); len(stats) != 1 || stats[0].ClientID != "devices" || stats[0].QuotaExceeded != 1 {
+		t.Errorf("Expected the quota of devices to be charged, got %+v", stats)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/predatorx7/logtopus/pkg/auth"
+	"github.com/predatorx7/logtopus/pkg/storage"
+)
+
+var errForbiddenClient = errors.New("API key is not allowed to read logs of this client")
+
+type identityKey struct{}
+
+// requireAPIKey rejects requests without a valid X-API-Key carrying the query
+// or admin scope, and stores the caller's identity in the request context.
+func requireAPIKey(verify func(string) (auth.Identity, error)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			apiKey := r.Header.Get("X-API-Key")
+			if apiKey == "" {
+				http.Error(w, "Missing API Key", http.StatusUnauthorized)
+				return
+			}
+
+			identity, err := verify(apiKey)
+			switch {
+			case errors.Is(err, auth.ErrExpiredKey):
+				http.Error(w, "API Key expired", http.StatusUnauthorized)
+				return
+			case errors.Is(err, auth.ErrRevokedKey):
+				http.Error(w, "API Key revoked", http.StatusUnauthorized)
+				return
+			case err != nil:
+				http.Error(w, "Invalid API Key", http.StatusUnauthorized)
+				return
+			}
+			if !identity.HasScope(auth.ScopeQuery) && !identity.HasScope(auth.ScopeAdmin) {
+				http.Error(w, "API Key lacks the query scope", http.StatusForbidden)
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), identityKey{}, identity)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func identityFrom(ctx context.Context) (auth.Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(auth.Identity)
+	return identity, ok
+}
+
+// scopeQuery restricts params to the caller's own entries unless it holds the
+// admin scope. Asking for another client's logs explicitly is an error rather
+// than an empty result, so misconfigured keys are easy to spot.
+func scopeQuery(identity auth.Identity, params *storage.QueryParams) error {
+	if identity.HasScope(auth.ScopeAdmin) {
+		return nil
+	}
+	if params.ClientID != "" && params.ClientID != identity.ClientID {
+		return errForbiddenClient
+	}
+	params.TenantID = identity.ClientID
+	return nil
+}
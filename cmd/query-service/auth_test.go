@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/predatorx7/logtopus/pkg/auth"
+	"github.com/predatorx7/logtopus/pkg/storage"
+)
+
+func TestRequireAPIKey(t *testing.T) {
+	verify := func(key string) (auth.Identity, error) {
+		switch key {
+		case "good-key":
+			return auth.Identity{ClientID: "client-a", Scopes: []string{auth.ScopeQuery}}, nil
+		case "ingest-key":
+			return auth.Identity{ClientID: "client-a", Scopes: []string{auth.ScopeIngest}}, nil
+		case "revoked-key":
+			return auth.Identity{}, auth.ErrRevokedKey
+		}
+		return auth.Identity{}, errors.New("invalid")
+	}
+
+	var seen auth.Identity
+	handler := requireAPIKey(verify)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = identityFrom(r.Context())
+	}))
+
+	for _, tc := range []struct {
+		key  string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"bad-key", http.StatusUnauthorized},
+		{"revoked-key", http.StatusUnauthorized},
+		{"ingest-key", http.StatusForbidden},
+		{"good-key", http.StatusOK},
+	} {
+		req := httptest.NewRequest("GET", "/v1/logs", nil)
+		if tc.key != "" {
+			req.Header.Set("X-API-Key", tc.key)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("Key %q: expected %d, got %d", tc.key, tc.want, w.Code)
+		}
+	}
+
+	if seen.ClientID != "client-a" {
+		t.Errorf("Expected identity in context, got %+v", seen)
+	}
+}
+
+func TestScopeQuery(t *testing.T) {
+	client := auth.Identity{ClientID: "client-a"}
+	admin := auth.Identity{ClientID: "ops", Scopes: []string{auth.ScopeAdmin}}
+
+	params := storage.QueryParams{}
+	if err := scopeQuery(client, &params); err != nil || params.TenantID != "client-a" {
+		t.Errorf("Expected tenant client-a, got %q (err %v)", params.TenantID, err)
+	}
+
+	params = storage.QueryParams{ClientID: "client-b"}
+	if err := scopeQuery(client, &params); err != errForbiddenClient {
+		t.Errorf("Expected errForbiddenClient, got %v", err)
+	}
+
+	params = storage.QueryParams{ClientID: "client-b"}
+	if err := scopeQuery(admin, &params); err != nil || params.TenantID != "" {
+		t.Errorf("Expected admin to be unscoped, got %q (err %v)", params.TenantID, err)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/predatorx7/logtopus/pkg/export"
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/storage"
+)
+
+// exportFlushEvery is how many entries are written between flushes of the
+// chunked response.
+const exportFlushEvery = 1000
+
+// exportRequest is the output side of an export.
+type exportRequest struct {
+	format  export.Format
+	columns []string
+	gzip    bool
+}
+
+// parseExport reads format, columns and gzip.
+func parseExport(r *http.Request) (exportRequest, error) {
+	format, err := export.ParseFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		return exportRequest{}, err
+	}
+	columns, err := export.ParseColumns(r.URL.Query().Get("columns"))
+	if err != nil {
+		return exportRequest{}, err
+	}
+	return exportRequest{format: format, columns: columns, gzip: r.URL.Query().Get("gzip") == "true"}, nil
+}
+
+// committedWriter records whether the response has started.
+type committedWriter struct {
+	http.ResponseWriter
+	committed bool
+}
+
+func (c *committedWriter) Write(p []byte) (int, error) {
+	c.committed = true
+	return c.ResponseWriter.Write(p)
+}
+
+// serveExport streams every match of params as an attachment. Failures before
+// the first byte are reported as 500; later ones abort the connection so a
+// truncated file is not mistaken for a complete one.
+func serveExport(w http.ResponseWriter, r *http.Request, exporter storage.Exporter, params storage.QueryParams, req exportRequest) {
+	filename := fmt.Sprintf("logs-%s.%s", time.Now().UTC().Format("20060102T150405Z"), req.format)
+	contentType := req.format.ContentType()
+	if req.gzip {
+		filename += ".gz"
+		contentType = "application/gzip"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+
+	cw := &committedWriter{ResponseWriter: w}
+	var out io.Writer = cw
+	var gz *gzip.Writer
+	if req.gzip {
+		gz = gzip.NewWriter(cw)
+		out = gz
+	}
+	flusher, _ := w.(http.Flusher)
+
+	fail := func(err error) {
+		log.Printf("Export failed: %v", err)
+		if !cw.committed {
+			w.Header().Del("Content-Disposition")
+			http.Error(w, "Failed to export logs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		panic(http.ErrAbortHandler)
+	}
+
+	enc, err := export.NewWriter(req.format, out, req.columns)
+	if err != nil {
+		fail(err)
+		return
+	}
+	count := 0
+	err = exporter.Export(r.Context(), params, func(entry model.LogEntry) error {
+		if err := enc.Write(entry); err != nil {
+			return err
+		}
+		if count++; count%exportFlushEvery == 0 && flusher != nil {
+			if gz != nil {
+				gz.Flush()
+			}
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err == nil {
+		err = enc.Close()
+	}
+	if err == nil && gz != nil {
+		err = gz.Close()
+	}
+	if err != nil {
+		fail(err)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/storage"
+)
+
+type fakeExporter struct {
+	entries []model.LogEntry
+	err     error
+}
+
+func (f fakeExporter) Export(ctx context.Context, params storage.QueryParams, fn func(model.LogEntry) error) error {
+	if f.err != nil {
+		return f.err
+	}
+	for _, entry := range f.entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestServeExport(t *testing.T) {
+	exporter := fakeExporter{entries: []model.LogEntry{{Message: "one", Level: "INFO"}, {Message: "two", Level: "SEVERE"}}}
+	r := httptest.NewRequest("GET", "/v1/export?format=csv&columns=level,message&gzip=true", nil)
+	req, err := parseExport(r)
+	if err != nil {
+		t.Fatalf("parseExport failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	serveExport(w, r, exporter, storage.QueryParams{}, req)
+	if w.Code != 200 || w.Header().Get("Content-Type") != "application/gzip" {
+		t.Fatalf("Unexpected response %d %q", w.Code, w.Header().Get("Content-Type"))
+	}
+	if cd := w.Header().Get("Content-Disposition"); !strings.HasSuffix(cd, `.csv.gz"`) {
+		t.Errorf("Unexpected Content-Disposition %q", cd)
+	}
+	zr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip: %v", err)
+	}
+	body, _ := io.ReadAll(zr)
+	if string(body) != "level,message\nINFO,one\nSEVERE,two\n" {
+		t.Errorf("Unexpected CSV %q", body)
+	}
+
+	// Errors before anything was written are still reported.
+	w = httptest.NewRecorder()
+	serveExport(w, r, fakeExporter{err: errors.New("store down")}, storage.QueryParams{}, exportRequest{format: "ndjson"})
+	if w.Code != 500 || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Expected a 500 without attachment, got %d", w.Code)
+	}
+
+	if _, err := parseExport(httptest.NewRequest("GET", "/v1/export?format=xml", nil)); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
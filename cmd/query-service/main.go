@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -10,10 +11,14 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/predatorx7/logtopus/pkg/auth"
+	"github.com/predatorx7/logtopus/pkg/model"
 	"github.com/predatorx7/logtopus/pkg/storage"
 	"github.com/predatorx7/logtopus/pkg/storage/clickhouse"
 	"github.com/predatorx7/logtopus/pkg/storage/file"
@@ -32,6 +37,11 @@ func main() {
 		for i := 0; i < 5; i++ {
 			chStore, err := clickhouse.NewClickHouseStore(dsn)
 			if err == nil {
+				if v := os.Getenv("TAIL_LOOKBACK"); v != "" {
+					if d, err := time.ParseDuration(v); err == nil && d > 0 {
+						chStore.TailLookback = d
+					}
+				}
 				clickHouseStore = chStore
 				break
 			}
@@ -87,6 +97,49 @@ func main() {
 		http.ServeFile(w, r, "public/openapi/openapi.base.yaml")
 	})
 
+	// 2.5 Setup Auth
+	authConfig := auth.VerifierConfig{
+		Secret:         os.Getenv("AUTH_SECRET"),
+		KeyringFile:    os.Getenv("AUTH_KEYRING_FILE"),
+		RevocationFile: os.Getenv("AUTH_REVOCATION_FILE"),
+	}
+	if authConfig.Secret == "" && authConfig.KeyringFile == "" {
+		// Only for dev, ideally strict
+		log.Println("WARNING: AUTH_SECRET not set, using default 'dev-secret'")
+		authConfig.Secret = "dev-secret"
+	}
+
+	authVerifier, err := auth.NewVerifier(authConfig)
+	if err != nil {
+		log.Fatalf("Failed to set up API key verification: %v", err)
+	}
+	if authConfig.KeyringFile != "" {
+		log.Printf("API key keyring enabled (file: %s)", authConfig.KeyringFile)
+	}
+	if authConfig.RevocationFile != "" {
+		log.Printf("API key revocation list enabled (file: %s)", authConfig.RevocationFile)
+	}
+
+	// Keys of these clients may read every client's logs, in addition to
+	// keys issued with the admin scope.
+	adminClients := make(map[string]bool)
+	for _, id := range strings.Split(os.Getenv("QUERY_ADMIN_CLIENTS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			adminClients[id] = true
+		}
+	}
+
+	verifier := func(key string) (auth.Identity, error) {
+		identity, err := authVerifier.Verify(key)
+		if err != nil {
+			return auth.Identity{}, err
+		}
+		if adminClients[identity.ClientID] && !identity.HasScope(auth.ScopeAdmin) {
+			identity.Scopes = append(identity.Scopes, auth.ScopeAdmin)
+		}
+		return identity, nil
+	}
+
 	startTime := time.Now()
 	r.Get("/status", func(w http.ResponseWriter, r *http.Request) {
 		status := map[string]interface{}{
@@ -97,9 +150,25 @@ func main() {
 		json.NewEncoder(w).Encode(status)
 	})
 
-	r.Get("/v1/logs", func(w http.ResponseWriter, r *http.Request) {
-		// Parse Query Params
-		params := storage.QueryParams{}
+	api := r.With(requireAPIKey(verifier))
+
+	maxTails := 100
+	if v := os.Getenv("QUERY_MAX_TAILS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			maxTails = n
+		}
+	}
+	tails := newTailSlots(maxTails)
+	tailHeartbeat := 15 * time.Second
+	if v := os.Getenv("TAIL_HEARTBEAT"); v != "" {
+		if d, err := time.ParseDuration(v); err == nil && d > 0 {
+			tailHeartbeat = d
+		}
+	}
+
+	// storeFor resolves the subscriber_type parameter, writing a 503 if that
+	// store is not configured.
+	storeFor := func(w http.ResponseWriter, r *http.Request) (storage.LogStore, bool) {
 		subscriberType := r.URL.Query().Get("subscriber_type")
 
 		var targetStore storage.LogStore
@@ -112,46 +181,62 @@ func main() {
 
 		if targetStore == nil {
 			http.Error(w, fmt.Sprintf("Store '%s' is not available", subscriberType), http.StatusServiceUnavailable)
-			return
+			return nil, false
 		}
+		return targetStore, true
+	}
 
-		if startStr := r.URL.Query().Get("start_time"); startStr != "" {
-			if t, err := time.Parse(time.RFC3339, startStr); err == nil {
-				params.StartTime = t
-			}
+	api.Get("/v1/logs", func(w http.ResponseWriter, r *http.Request) {
+		targetStore, ok := storeFor(w, r)
+		if !ok {
+			return
 		}
-		if endStr := r.URL.Query().Get("end_time"); endStr != "" {
-			if t, err := time.Parse(time.RFC3339, endStr); err == nil {
-				params.EndTime = t
-			}
+		params, err := parseFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
+
 		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
 			if l, err := strconv.Atoi(limitStr); err == nil {
 				params.Limit = l
 			}
 		}
-		params.Level = r.URL.Query().Get("level")
-		params.Search = r.URL.Query().Get("search")
-		params.SessionID = r.URL.Query().Get("session_id")
-		params.ClientID = r.URL.Query().Get("client_id")
-		params.Source = r.URL.Query().Get("source")
-		params.Error = r.URL.Query().Get("error")
+		order, err := storage.ParseOrder(r.URL.Query().Get("order"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		params.Order = order
+		if cursorStr := r.URL.Query().Get("cursor"); cursorStr != "" {
+			cursor, err := storage.DecodeCursor(cursorStr)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			params.Cursor = cursor
+		}
 
 		// Context parsing
-		if ctxStr := r.URL.Query().Get("context"); ctxStr != "" {
-			if n, err := strconv.Atoi(ctxStr); err == nil {
-				params.Before = n
-				params.After = n
+		for _, c := range []struct {
+			name    string
+			targets []*int
+		}{
+			{"context", []*int{&params.Before, &params.After}},
+			{"before_context", []*int{&params.Before}},
+			{"after_context", []*int{&params.After}},
+		} {
+			v := r.URL.Query().Get(c.name)
+			if v == "" {
+				continue
 			}
-		}
-		if beforeStr := r.URL.Query().Get("before_context"); beforeStr != "" {
-			if n, err := strconv.Atoi(beforeStr); err == nil {
-				params.Before = n
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, c.name+" must be a non-negative integer", http.StatusBadRequest)
+				return
 			}
-		}
-		if afterStr := r.URL.Query().Get("after_context"); afterStr != "" {
-			if n, err := strconv.Atoi(afterStr); err == nil {
-				params.After = n
+			for _, target := range c.targets {
+				*target = n
 			}
 		}
 
@@ -163,22 +248,192 @@ func main() {
 			params.After = 1000
 		}
 
+		identity, _ := identityFrom(r.Context())
+		if err := scopeQuery(identity, &params); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
 		// Context retrieval requires specific anchors
 		if (params.Before > 0 || params.After > 0) && (params.SessionID == "" && params.ClientID == "") {
 			http.Error(w, "Context retrieval requires session_id or client_id", http.StatusBadRequest)
 			return
 		}
 
+		page, err := targetStore.QueryPage(r.Context(), params)
+		if errors.Is(err, storage.ErrInvalidCursor) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to query logs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// The body stays a plain array; the continuation travels in a header.
+		if page.Next != nil {
+			w.Header().Set("X-Next-Cursor", page.Next.Encode())
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page.Logs)
+	})
+
+	// All logs of one trace, oldest first.
+	api.Get("/v1/traces/{traceID}/logs", func(w http.ResponseWriter, r *http.Request) {
+		targetStore, ok := storeFor(w, r)
+		if !ok {
+			return
+		}
+
+		traceID := strings.ToLower(chi.URLParam(r, "traceID"))
+		if !model.ValidTraceID(traceID) {
+			http.Error(w, "trace_id must be 32 hex digits", http.StatusBadRequest)
+			return
+		}
+		// Fetched oldest first, so a limit keeps the start of the trace.
+		params := storage.QueryParams{TraceID: traceID, Limit: traceLogsLimit, Order: storage.OrderOldest}
+		if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+			l, err := strconv.Atoi(limitStr)
+			if err != nil || l <= 0 {
+				http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			params.Limit = min(l, traceLogsLimit)
+		}
+
+		identity, _ := identityFrom(r.Context())
+		if err := scopeQuery(identity, &params); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
 		logs, err := targetStore.Query(r.Context(), params)
 		if err != nil {
 			http.Error(w, "Failed to query logs: "+err.Error(), http.StatusInternalServerError)
 			return
 		}
+		sortChronologically(logs)
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(logs)
 	})
 
+	// Counts of matching logs per time bucket and dimension.
+	api.Get("/v1/aggregate", func(w http.ResponseWriter, r *http.Request) {
+		targetStore, ok := storeFor(w, r)
+		if !ok {
+			return
+		}
+		aggregator, ok := targetStore.(storage.Aggregator)
+		if !ok {
+			http.Error(w, "Store does not support aggregation", http.StatusNotImplemented)
+			return
+		}
+
+		params, err := parseAggregation(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		identity, _ := identityFrom(r.Context())
+		if err := scopeQuery(identity, &params.Filter); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		buckets, err := aggregator.Aggregate(r.Context(), params)
+		if err != nil {
+			http.Error(w, "Failed to aggregate logs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"interval": params.Interval.String(),
+			"group_by": params.GroupBy,
+			"buckets":  buckets,
+		})
+	})
+
+	// Every matching log as a downloadable file, without a limit.
+	api.Get("/v1/export", func(w http.ResponseWriter, r *http.Request) {
+		targetStore, ok := storeFor(w, r)
+		if !ok {
+			return
+		}
+		exporter, ok := targetStore.(storage.Exporter)
+		if !ok {
+			http.Error(w, "Store does not support export", http.StatusNotImplemented)
+			return
+		}
+
+		params, err := parseFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		req, err := parseExport(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		identity, _ := identityFrom(r.Context())
+		if err := scopeQuery(identity, &params); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		serveExport(w, r, exporter, params, req)
+	})
+
+	// Live tail of new matching logs, as Server-Sent Events or over a
+	// WebSocket.
+	api.Get("/v1/tail", func(w http.ResponseWriter, r *http.Request) {
+		targetStore, ok := storeFor(w, r)
+		if !ok {
+			return
+		}
+		tailer, ok := targetStore.(storage.Tailer)
+		if !ok {
+			http.Error(w, "Store does not support live tail", http.StatusNotImplemented)
+			return
+		}
+
+		params, err := parseFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cursorStr := r.URL.Query().Get("cursor")
+		if cursorStr == "" {
+			cursorStr = r.Header.Get("Last-Event-ID")
+		}
+		if cursorStr != "" {
+			cursor, err := storage.DecodeCursor(cursorStr)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			params.Cursor = cursor
+		}
+
+		identity, _ := identityFrom(r.Context())
+		if err := scopeQuery(identity, &params); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		if !tails.acquire() {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "Too many live tails", http.StatusServiceUnavailable)
+			return
+		}
+		defer tails.release()
+		serveTail(w, r, tailer, params, tailHeartbeat)
+	})
+
 	// 3. Start Server
 	port := os.Getenv("QUERY_PORT")
 	if port == "" {
@@ -200,7 +455,7 @@ func main() {
 
 	// 4. Graceful Shutdown
 	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
 	<-quit
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
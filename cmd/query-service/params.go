@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/query"
+	"github.com/predatorx7/logtopus/pkg/storage"
+)
+
+// maxBuckets caps how many time buckets one aggregation may span.
+const maxBuckets = 10000
+
+// parseFilter reads the filter parameters shared by the query endpoints.
+// Malformed times are ignored as they always were; other invalid values are
+// returned as errors for a 400.
+func parseFilter(r *http.Request) (storage.QueryParams, error) {
+	values := r.URL.Query()
+	params := storage.QueryParams{}
+
+	if startStr := values.Get("start_time"); startStr != "" {
+		if t, err := time.Parse(time.RFC3339, startStr); err == nil {
+			params.StartTime = t
+		}
+	}
+	if endStr := values.Get("end_time"); endStr != "" {
+		if t, err := time.Parse(time.RFC3339, endStr); err == nil {
+			params.EndTime = t
+		}
+	}
+	params.Level = values.Get("level")
+	if minStr := values.Get("min_level"); minStr != "" {
+		level, ok := model.ParseLevel(minStr)
+		if !ok {
+			return params, fmt.Errorf("unknown min_level %q", minStr)
+		}
+		params.MinLevel = level
+	}
+	params.Search = values.Get("search")
+	params.SessionID = values.Get("session_id")
+	params.ClientID = values.Get("client_id")
+	params.Source = values.Get("source")
+	params.Error = values.Get("error")
+	params.TraceID = values.Get("trace_id")
+	for _, raw := range values["field"] {
+		f, err := storage.ParseFieldFilter(raw)
+		if err != nil {
+			return params, err
+		}
+		params.Fields = append(params.Fields, f)
+	}
+	if q := values.Get("q"); q != "" {
+		parsed, err := query.Parse(q)
+		if err != nil {
+			return params, err
+		}
+		params.Query = parsed
+	}
+	return params, nil
+}
+
+// parseAggregation reads the filter plus interval and group_by.
+func parseAggregation(r *http.Request) (storage.AggregateParams, error) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		return storage.AggregateParams{}, err
+	}
+	params := storage.AggregateParams{Filter: filter}
+
+	if intervalStr := r.URL.Query().Get("interval"); intervalStr != "" {
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil || interval < time.Second || interval%time.Second != 0 {
+			return params, fmt.Errorf("interval %q must be a whole number of seconds, e.g. 30s, 5m or 1h", intervalStr)
+		}
+		if !filter.StartTime.IsZero() && !filter.EndTime.IsZero() && filter.EndTime.Sub(filter.StartTime)/interval > maxBuckets {
+			return params, fmt.Errorf("interval %s spans more than %d buckets", intervalStr, maxBuckets)
+		}
+		params.Interval = interval
+	}
+	params.GroupBy, err = storage.ParseDimension(r.URL.Query().Get("group_by"))
+	return params, err
+}
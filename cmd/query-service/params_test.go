@@ -0,0 +1,36 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/storage"
+)
+
+func TestParseAggregation(t *testing.T) {
+	r := httptest.NewRequest("GET", "/v1/aggregate?interval=5m&group_by=source&min_level=warn&q=error:timeout", nil)
+	params, err := parseAggregation(r)
+	if err != nil {
+		t.Fatalf("parseAggregation failed: %v", err)
+	}
+	if params.Interval != 5*time.Minute || params.GroupBy != storage.DimensionSource {
+		t.Errorf("Unexpected aggregation: %+v", params)
+	}
+	if params.Filter.MinLevel != "WARNING" || params.Filter.Query == nil {
+		t.Errorf("Expected the filter to be parsed, got %+v", params.Filter)
+	}
+
+	for _, qs := range []string{
+		"interval=500ms",
+		"interval=soon",
+		"interval=1s&start_time=2024-01-01T00:00:00Z&end_time=2024-01-02T00:00:00Z",
+		"group_by=message",
+		"min_level=loud",
+		"q=level:[INFO",
+	} {
+		if _, err := parseAggregation(httptest.NewRequest("GET", "/v1/aggregate?"+qs, nil)); err == nil {
+			t.Errorf("Expected %q to be rejected", qs)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/storage"
+	"golang.org/x/net/websocket"
+)
+
+// tailSlots caps the number of concurrent live tails.
+type tailSlots chan struct{}
+
+func newTailSlots(n int) tailSlots {
+	return make(tailSlots, n)
+}
+
+// acquire takes a slot, reporting false when all are in use.
+func (t tailSlots) acquire() bool {
+	select {
+	case t <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t tailSlots) release() {
+	<-t
+}
+
+// tailEvent is one message of a tail stream.
+type tailEvent struct {
+	// Type is "log", "heartbeat" or "error".
+	Type   string          `json:"type"`
+	Cursor string          `json:"cursor,omitempty"`
+	Entry  *model.LogEntry `json:"entry,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// tailSink writes events to a client.
+type tailSink interface {
+	send(ev tailEvent) error
+}
+
+// sseSink writes Server-Sent Events. The cursor is the event id, so browsers
+// resume with Last-Event-ID on their own.
+type sseSink struct {
+	w http.ResponseWriter
+	f http.Flusher
+}
+
+func (s sseSink) send(ev tailEvent) error {
+	var err error
+	switch ev.Type {
+	case "log":
+		data, _ := json.Marshal(ev.Entry)
+		_, err = fmt.Fprintf(s.w, "id: %s\nevent: log\ndata: %s\n\n", ev.Cursor, data)
+	case "heartbeat":
+		_, err = fmt.Fprint(s.w, ": heartbeat\n\n")
+	default:
+		_, err = fmt.Fprintf(s.w, "event: error\ndata: %s\n\n", ev.Error)
+	}
+	s.f.Flush()
+	return err
+}
+
+// wsSink writes every event as a JSON text message.
+type wsSink struct {
+	conn *websocket.Conn
+}
+
+func (s wsSink) send(ev tailEvent) error {
+	return websocket.JSON.Send(s.conn, ev)
+}
+
+// streamTail sends entries from tailer to sink until ctx is done or a send
+// fails, with a heartbeat after every quiet interval.
+func streamTail(ctx context.Context, tailer storage.Tailer, params storage.QueryParams, heartbeat time.Duration, sink tailSink) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events := make(chan tailEvent, 64)
+	done := make(chan error, 1)
+	go func() {
+		done <- tailer.Tail(ctx, params, func(entry model.LogEntry, cursor storage.Cursor) error {
+			select {
+			case events <- tailEvent{Type: "log", Cursor: cursor.Encode(), Entry: &entry}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case ev := <-events:
+			if err := sink.send(ev); err != nil {
+				return err
+			}
+			ticker.Reset(heartbeat)
+		case <-ticker.C:
+			if err := sink.send(tailEvent{Type: "heartbeat"}); err != nil {
+				return err
+			}
+		case err := <-done:
+			// Deliver what the store produced before it stopped.
+			for {
+				select {
+				case ev := <-events:
+					if err := sink.send(ev); err != nil {
+						return err
+					}
+				default:
+					return err
+				}
+			}
+		}
+	}
+}
+
+// serveTail streams to a WebSocket client if the request asks for an
+// upgrade, and as Server-Sent Events otherwise.
+func serveTail(w http.ResponseWriter, r *http.Request, tailer storage.Tailer, params storage.QueryParams, heartbeat time.Duration) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		// Clients authenticate with X-API-Key on the handshake, so the
+		// origin is not checked.
+		websocket.Server{Handler: func(conn *websocket.Conn) {
+			ctx, cancel := context.WithCancel(r.Context())
+			defer cancel()
+			go func() {
+				// Incoming messages are ignored; a failed read means the client left.
+				var msg string
+				for websocket.Message.Receive(conn, &msg) == nil {
+				}
+				cancel()
+			}()
+			sink := wsSink{conn: conn}
+			if err := streamTail(ctx, tailer, params, heartbeat, sink); err != nil && ctx.Err() == nil {
+				sink.send(tailEvent{Type: "error", Error: err.Error()})
+			}
+		}}.ServeHTTP(w, r)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	sink := sseSink{w: w, f: flusher}
+	if err := streamTail(r.Context(), tailer, params, heartbeat, sink); err != nil && r.Context().Err() == nil {
+		sink.send(tailEvent{Type: "error", Error: err.Error()})
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/storage"
+)
+
+// fakeTailer delivers its entries, then waits for cancellation.
+type fakeTailer struct {
+	entries []model.LogEntry
+}
+
+func (f fakeTailer) Tail(ctx context.Context, params storage.QueryParams, fn func(model.LogEntry, storage.Cursor) error) error {
+	for i, entry := range f.entries {
+		if err := fn(entry, storage.Cursor{Time: entry.Time, Offset: int64(i)}); err != nil {
+			return err
+		}
+	}
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// recordingSink keeps events and fails once full.
+type recordingSink struct {
+	events []tailEvent
+	max    int
+}
+
+func (s *recordingSink) send(ev tailEvent) error {
+	s.events = append(s.events, ev)
+	if len(s.events) >= s.max {
+		return errors.New("client gone")
+	}
+	return nil
+}
+
+func TestStreamTail(t *testing.T) {
+	tailer := fakeTailer{entries: []model.LogEntry{{Message: "one"}, {Message: "two"}}}
+	sink := &recordingSink{max: 3}
+
+	err := streamTail(context.Background(), tailer, storage.QueryParams{}, 10*time.Millisecond, sink)
+	if err == nil || err.Error() != "client gone" {
+		t.Fatalf("Expected the sink error, got %v", err)
+	}
+	if sink.events[0].Type != "log" || sink.events[0].Entry.Message != "one" || sink.events[1].Entry.Message != "two" {
+		t.Errorf("Expected both entries in order, got %+v", sink.events)
+	}
+	if sink.events[2].Type != "heartbeat" {
+		t.Errorf("Expected a heartbeat once idle, got %+v", sink.events[2])
+	}
+
+	c, err := storage.DecodeCursor(sink.events[1].Cursor)
+	if err != nil || c.Offset != 1 {
+		t.Errorf("Expected the entry's cursor, got %+v, %v", c, err)
+	}
+}
+
+func TestTailSlots(t *testing.T) {
+	slots := newTailSlots(1)
+	if !slots.acquire() {
+		t.Fatal("Expected a free slot")
+	}
+	if slots.acquire() {
+		t.Error("Expected the second tail to be refused")
+	}
+	slots.release()
+	if !slots.acquire() {
+		t.Error("Expected the released slot to be reusable")
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+// traceLogsLimit caps how many entries the trace endpoint returns.
+const traceLogsLimit = 10000
+
+// sortChronologically orders logs oldest first, breaking ties by sequence
+// number so entries from the same millisecond keep their emit order.
+func sortChronologically(logs []model.LogEntry) {
+	sort.SliceStable(logs, func(i, j int) bool {
+		if !logs[i].Time.Equal(logs[j].Time) {
+			return logs[i].Time.Before(logs[j].Time)
+		}
+		return logs[i].Sequence < logs[j].Sequence
+	})
+}
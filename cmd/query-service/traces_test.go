@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+func TestSortChronologically(t *testing.T) {
+	base := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	logs := []model.LogEntry{
+		{Message: "c", Time: base.Add(time.Second)},
+		{Message: "b", Time: base, Sequence: 2},
+		{Message: "a", Time: base, Sequence: 1},
+	}
+	sortChronologically(logs)
+	for i, want := range []string{"a", "b", "c"} {
+		if logs[i].Message != want {
+			t.Errorf("Position %d: expected %s, got %s", i, want, logs[i].Message)
+		}
+	}
+}
@@ -4,11 +4,55 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"strings"
+	"time"
 )
 
+// Scopes a key can carry.
+const (
+	// ScopeIngest allows writing logs to the ingestor.
+	ScopeIngest = "ingest"
+	// ScopeQuery allows reading the key's own client's logs.
+	ScopeQuery = "query"
+	// ScopeAdmin lets a key read every client's logs on the query service.
+	ScopeAdmin = "admin"
+)
+
+// legacyScopes are granted to clientID.signature keys, which predate scopes.
+var legacyScopes = []string{ScopeIngest, ScopeQuery}
+
+// Identity is the caller an API key was verified for.
+type Identity struct {
+	ClientID string
+	// KeyID distinguishes keys issued to the same client without revealing them.
+	KeyID string
+	// SecretID is the keyring secret the key was signed with, if any.
+	SecretID string
+	Scopes   []string
+	// ExpiresAt is zero for keys that never expire.
+	ExpiresAt time.Time
+}
+
+// HasScope reports whether the identity was granted scope.
+func (id Identity) HasScope(scope string) bool {
+	for _, s := range id.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// KeyID returns a short, stable identifier for apiKey that is safe to store and
+// log. Versioned keys carry their own ID; this is used for legacy keys.
+func KeyID(apiKey string) string {
+	sum := sha256.Sum256([]byte(apiKey))
+	return hex.EncodeToString(sum[:8])
+}
+
 // IssueAPIKey generates a specialized API key for the given clientID signed with the secret.
 // Format: clientID.signature
 func IssueAPIKey(clientID string, secret []byte) string {
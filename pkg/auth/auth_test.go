@@ -2,7 +2,11 @@ package auth
 
 import (
 	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestIssueAndVerifyAPIKey(t *testing.T) {
@@ -49,3 +53,113 @@ func TestIssueAndVerifyAPIKey(t *testing.T) {
 		t.Error("Expected failure with forged key, got success")
 	}
 }
+
+func TestKeyID(t *testing.T) {
+	secret := []byte("my-secret-key")
+	a := IssueAPIKey("client-a", secret)
+	b := IssueAPIKey("client-b", secret)
+
+	if KeyID(a) != KeyID(a) {
+		t.Error("Expected KeyID to be stable")
+	}
+	if KeyID(a) == KeyID(b) {
+		t.Error("Expected different keys to have different IDs")
+	}
+	if len(KeyID(a)) != 16 {
+		t.Errorf("Expected 16 hex characters, got %q", KeyID(a))
+	}
+}
+
+func TestScopedKey(t *testing.T) {
+	secret := []byte("my-secret-key")
+
+	key, keyID, err := IssueScopedKey("client-a", secret, KeyOptions{Scopes: []string{ScopeQuery}})
+	if err != nil {
+		t.Fatalf("Failed to issue key: %v", err)
+	}
+	if !strings.HasPrefix(key, "v1.") {
+		t.Errorf("Expected versioned key, got %s", key)
+	}
+
+	identity, err := ParseAPIKey(key, secret)
+	if err != nil {
+		t.Fatalf("Expected key to be valid, got %v", err)
+	}
+	if identity.ClientID != "client-a" || identity.KeyID != keyID {
+		t.Errorf("Unexpected identity: %+v", identity)
+	}
+	if !identity.HasScope(ScopeQuery) || identity.HasScope(ScopeIngest) {
+		t.Errorf("Unexpected scopes: %v", identity.Scopes)
+	}
+
+	// Tampering with the claims invalidates the signature.
+	parts := strings.Split(key, ".")
+	forged := base64.RawURLEncoding.EncodeToString([]byte(`{"kid":"x","cid":"client-a","scp":["admin"]}`))
+	if _, err := ParseAPIKey(parts[0]+"."+forged+"."+parts[2], secret); err != ErrInvalidKey {
+		t.Errorf("Expected ErrInvalidKey for forged claims, got %v", err)
+	}
+	if _, err := ParseAPIKey(key, []byte("wrong-secret")); err != ErrInvalidKey {
+		t.Errorf("Expected ErrInvalidKey with wrong secret, got %v", err)
+	}
+
+	// Legacy keys keep working with the scopes they implicitly had.
+	identity, err = ParseAPIKey(IssueAPIKey("client-b", secret), secret)
+	if err != nil || !identity.HasScope(ScopeIngest) || identity.HasScope(ScopeAdmin) {
+		t.Errorf("Unexpected legacy identity: %+v (err %v)", identity, err)
+	}
+
+	if _, _, err := IssueScopedKey("client-a", secret, KeyOptions{Scopes: []string{"root"}}); err == nil {
+		t.Error("Expected error for unknown scope, got nil")
+	}
+}
+
+func TestVerifier_ExpiryAndRevocation(t *testing.T) {
+	secret := []byte("my-secret-key")
+	path := filepath.Join(t.TempDir(), "revoked.txt")
+
+	revocations, err := NewRevocationList(path)
+	if err != nil {
+		t.Fatalf("Failed to open revocation list: %v", err)
+	}
+	now := time.Now()
+	v := &Verifier{Secret: secret, Revocations: revocations, Now: func() time.Time { return now }}
+
+	key, keyID, _ := IssueScopedKey("client-a", secret, KeyOptions{
+		Scopes:    []string{ScopeIngest},
+		ExpiresAt: now.Add(time.Hour),
+	})
+	if _, err := v.Verify(key); err != nil {
+		t.Fatalf("Expected valid key, got %v", err)
+	}
+
+	now = now.Add(2 * time.Hour)
+	if _, err := v.Verify(key); err != ErrExpiredKey {
+		t.Errorf("Expected ErrExpiredKey, got %v", err)
+	}
+	now = now.Add(-2 * time.Hour)
+
+	if err := revocations.Revoke(keyID, "leaked in CI logs"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, err := v.Verify(key); err != ErrRevokedKey {
+		t.Errorf("Expected ErrRevokedKey, got %v", err)
+	}
+
+	// A separately loaded list (e.g. another service) sees the revocation too.
+	other, err := NewRevocationList(path)
+	if err != nil {
+		t.Fatalf("Failed to reload revocation list: %v", err)
+	}
+	if !other.IsRevoked(keyID) {
+		t.Error("Expected key to be revoked after reload")
+	}
+
+	// Legacy keys are revoked by the ID derived from the key.
+	legacy := IssueAPIKey("client-b", secret)
+	os.WriteFile(path, []byte("# revoked keys\n"+KeyID(legacy)+"\n"), 0644)
+	fresh, _ := NewRevocationList(path)
+	v.Revocations = fresh
+	if _, err := v.Verify(legacy); err != ErrRevokedKey {
+		t.Errorf("Expected legacy key to be revoked, got %v", err)
+	}
+}
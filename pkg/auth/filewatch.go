@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// reloadCheckInterval bounds how often watched files are stat'ed.
+const reloadCheckInterval = time.Second
+
+// fileWatch tracks whether a file changed since it was last loaded. It is not
+// safe for concurrent use; callers hold their own lock.
+type fileWatch struct {
+	path      string
+	loaded    os.FileInfo // nil when the file did not exist
+	checkedAt time.Time
+}
+
+// due reports whether the check interval has passed since the last check.
+func (w *fileWatch) due() bool {
+	return time.Since(w.checkedAt) >= reloadCheckInterval
+}
+
+// check stats the file and reports whether it differs from the last recorded
+// state. info is nil when the file does not exist.
+func (w *fileWatch) check() (changed bool, info os.FileInfo, err error) {
+	w.checkedAt = time.Now()
+
+	info, err = os.Stat(w.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return w.loaded != nil, nil, nil
+	}
+	if err != nil {
+		return false, nil, err
+	}
+	if w.loaded != nil && info.ModTime().Equal(w.loaded.ModTime()) && info.Size() == w.loaded.Size() {
+		return false, info, nil
+	}
+	return true, info, nil
+}
+
+// record marks info as loaded.
+func (w *fileWatch) record(info os.FileInfo) {
+	w.loaded = info
+}
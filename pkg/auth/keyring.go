@@ -0,0 +1,207 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var secretIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Secret is a signing secret in a keyring. Keys signed with it embed its ID.
+type Secret struct {
+	ID        string    `json:"id"`
+	Key       []byte    `json:"key"`
+	CreatedAt time.Time `json:"created_at"`
+	// RetiredAt is set once keys signed with this secret stop being accepted.
+	RetiredAt time.Time `json:"retired_at,omitzero"`
+}
+
+// Retired reports whether the secret was retired.
+func (s Secret) Retired() bool {
+	return !s.RetiredAt.IsZero()
+}
+
+// Keyring holds the signing secrets used for rotation: add a new secret, reissue
+// keys with it gradually, then retire the old one. New keys are signed with
+// the primary secret.
+type Keyring struct {
+	Primary string   `json:"primary"`
+	Secrets []Secret `json:"secrets"`
+}
+
+// LoadKeyring reads a keyring file. A missing file yields an empty keyring.
+func LoadKeyring(path string) (*Keyring, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &Keyring{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	var k Keyring
+	if err := json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring: %w", err)
+	}
+	return &k, nil
+}
+
+// Save writes the keyring atomically, readable only by its owner.
+func (k *Keyring) Save(path string) error {
+	data, err := json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode keyring: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".keyring-*")
+	if err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to write keyring: %w", err)
+	}
+	return nil
+}
+
+// Add generates a new secret and makes it the primary.
+func (k *Keyring) Add(id string) (Secret, error) {
+	if !secretIDPattern.MatchString(id) {
+		return Secret{}, fmt.Errorf("invalid secret id %q (use letters, digits, - and _)", id)
+	}
+	if _, ok := k.Get(id); ok {
+		return Secret{}, fmt.Errorf("secret %q already exists", id)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return Secret{}, fmt.Errorf("failed to generate secret: %w", err)
+	}
+
+	secret := Secret{ID: id, Key: key, CreatedAt: time.Now().UTC()}
+	k.Secrets = append(k.Secrets, secret)
+	k.Primary = id
+	return secret, nil
+}
+
+// Retire stops accepting keys signed with the secret. The primary can only be
+// retired once another active secret exists, which then becomes the primary.
+func (k *Keyring) Retire(id string) error {
+	idx := -1
+	for i, s := range k.Secrets {
+		if s.ID == id {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("secret %q not found", id)
+	}
+	if k.Secrets[idx].Retired() {
+		return fmt.Errorf("secret %q is already retired", id)
+	}
+
+	if k.Primary == id {
+		// Promote the newest remaining active secret.
+		next := ""
+		for _, s := range k.Secrets {
+			if s.ID != id && !s.Retired() {
+				next = s.ID
+			}
+		}
+		if next == "" {
+			return fmt.Errorf("secret %q is the only active secret, add a new one first", id)
+		}
+		k.Primary = next
+	}
+
+	k.Secrets[idx].RetiredAt = time.Now().UTC()
+	return nil
+}
+
+// Get returns the secret with the given ID, retired or not.
+func (k *Keyring) Get(id string) (Secret, bool) {
+	for _, s := range k.Secrets {
+		if s.ID == id {
+			return s, true
+		}
+	}
+	return Secret{}, false
+}
+
+// PrimarySecret returns the secret new keys should be signed with.
+func (k *Keyring) PrimarySecret() (Secret, bool) {
+	s, ok := k.Get(k.Primary)
+	if !ok || s.Retired() {
+		return Secret{}, false
+	}
+	return s, true
+}
+
+// KeyringFile serves a keyring from disk, reloading it when the file changes
+// so secrets can be added and retired without restarting the services.
+type KeyringFile struct {
+	mu    sync.Mutex
+	watch fileWatch
+	ring  *Keyring
+}
+
+// OpenKeyringFile loads path. A missing file is treated as an empty keyring.
+func OpenKeyringFile(path string) (*KeyringFile, error) {
+	f := &KeyringFile{watch: fileWatch{path: path}, ring: &Keyring{}}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.reloadLocked(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Keyring returns the current keyring. Callers must not modify it.
+func (f *KeyringFile) Keyring() *Keyring {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.watch.due() {
+		// Keep serving the previous keyring if the file became unreadable.
+		_ = f.reloadLocked()
+	}
+	return f.ring
+}
+
+func (f *KeyringFile) reloadLocked() error {
+	changed, info, err := f.watch.check()
+	if err != nil {
+		return fmt.Errorf("failed to stat keyring: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+
+	ring, err := LoadKeyring(f.watch.path)
+	if err != nil {
+		return err
+	}
+	f.ring = ring
+	f.watch.record(info)
+	return nil
+}
@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestKeyring_Rotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+
+	ring, _ := LoadKeyring(path)
+	old, err := ring.Add("2026-01")
+	if err != nil {
+		t.Fatalf("Add failed: %v", err)
+	}
+	if err := ring.Save(path); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	file, err := OpenKeyringFile(path)
+	if err != nil {
+		t.Fatalf("Failed to open keyring: %v", err)
+	}
+	v := &Verifier{Keyring: file}
+
+	oldKey, _, _ := IssueScopedKey("client-a", old.Key, KeyOptions{Scopes: []string{ScopeIngest}, SecretID: old.ID})
+	legacyKey := IssueAPIKey("client-b", old.Key)
+	if id, err := v.Verify(oldKey); err != nil || id.SecretID != "2026-01" {
+		t.Fatalf("Expected key signed with 2026-01 to verify, got %+v (err %v)", id, err)
+	}
+
+	// Add a new secret: both generations of keys are accepted.
+	ring, _ = LoadKeyring(path)
+	next, _ := ring.Add("2026-07")
+	if ring.Primary != "2026-07" {
+		t.Errorf("Expected new secret to become primary, got %s", ring.Primary)
+	}
+	ring.Save(path)
+	file, _ = OpenKeyringFile(path)
+	v.Keyring = file
+
+	newKey, _, _ := IssueScopedKey("client-a", next.Key, KeyOptions{Scopes: []string{ScopeIngest}, SecretID: next.ID})
+	for _, key := range []string{oldKey, legacyKey, newKey} {
+		if _, err := v.Verify(key); err != nil {
+			t.Errorf("Expected key to verify during rotation, got %v", err)
+		}
+	}
+
+	// Retire the old one: only keys signed with the new secret remain valid.
+	ring, _ = LoadKeyring(path)
+	if err := ring.Retire("2026-01"); err != nil {
+		t.Fatalf("Retire failed: %v", err)
+	}
+	ring.Save(path)
+	file, _ = OpenKeyringFile(path)
+	v.Keyring = file
+
+	if _, err := v.Verify(oldKey); err != ErrInvalidKey {
+		t.Errorf("Expected key of retired secret to be rejected, got %v", err)
+	}
+	if _, err := v.Verify(legacyKey); err != ErrInvalidKey {
+		t.Errorf("Expected legacy key of retired secret to be rejected, got %v", err)
+	}
+	if _, err := v.Verify(newKey); err != nil {
+		t.Errorf("Expected key of active secret to verify, got %v", err)
+	}
+
+	// A key naming one secret cannot be verified with another.
+	forged, _, _ := IssueScopedKey("client-a", next.Key, KeyOptions{Scopes: []string{ScopeIngest}, SecretID: "2026-01"})
+	if _, err := v.Verify(forged); err != ErrInvalidKey {
+		t.Errorf("Expected mismatched secret id to be rejected, got %v", err)
+	}
+
+	if err := ring.Retire("2026-07"); err == nil {
+		t.Error("Expected error retiring the only active secret, got nil")
+	}
+}
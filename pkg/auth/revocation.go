@@ -0,0 +1,114 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RevocationList is a file of revoked key IDs, one per line. Anything after
+// the key ID and blank or # lines are ignored. The file is reloaded when it
+// changes, so revocations take effect without a restart.
+type RevocationList struct {
+	mu      sync.Mutex
+	watch   fileWatch
+	revoked map[string]struct{}
+}
+
+// NewRevocationList loads path. A missing file is treated as empty.
+func NewRevocationList(path string) (*RevocationList, error) {
+	l := &RevocationList{watch: fileWatch{path: path}, revoked: make(map[string]struct{})}
+	if err := l.reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// IsRevoked reports whether keyID has been revoked.
+func (l *RevocationList) IsRevoked(keyID string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.watch.due() {
+		// Keep serving the previous list if the file became unreadable.
+		_ = l.reloadLocked()
+	}
+	_, ok := l.revoked[keyID]
+	return ok
+}
+
+// Revoke appends keyID to the file.
+func (l *RevocationList) Revoke(keyID, comment string) error {
+	if keyID == "" || strings.ContainsAny(keyID, " \t\n#") {
+		return fmt.Errorf("invalid key id %q", keyID)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.watch.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open revocation list: %w", err)
+	}
+	line := keyID + " " + time.Now().UTC().Format(time.RFC3339)
+	if comment = strings.TrimSpace(strings.ReplaceAll(comment, "\n", " ")); comment != "" {
+		line += " " + comment
+	}
+	if _, err := fmt.Fprintln(f, line); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write revocation list: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write revocation list: %w", err)
+	}
+
+	l.revoked[keyID] = struct{}{}
+	return nil
+}
+
+func (l *RevocationList) reload() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.reloadLocked()
+}
+
+func (l *RevocationList) reloadLocked() error {
+	changed, info, err := l.watch.check()
+	if err != nil {
+		return fmt.Errorf("failed to stat revocation list: %w", err)
+	}
+	if !changed {
+		return nil
+	}
+	if info == nil {
+		l.revoked = make(map[string]struct{})
+		l.watch.record(nil)
+		return nil
+	}
+
+	f, err := os.Open(l.watch.path)
+	if err != nil {
+		return fmt.Errorf("failed to open revocation list: %w", err)
+	}
+	defer f.Close()
+
+	revoked := make(map[string]struct{})
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		revoked[fields[0]] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read revocation list: %w", err)
+	}
+
+	l.revoked = revoked
+	l.watch.record(info)
+	return nil
+}
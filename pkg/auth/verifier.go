@@ -0,0 +1,109 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+// Verifier checks API keys against the signing secrets, their expiry and an
+// optional revocation list.
+type Verifier struct {
+	// Secret verifies keys that do not name a keyring secret. Optional when a
+	// Keyring is set.
+	Secret []byte
+	// Keyring verifies keys signed with its active secrets.
+	Keyring     *KeyringFile
+	Revocations *RevocationList
+	// Now defaults to time.Now.
+	Now func() time.Time
+}
+
+// Verify returns the identity for apiKey, or ErrInvalidKey, ErrExpiredKey or
+// ErrRevokedKey.
+func (v *Verifier) Verify(apiKey string) (Identity, error) {
+	identity, err := parseAPIKey(apiKey, v.secretsFor)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	now := time.Now
+	if v.Now != nil {
+		now = v.Now
+	}
+	if !identity.ExpiresAt.IsZero() && !now().Before(identity.ExpiresAt) {
+		return Identity{}, ErrExpiredKey
+	}
+	if v.Revocations != nil && v.Revocations.IsRevoked(identity.KeyID) {
+		return Identity{}, ErrRevokedKey
+	}
+	return identity, nil
+}
+
+// secretsFor returns the secrets a key naming secretID may be signed with.
+// Keys that name no secret predate the keyring or were signed with Secret;
+// they are also checked against every active keyring secret so keys issued
+// before a rotation keep working until their secret is retired.
+func (v *Verifier) secretsFor(secretID string) [][]byte {
+	var ring *Keyring
+	if v.Keyring != nil {
+		ring = v.Keyring.Keyring()
+	}
+
+	if secretID != "" {
+		if ring == nil {
+			return nil
+		}
+		if s, ok := ring.Get(secretID); ok && !s.Retired() {
+			return [][]byte{s.Key}
+		}
+		return nil
+	}
+
+	var secrets [][]byte
+	if len(v.Secret) > 0 {
+		secrets = append(secrets, v.Secret)
+	}
+	if ring != nil {
+		for _, s := range ring.Secrets {
+			if !s.Retired() {
+				secrets = append(secrets, s.Key)
+			}
+		}
+	}
+	return secrets
+}
+
+// VerifierConfig names where a Verifier's secrets and revocations come from.
+type VerifierConfig struct {
+	Secret         string
+	KeyringFile    string
+	RevocationFile string
+}
+
+// NewVerifier opens the configured keyring and revocation list. At least one
+// of Secret and KeyringFile must be set.
+func NewVerifier(cfg VerifierConfig) (*Verifier, error) {
+	if cfg.Secret == "" && cfg.KeyringFile == "" {
+		return nil, errors.New("either a secret or a keyring file is required")
+	}
+
+	v := &Verifier{}
+	if cfg.Secret != "" {
+		v.Secret = []byte(cfg.Secret)
+	}
+	if cfg.KeyringFile != "" {
+		keyring, err := OpenKeyringFile(cfg.KeyringFile)
+		if err != nil {
+			return nil, err
+		}
+		v.Keyring = keyring
+	}
+	if cfg.RevocationFile != "" {
+		revocations, err := NewRevocationList(cfg.RevocationFile)
+		if err != nil {
+			return nil, err
+		}
+		v.Revocations = revocations
+	}
+	return v, nil
+}
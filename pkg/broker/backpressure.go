@@ -0,0 +1,101 @@
+package broker
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// BackpressureMode decides what Publish does when a subscriber's queue is full.
+type BackpressureMode int
+
+const (
+	// DropNewest discards the batch being published for that subscriber.
+	DropNewest BackpressureMode = iota
+	// DropOldest evicts the oldest queued batch to make room for the new one.
+	DropOldest
+	// Block waits up to the policy timeout for room, then fails the publish.
+	Block
+	// Reject fails the publish as soon as the queue is full.
+	Reject
+)
+
+const (
+	defaultBlockTimeout = 2 * time.Second
+	defaultRetryAfter   = time.Second
+)
+
+// BackpressurePolicy configures how a full subscriber queue is handled.
+type BackpressurePolicy struct {
+	Mode BackpressureMode
+	// Timeout bounds how long Block waits. Defaults to 2s.
+	Timeout time.Duration
+	// RetryAfter is the hint handed back to clients when a publish fails.
+	// Defaults to the block timeout, or 1s for Reject.
+	RetryAfter time.Duration
+}
+
+// ErrBackpressure is matched by errors returned when a publish fails because
+// a subscriber could not keep up.
+var ErrBackpressure = errors.New("subscriber queue is full")
+
+// BackpressureError reports which subscriber refused a publish and when the
+// client should try again. The batch was not delivered to any subscriber, so
+// it is safe to retry.
+type BackpressureError struct {
+	Subscriber string
+	RetryAfter time.Duration
+}
+
+func (e *BackpressureError) Error() string {
+	return fmt.Sprintf("subscriber %s queue is full", e.Subscriber)
+}
+
+func (e *BackpressureError) Is(target error) bool {
+	return target == ErrBackpressure
+}
+
+// ParseBackpressureMode parses drop-newest, drop-oldest, block or reject.
+func ParseBackpressureMode(s string) (BackpressureMode, error) {
+	switch s {
+	case "drop-newest", "":
+		return DropNewest, nil
+	case "drop-oldest":
+		return DropOldest, nil
+	case "block":
+		return Block, nil
+	case "reject":
+		return Reject, nil
+	}
+	return DropNewest, fmt.Errorf("unknown backpressure mode %q", s)
+}
+
+func (m BackpressureMode) String() string {
+	switch m {
+	case DropOldest:
+		return "drop-oldest"
+	case Block:
+		return "block"
+	case Reject:
+		return "reject"
+	default:
+		return "drop-newest"
+	}
+}
+
+func (p BackpressurePolicy) timeout() time.Duration {
+	if p.Timeout > 0 {
+		return p.Timeout
+	}
+	return defaultBlockTimeout
+}
+
+func (p BackpressurePolicy) retryAfter() time.Duration {
+	if p.RetryAfter > 0 {
+		return p.RetryAfter
+	}
+	if p.Mode == Block {
+		return p.timeout()
+	}
+	return defaultRetryAfter
+}
@@ -0,0 +1,159 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+func TestMemoryBroker_DropOldest(t *testing.T) {
+	b := NewMemoryBroker()
+	ctx := context.Background()
+
+	ch, _ := b.Subscribe(ctx, WithBufferSize(2), WithBackpressure(BackpressurePolicy{Mode: DropOldest}))
+
+	for _, msg := range []string{"one", "two", "three"} {
+		if err := b.Publish(ctx, []model.LogEntry{{Message: msg}}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	if got := (<-ch)[0].Message; got != "two" {
+		t.Errorf("Expected oldest batch to be evicted, got %s first", got)
+	}
+	if got := (<-ch)[0].Message; got != "three" {
+		t.Errorf("Expected 'three', got %s", got)
+	}
+	if _, dropped := b.Stats(); dropped != 1 {
+		t.Errorf("Expected 1 dropped, got %d", dropped)
+	}
+}
+
+func TestMemoryBroker_BlockTimeout(t *testing.T) {
+	b := NewMemoryBroker(WithDefaultBackpressure(BackpressurePolicy{Mode: Block, Timeout: 50 * time.Millisecond}))
+	ctx := context.Background()
+
+	ch, _ := b.Subscribe(ctx, WithName("slow"), WithBufferSize(1))
+	logs := []model.LogEntry{{Message: "msg"}}
+
+	if err := b.Publish(ctx, logs); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	// The queue is full, a consumer freeing a slot in time unblocks the publish.
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-ch
+	}()
+	if err := b.Publish(ctx, logs); err != nil {
+		t.Fatalf("Expected blocked publish to succeed, got %v", err)
+	}
+
+	// Nobody consumes now, so the publish times out.
+	err := b.Publish(ctx, logs)
+	var bpErr *BackpressureError
+	if !errors.As(err, &bpErr) || !errors.Is(err, ErrBackpressure) {
+		t.Fatalf("Expected backpressure error, got %v", err)
+	}
+	if bpErr.Subscriber != "slow" || bpErr.RetryAfter != 50*time.Millisecond {
+		t.Errorf("Unexpected backpressure error: %+v", bpErr)
+	}
+}
+
+func TestMemoryBroker_BlockIsAllOrNothing(t *testing.T) {
+	b := NewMemoryBroker(WithDefaultBackpressure(BackpressurePolicy{Mode: Block, Timeout: 50 * time.Millisecond}))
+	ctx := context.Background()
+
+	fast, _ := b.Subscribe(ctx, WithName("fast"), WithBufferSize(1))
+	b.Subscribe(ctx, WithName("slow"), WithBufferSize(1))
+	logs := []model.LogEntry{{Message: "msg"}}
+	if err := b.Publish(ctx, logs); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	<-fast
+
+	if err := b.Publish(ctx, logs); !errors.Is(err, ErrBackpressure) {
+		t.Fatalf("Expected backpressure error, got %v", err)
+	}
+	select {
+	case <-fast:
+		t.Error("Timed out batch was delivered to another subscriber")
+	default:
+	}
+
+	// A blocked publish does not hold up Close, and sees the broker closed.
+	done := make(chan error, 1)
+	go func() { done <- b.Publish(ctx, logs) }()
+	time.Sleep(10 * time.Millisecond)
+	b.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrClosed) {
+			t.Errorf("Expected ErrClosed, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Blocked publish did not return after Close")
+	}
+}
+
+func TestMemoryBroker_Reject(t *testing.T) {
+	b := NewMemoryBroker()
+	ctx := context.Background()
+
+	lossy, _ := b.Subscribe(ctx, WithName("lossy"), WithBufferSize(1))
+	b.Subscribe(ctx, WithName("strict"), WithBufferSize(1), WithBackpressure(BackpressurePolicy{Mode: Reject}))
+
+	logs := []model.LogEntry{{Message: "msg"}}
+	if err := b.Publish(ctx, logs); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+	<-lossy
+
+	if err := b.Publish(ctx, logs); !errors.Is(err, ErrBackpressure) {
+		t.Fatalf("Expected backpressure error, got %v", err)
+	}
+
+	// A rejected publish must not reach other subscribers either.
+	select {
+	case <-lossy:
+		t.Error("Rejected batch was delivered to another subscriber")
+	default:
+	}
+
+	stats := b.SubscriberStats()
+	if stats[1].Rejected != 1 {
+		t.Errorf("Expected 1 rejected entry for strict subscriber, got %d", stats[1].Rejected)
+	}
+	if ingested, _ := b.Stats(); ingested != 1 {
+		t.Errorf("Expected rejected batch not to count as ingested, got %d", ingested)
+	}
+}
+
+func TestMemoryBroker_BlockWakesOnReceive(t *testing.T) {
+	b := NewMemoryBroker(WithDefaultBackpressure(BackpressurePolicy{Mode: Block, Timeout: 5 * time.Second}))
+	ctx := context.Background()
+
+	ch, _ := b.Subscribe(ctx, WithBufferSize(1))
+	logs := []model.LogEntry{{Message: "msg"}}
+	if err := b.Publish(ctx, logs); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		<-ch
+	}()
+	start := time.Now()
+	if err := b.Publish(ctx, logs); err != nil {
+		t.Fatalf("Expected blocked publish to succeed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected publish to resume once a batch was received, took %v", elapsed)
+	}
+	if depth := b.SubscriberStats()[0].QueueDepth; depth != 1 {
+		t.Errorf("Expected queue depth 1, got %d", depth)
+	}
+}
@@ -2,10 +2,15 @@ package broker
 
 import (
 	"context"
+	"errors"
+	"time"
 
 	"github.com/predatorx7/logtopus/pkg/model"
 )
 
+// ErrClosed is returned when publishing to or subscribing on a closed broker.
+var ErrClosed = errors.New("broker closed")
+
 // Publisher defines the interface for publishing log entries.
 type Publisher interface {
 	Publish(ctx context.Context, logs []model.LogEntry) error
@@ -13,7 +18,7 @@ type Publisher interface {
 
 // Subscriber defines the interface for consuming log entries.
 type Subscriber interface {
-	Subscribe(ctx context.Context) (<-chan []model.LogEntry, error)
+	Subscribe(ctx context.Context, opts ...SubscribeOption) (<-chan []model.LogEntry, error)
 }
 
 // Broker combines Publisher and Subscriber interfaces.
@@ -21,4 +26,72 @@ type Broker interface {
 	Publisher
 	Subscriber
 	Stats() (uint64, uint64)
+	SubscriberStats() []SubscriberStats
+	// Close stops accepting publishes. Subscriber channels are closed once
+	// the subscriber has drained what the broker still owes it.
+	Close() error
+}
+
+// SubscriberStats reports delivery metrics for a single subscription.
+type SubscriberStats struct {
+	Name string `json:"name"`
+	// Policy is the backpressure mode applied to this subscription, empty for
+	// brokers that never apply backpressure.
+	Policy string `json:"policy,omitempty"`
+	// Delivered, Dropped and Rejected count log entries, not batches.
+	Delivered uint64 `json:"delivered"`
+	Dropped   uint64 `json:"dropped"`
+	// Rejected counts entries whose publish failed because this subscriber's
+	// queue stayed full under the block or reject policy.
+	Rejected uint64 `json:"rejected"`
+	// QueueDepth is the number of batches waiting to be consumed, i.e. how far
+	// the subscriber lags behind publishers.
+	QueueDepth int `json:"queue_depth"`
+	// QueueCapacity is the number of batches that fit in the queue before
+	// drops start. Zero means unbounded.
+	QueueCapacity int       `json:"queue_capacity,omitzero"`
+	LastDelivery  time.Time `json:"last_delivery,omitzero"`
+}
+
+// SubscribeOptions holds per-subscription settings.
+type SubscribeOptions struct {
+	// Name identifies the subscription. Durable brokers use it to persist
+	// and resume the subscriber's committed offset across restarts.
+	Name string
+	// Backpressure overrides the broker's default policy for this subscription.
+	Backpressure *BackpressurePolicy
+	// BufferSize overrides the number of batches queued for this subscription.
+	BufferSize int
+}
+
+// SubscribeOption configures a subscription.
+type SubscribeOption func(*SubscribeOptions)
+
+// WithName sets the subscription name.
+func WithName(name string) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.Name = name
+	}
+}
+
+// WithBackpressure sets the policy applied when this subscription's queue is full.
+func WithBackpressure(p BackpressurePolicy) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.Backpressure = &p
+	}
+}
+
+// WithBufferSize sets how many batches are queued for this subscription.
+func WithBufferSize(n int) SubscribeOption {
+	return func(o *SubscribeOptions) {
+		o.BufferSize = n
+	}
+}
+
+func applySubscribeOptions(opts []SubscribeOption) SubscribeOptions {
+	var o SubscribeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
 }
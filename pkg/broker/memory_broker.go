@@ -2,63 +2,339 @@ package broker
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/predatorx7/logtopus/pkg/model"
 )
 
+const defaultBufferSize = 2000
+
 // MemoryBroker implements a simple in-memory pub/sub using channels.
 type MemoryBroker struct {
-	subscribers                 []chan []model.LogEntry
+	subscribers                 []*memorySubscription
+	policy                      BackpressurePolicy
+	closed                      bool
 	mu                          sync.RWMutex
 	ingestedCount, droppedCount atomic.Uint64
 }
 
-// NewMemoryBroker creates a new instance of MemoryBroker.
-func NewMemoryBroker() *MemoryBroker {
-	return &MemoryBroker{
-		subscribers: make([]chan []model.LogEntry, 0),
+// memorySubscription queues batches for one subscriber. A forwarding
+// goroutine hands them over on an unbuffered channel, so a batch stays queued
+// until it is received and the broker learns when space is freed.
+type memorySubscription struct {
+	name                         string
+	out                          chan []model.LogEntry
+	size                         int
+	policy                       BackpressurePolicy
+	delivered, dropped, rejected atomic.Uint64
+	lastDelivery                 atomic.Int64 // unix nanoseconds
+
+	mu      sync.Mutex
+	queue   [][]model.LogEntry
+	closed  bool
+	ready   chan struct{} // signalled when a batch is queued or the queue closes
+	freed   chan struct{} // closed and replaced when a batch is received
+	evicted chan struct{} // closed and replaced when the oldest batch is dropped
+}
+
+// MemoryOption configures a MemoryBroker.
+type MemoryOption func(*MemoryBroker)
+
+// WithDefaultBackpressure sets the policy used by subscriptions that do not
+// specify their own. The default is DropNewest.
+func WithDefaultBackpressure(p BackpressurePolicy) MemoryOption {
+	return func(b *MemoryBroker) {
+		b.policy = p
 	}
 }
 
-// Publish sends logs to all registered subscribers non-blocking.
-func (b *MemoryBroker) Publish(ctx context.Context, logs []model.LogEntry) error {
-	if ctx.Err() != nil {
-		return ctx.Err()
+// NewMemoryBroker creates a new instance of MemoryBroker.
+func NewMemoryBroker(opts ...MemoryOption) *MemoryBroker {
+	b := &MemoryBroker{
+		subscribers: make([]*memorySubscription, 0),
+	}
+	for _, opt := range opts {
+		opt(b)
 	}
+	return b
+}
 
-	b.ingestedCount.Add(uint64(len(logs)))
+// Publish sends logs to all registered subscribers, applying each
+// subscriber's backpressure policy when its queue is full. A batch is
+// delivered to every subscriber or, when it is refused, to none: a publish
+// waits for room in every blocking queue before delivering, without holding
+// the lock, and publishes are delivered one at a time so the room cannot be
+// taken in between.
+func (b *MemoryBroker) Publish(ctx context.Context, logs []model.LogEntry) error {
+	var waitStart time.Time
+	for {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 
-	b.mu.RLock()
-	defer b.mu.RUnlock()
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return ErrClosed
+		}
+		full, freed, err := b.checkRoom(logs)
+		if err != nil {
+			b.mu.Unlock()
+			return err
+		}
+		if full == nil {
+			b.ingestedCount.Add(uint64(len(logs)))
+			for _, sub := range b.subscribers {
+				b.deliver(sub, logs)
+			}
+			b.mu.Unlock()
+			return nil
+		}
+		b.mu.Unlock()
 
-	for _, sub := range b.subscribers {
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+		}
+		remaining := full.policy.timeout() - time.Since(waitStart)
+		if remaining <= 0 {
+			return full.reject(logs)
+		}
+		timer := time.NewTimer(remaining)
 		select {
 		case <-ctx.Done():
+			timer.Stop()
 			return ctx.Err()
-		case sub <- logs:
-			// stats could be tracked per subscriber, but globally we consider it "delivered"
-		default:
+		case <-freed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// checkRoom refuses the batch when a rejecting subscriber is full, so no one
+// receives a batch the client is going to resend, and returns a full blocking
+// subscriber to wait for along with the channel closed when it frees space.
+// It must be called with the lock held.
+func (b *MemoryBroker) checkRoom(logs []model.LogEntry) (*memorySubscription, <-chan struct{}, error) {
+	for _, sub := range b.subscribers {
+		if sub.policy.Mode != Reject {
+			continue
+		}
+		if full, _ := sub.full(); full {
+			return nil, nil, sub.reject(logs)
+		}
+	}
+	for _, sub := range b.subscribers {
+		if sub.policy.Mode != Block {
+			continue
+		}
+		if full, freed := sub.full(); full {
+			return sub, freed, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+// deliver queues logs for one subscriber. Blocking and rejecting subscribers
+// have room, checked by checkRoom, so only the drop policies apply here.
+func (b *MemoryBroker) deliver(sub *memorySubscription, logs []model.LogEntry) {
+	sub.mu.Lock()
+	defer sub.mu.Unlock()
+
+	if len(sub.queue) >= sub.size {
+		if sub.policy.Mode != DropOldest {
 			// Buffer full, drop message for this subscriber to prevent backpressure
+			sub.dropped.Add(uint64(len(logs)))
 			b.droppedCount.Add(uint64(len(logs)))
+			return
 		}
+		old := sub.queue[0]
+		sub.pop()
+		close(sub.evicted)
+		sub.evicted = make(chan struct{})
+		sub.dropped.Add(uint64(len(old)))
+		b.droppedCount.Add(uint64(len(old)))
+	}
+
+	sub.queue = append(sub.queue, logs)
+	sub.signalReady()
+	sub.markDelivered(logs)
+}
+
+// forward hands queued batches to the subscriber in order, signalling freed
+// after each one is received, and closes the channel once the queue is
+// closed and drained. A batch being handed over stays at the head of the
+// queue, so DropOldest can still evict it.
+func (s *memorySubscription) forward() {
+	defer close(s.out)
+	for {
+		s.mu.Lock()
+		for len(s.queue) == 0 {
+			if s.closed {
+				s.mu.Unlock()
+				return
+			}
+			s.mu.Unlock()
+			<-s.ready
+			s.mu.Lock()
+		}
+		batch, evicted := s.queue[0], s.evicted
+		s.mu.Unlock()
+
+		select {
+		case s.out <- batch:
+			s.mu.Lock()
+			if s.evicted == evicted {
+				s.pop()
+			}
+			s.signalFreed()
+			s.mu.Unlock()
+		case <-evicted:
+		}
+	}
+}
+
+// full reports whether the queue has no room, and returns the channel that is
+// closed when space is freed.
+func (s *memorySubscription) full() (bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue) >= s.size, s.freed
+}
+
+func (s *memorySubscription) depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+// pop removes the head of the queue. It must be called with s.mu held.
+func (s *memorySubscription) pop() {
+	s.queue[0] = nil
+	s.queue = s.queue[1:]
+}
+
+func (s *memorySubscription) signalReady() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *memorySubscription) signalFreed() {
+	close(s.freed)
+	s.freed = make(chan struct{})
+}
+
+// close stops the queue. Queued batches are still forwarded, and blocked
+// publishes are woken so they can see the broker closed.
+func (s *memorySubscription) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	s.signalReady()
+	s.signalFreed()
+}
+
+func (s *memorySubscription) markDelivered(logs []model.LogEntry) {
+	s.delivered.Add(uint64(len(logs)))
+	s.lastDelivery.Store(time.Now().UnixNano())
+}
+
+func (s *memorySubscription) reject(logs []model.LogEntry) error {
+	s.rejected.Add(uint64(len(logs)))
+	return &BackpressureError{
+		Subscriber: s.name,
+		RetryAfter: s.policy.retryAfter(),
 	}
-	return nil
 }
 
 // Subscribe returns a channel that receives log batches.
-func (b *MemoryBroker) Subscribe(ctx context.Context) (<-chan []model.LogEntry, error) {
+func (b *MemoryBroker) Subscribe(ctx context.Context, opts ...SubscribeOption) (<-chan []model.LogEntry, error) {
+	o := applySubscribeOptions(opts)
+
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	name := o.Name
+	if name == "" {
+		name = fmt.Sprintf("subscriber-%d", len(b.subscribers))
+	}
+
 	// Increase buffer size to handle bursts
-	ch := make(chan []model.LogEntry, 2000)
-	b.subscribers = append(b.subscribers, ch)
-	return ch, nil
+	size := o.BufferSize
+	if size <= 0 {
+		size = defaultBufferSize
+	}
+
+	policy := b.policy
+	if o.Backpressure != nil {
+		policy = *o.Backpressure
+	}
+
+	sub := &memorySubscription{
+		name:    name,
+		out:     make(chan []model.LogEntry),
+		size:    size,
+		policy:  policy,
+		ready:   make(chan struct{}, 1),
+		freed:   make(chan struct{}),
+		evicted: make(chan struct{}),
+	}
+	b.subscribers = append(b.subscribers, sub)
+	go sub.forward()
+	return sub.out, nil
+}
+
+// Close stops accepting publishes and closes every subscriber channel.
+// Batches already queued are still delivered, letting subscribers drain
+// before they see the channel close.
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	for _, sub := range b.subscribers {
+		sub.close()
+	}
+	return nil
 }
 
 // Stats returns the current metrics
 func (b *MemoryBroker) Stats() (ingested, dropped uint64) {
 	return b.ingestedCount.Load(), b.droppedCount.Load()
 }
+
+// SubscriberStats returns delivery metrics for each subscription.
+func (b *MemoryBroker) SubscriberStats() []SubscriberStats {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	stats := make([]SubscriberStats, 0, len(b.subscribers))
+	for _, sub := range b.subscribers {
+		s := SubscriberStats{
+			Name:          sub.name,
+			Policy:        sub.policy.Mode.String(),
+			Delivered:     sub.delivered.Load(),
+			Dropped:       sub.dropped.Load(),
+			Rejected:      sub.rejected.Load(),
+			QueueDepth:    sub.depth(),
+			QueueCapacity: sub.size,
+		}
+		if ts := sub.lastDelivery.Load(); ts != 0 {
+			s.LastDelivery = time.Unix(0, ts)
+		}
+		stats = append(stats, s)
+	}
+	return stats
+}
@@ -76,3 +76,31 @@ func TestMemoryBroker_ContextCancel(t *testing.T) {
 	default:
 	}
 }
+
+func TestMemoryBroker_CloseDrains(t *testing.T) {
+	b := NewMemoryBroker()
+	ctx := context.Background()
+
+	subCh, _ := b.Subscribe(ctx)
+	for i := 0; i < 3; i++ {
+		if err := b.Publish(ctx, []model.LogEntry{{Message: "msg"}}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := b.Publish(ctx, []model.LogEntry{{Message: "late"}}); err != ErrClosed {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+
+	// Queued batches are still delivered before the channel closes.
+	received := 0
+	for range subCh {
+		received++
+	}
+	if received != 3 {
+		t.Errorf("Expected 3 queued batches to drain, got %d", received)
+	}
+}
@@ -3,6 +3,7 @@ package broker
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/predatorx7/logtopus/pkg/model"
 )
@@ -30,3 +31,52 @@ func TestMemoryBroker_Metrics(t *testing.T) {
 		t.Errorf("Expected 0 dropped, got %d", dropped)
 	}
 }
+
+func TestMemoryBroker_SubscriberStats(t *testing.T) {
+	b := NewMemoryBroker()
+	ctx := context.Background()
+
+	const size = 10
+	fast, _ := b.Subscribe(ctx, WithName("fast"), WithBufferSize(size))
+	b.Subscribe(ctx, WithName("slow"), WithBufferSize(size))
+
+	logs := []model.LogEntry{{Message: "msg"}, {Message: "msg"}}
+
+	// Keep "fast" drained while "slow" fills up its buffer and starts dropping.
+	for i := 0; i < size+1; i++ {
+		if err := b.Publish(ctx, logs); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+		<-fast
+	}
+
+	// A received batch leaves the queue just after the receive completes.
+	deadline := time.Now().Add(time.Second)
+	for b.SubscriberStats()[0].QueueDepth != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	stats := b.SubscriberStats()
+	if len(stats) != 2 {
+		t.Fatalf("Expected 2 subscriber stats, got %d", len(stats))
+	}
+
+	if stats[0].Name != "fast" || stats[0].Dropped != 0 || stats[0].QueueDepth != 0 {
+		t.Errorf("Unexpected stats for fast subscriber: %+v", stats[0])
+	}
+	if stats[0].Delivered != 2*(size+1) {
+		t.Errorf("Expected %d delivered to fast subscriber, got %d", 2*(size+1), stats[0].Delivered)
+	}
+	if stats[0].LastDelivery.IsZero() {
+		t.Error("Expected last delivery time to be set")
+	}
+
+	if stats[1].Name != "slow" || stats[1].Dropped != 2 || stats[1].QueueDepth != stats[1].QueueCapacity {
+		t.Errorf("Unexpected stats for slow subscriber: %+v", stats[1])
+	}
+
+	_, dropped := b.Stats()
+	if dropped != 2 {
+		t.Errorf("Expected 2 dropped globally, got %d", dropped)
+	}
+}
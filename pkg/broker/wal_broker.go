@@ -0,0 +1,645 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+const (
+	defaultSegmentBytes = 64 << 20
+	walSegmentExt       = ".wal"
+	walOffsetExt        = ".offset"
+	walHeaderSize       = 8 // uint32 payload length + uint32 CRC32 of payload
+	maxWALRecordBytes   = 1 << 30
+)
+
+var validSubscriberName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// WALOptions configures a WALBroker.
+type WALOptions struct {
+	// Dir holds the log segments and the committed offset of each subscriber.
+	Dir string
+	// SegmentBytes is the size after which the active segment is rolled.
+	// Defaults to 64MB.
+	SegmentBytes int64
+	// NoSync skips the fsync after each publish. Publishing gets faster, but
+	// batches acknowledged right before a power loss may be lost.
+	NoSync bool
+}
+
+// WALBroker implements a disk-backed Broker using a segmented, append-only log.
+// Publish returns only after the batch has been written (and fsynced), and every
+// named subscriber resumes from its last committed offset after a restart.
+//
+// Delivery is at-least-once: a batch is committed once the subscriber comes back
+// for the next one, so a batch that was being processed during a crash is
+// delivered again. Segments are kept until every subscriber with an offset
+// file has committed past them; delete the offset file of a subscriber that
+// is gone for good to release them.
+type WALBroker struct {
+	opts WALOptions
+
+	mu         sync.Mutex
+	segments   []uint64 // base offsets in ascending order, the last one is active
+	active     *os.File
+	activeSize int64
+	next       uint64        // offset assigned to the next published batch
+	notify     chan struct{} // closed and replaced on every publish
+	subs       map[string]*walSubscription
+	// offsets holds the committed offset of every named subscriber seen,
+	// connected or not, so segments are only removed once all have read them.
+	offsets map[string]uint64
+	// unnamed numbers the default names of subscribers without one.
+	unnamed int
+	closed  bool
+
+	done chan struct{}
+
+	ingestedCount, droppedCount atomic.Uint64
+}
+
+type walSubscription struct {
+	name         string
+	ch           chan []model.LogEntry
+	committed    atomic.Uint64
+	delivered    atomic.Uint64
+	lastDelivery atomic.Int64 // unix nanoseconds
+}
+
+// NewWALBroker opens (or creates) the log in opts.Dir, truncating any
+// partially written record left behind by a crash.
+func NewWALBroker(opts WALOptions) (*WALBroker, error) {
+	if opts.Dir == "" {
+		return nil, errors.New("wal dir is required")
+	}
+	if opts.SegmentBytes <= 0 {
+		opts.SegmentBytes = defaultSegmentBytes
+	}
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create wal dir: %w", err)
+	}
+
+	segments, err := listSegments(opts.Dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		segments = []uint64{0}
+	}
+
+	b := &WALBroker{
+		opts:     opts,
+		segments: segments,
+		notify:   make(chan struct{}),
+		subs:     make(map[string]*walSubscription),
+		done:     make(chan struct{}),
+	}
+	if b.offsets, err = b.loadOffsets(); err != nil {
+		return nil, err
+	}
+
+	base := segments[len(segments)-1]
+	count, size, err := recoverSegment(b.segmentPath(base))
+	if err != nil {
+		return nil, fmt.Errorf("failed to recover segment %d: %w", base, err)
+	}
+
+	f, err := os.OpenFile(b.segmentPath(base), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open active segment: %w", err)
+	}
+	b.active = f
+	b.activeSize = size
+	b.next = base + count
+
+	return b, nil
+}
+
+// Publish appends the batch to the log. Once it returns nil the batch is durable.
+func (b *WALBroker) Publish(ctx context.Context, logs []model.LogEntry) error {
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	payload, err := json.Marshal(logs)
+	if err != nil {
+		return fmt.Errorf("failed to encode batch: %w", err)
+	}
+
+	record := make([]byte, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[walHeaderSize:], payload)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrClosed
+	}
+
+	if b.activeSize >= b.opts.SegmentBytes {
+		if err := b.rotate(); err != nil {
+			return err
+		}
+	}
+
+	if _, err := b.active.Write(record); err != nil {
+		// Drop the partial record so the segment stays readable.
+		_ = b.active.Truncate(b.activeSize)
+		return fmt.Errorf("failed to append batch: %w", err)
+	}
+	if !b.opts.NoSync {
+		if err := b.active.Sync(); err != nil {
+			_ = b.active.Truncate(b.activeSize)
+			return fmt.Errorf("failed to sync segment: %w", err)
+		}
+	}
+
+	b.activeSize += int64(len(record))
+	b.next++
+	b.ingestedCount.Add(uint64(len(logs)))
+
+	close(b.notify)
+	b.notify = make(chan struct{})
+	return nil
+}
+
+// Subscribe starts delivering batches from the subscriber's last committed
+// offset, or from the oldest retained segment for a new subscriber. Slow
+// subscribers simply fall behind on disk, so backpressure and buffer size
+// options are ignored.
+func (b *WALBroker) Subscribe(ctx context.Context, opts ...SubscribeOption) (<-chan []model.LogEntry, error) {
+	o := applySubscribeOptions(opts)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, ErrClosed
+	}
+
+	name := o.Name
+	for name == "" {
+		name = fmt.Sprintf("subscriber-%d", b.unnamed)
+		b.unnamed++
+		if _, exists := b.subs[name]; exists {
+			name = ""
+		}
+	}
+	if !validSubscriberName.MatchString(name) {
+		return nil, fmt.Errorf("invalid subscriber name %q", name)
+	}
+	if _, exists := b.subs[name]; exists {
+		return nil, fmt.Errorf("subscriber %q is already active", name)
+	}
+
+	committed, err := b.loadOffset(name)
+	if err != nil {
+		return nil, err
+	}
+	// Clamp to what is still on disk.
+	if committed < b.segments[0] {
+		committed = b.segments[0]
+	}
+	if committed > b.next {
+		committed = b.next
+	}
+
+	sub := &walSubscription{
+		name: name,
+		ch:   make(chan []model.LogEntry),
+	}
+	sub.committed.Store(committed)
+	b.subs[name] = sub
+	b.offsets[name] = committed
+
+	go b.deliver(ctx, sub)
+
+	return sub.ch, nil
+}
+
+// Stats returns the current metrics
+func (b *WALBroker) Stats() (ingested, dropped uint64) {
+	return b.ingestedCount.Load(), b.droppedCount.Load()
+}
+
+// SubscriberStats returns delivery metrics for each active subscription.
+// QueueDepth counts batches published but not yet committed by the subscriber.
+func (b *WALBroker) SubscriberStats() []SubscriberStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := make([]SubscriberStats, 0, len(b.subs))
+	for _, sub := range b.subs {
+		s := SubscriberStats{
+			Name:       sub.name,
+			Delivered:  sub.delivered.Load(),
+			QueueDepth: int(b.next - sub.committed.Load()),
+		}
+		if ts := sub.lastDelivery.Load(); ts != 0 {
+			s.LastDelivery = time.Unix(0, ts)
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+	return stats
+}
+
+// Close stops accepting publishes and closes the active segment. Unconsumed
+// batches stay on disk for the next start, so subscriber channels are closed
+// as soon as each subscriber has finished the batch it is holding.
+func (b *WALBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+
+	if err := b.active.Sync(); err != nil {
+		b.active.Close()
+		return err
+	}
+	return b.active.Close()
+}
+
+// deliver streams records to a single subscriber. Channel sends are unbuffered,
+// so a successful send means the subscriber has finished with the previous
+// batch, which is then committed. When the subscriber catches up, an empty
+// batch is sent to commit the last one without waiting for new data.
+func (b *WALBroker) deliver(ctx context.Context, sub *walSubscription) {
+	defer close(sub.ch)
+	defer func() {
+		b.mu.Lock()
+		delete(b.subs, sub.name)
+		b.mu.Unlock()
+	}()
+
+	r := &walReader{b: b, offset: sub.committed.Load()}
+	defer r.close()
+
+	pending := false
+	var pendingEnd uint64
+
+	// After Close, wait for the subscriber to finish the batch it holds so it
+	// is committed instead of being redelivered on the next start.
+	defer func() {
+		if !pending || ctx.Err() != nil {
+			return
+		}
+		select {
+		case sub.ch <- nil:
+			b.commit(sub, pendingEnd)
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		published, wait := b.position()
+
+		if r.offset < published {
+			batch, err := r.next()
+			if err != nil {
+				log.Printf("WAL: subscriber %s failed to read offset %d: %v", sub.name, r.offset, err)
+				r.close()
+				select {
+				case <-time.After(time.Second):
+					continue
+				case <-ctx.Done():
+					return
+				case <-b.done:
+					return
+				}
+			}
+
+			select {
+			case sub.ch <- batch:
+				sub.delivered.Add(uint64(len(batch)))
+				sub.lastDelivery.Store(time.Now().UnixNano())
+				if pending {
+					b.commit(sub, pendingEnd)
+				}
+				pending, pendingEnd = true, r.offset
+			case <-ctx.Done():
+				return
+			case <-b.done:
+				return
+			}
+			continue
+		}
+
+		if pending {
+			select {
+			case sub.ch <- nil:
+				b.commit(sub, pendingEnd)
+				pending = false
+			case <-ctx.Done():
+				return
+			case <-b.done:
+				return
+			}
+			continue
+		}
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *WALBroker) position() (uint64, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.next, b.notify
+}
+
+// commit persists the subscriber's offset and removes segments that every
+// known subscriber, connected or not, has moved past.
+func (b *WALBroker) commit(sub *walSubscription, offset uint64) {
+	sub.committed.Store(offset)
+
+	if err := b.storeOffset(sub.name, offset); err != nil {
+		log.Printf("WAL: failed to store offset for subscriber %s: %v", sub.name, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.offsets[sub.name] = offset
+	min := b.next
+	for _, c := range b.offsets {
+		if c < min {
+			min = c
+		}
+	}
+
+	// Never remove the active segment.
+	for len(b.segments) > 1 && b.segments[1] <= min {
+		if err := os.Remove(b.segmentPath(b.segments[0])); err != nil && !os.IsNotExist(err) {
+			log.Printf("WAL: failed to remove segment %d: %v", b.segments[0], err)
+			return
+		}
+		b.segments = b.segments[1:]
+	}
+}
+
+// rotate closes the active segment and starts a new one. Callers hold b.mu.
+func (b *WALBroker) rotate() error {
+	if err := b.active.Sync(); err != nil {
+		return fmt.Errorf("failed to sync segment: %w", err)
+	}
+	if err := b.active.Close(); err != nil {
+		return fmt.Errorf("failed to close segment: %w", err)
+	}
+
+	f, err := os.OpenFile(b.segmentPath(b.next), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create segment: %w", err)
+	}
+	b.active = f
+	b.activeSize = 0
+	b.segments = append(b.segments, b.next)
+	return nil
+}
+
+// segmentFor returns the base offset of the segment holding offset.
+func (b *WALBroker) segmentFor(offset uint64) uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	i := sort.Search(len(b.segments), func(i int) bool { return b.segments[i] > offset })
+	if i == 0 {
+		return b.segments[0]
+	}
+	return b.segments[i-1]
+}
+
+func (b *WALBroker) segmentPath(base uint64) string {
+	return filepath.Join(b.opts.Dir, fmt.Sprintf("%020d%s", base, walSegmentExt))
+}
+
+func (b *WALBroker) offsetPath(name string) string {
+	return filepath.Join(b.opts.Dir, name+walOffsetExt)
+}
+
+func (b *WALBroker) loadOffset(name string) (uint64, error) {
+	data, err := os.ReadFile(b.offsetPath(name))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read offset for %s: %w", name, err)
+	}
+	offset, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("corrupt offset file for %s: %w", name, err)
+	}
+	return offset, nil
+}
+
+// loadOffsets reads the committed offset of every subscriber with an offset
+// file in the log directory.
+func (b *WALBroker) loadOffsets() (map[string]uint64, error) {
+	entries, err := os.ReadDir(b.opts.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wal dir: %w", err)
+	}
+	offsets := make(map[string]uint64)
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), walOffsetExt)
+		if entry.IsDir() || !ok || !validSubscriberName.MatchString(name) {
+			continue
+		}
+		offset, err := b.loadOffset(name)
+		if err != nil {
+			return nil, err
+		}
+		offsets[name] = offset
+	}
+	return offsets, nil
+}
+
+func (b *WALBroker) storeOffset(name string, offset uint64) error {
+	path := b.offsetPath(name)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(strconv.FormatUint(offset, 10)), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func listSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wal dir: %w", err)
+	}
+
+	var segments []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, walSegmentExt) {
+			continue
+		}
+		base, err := strconv.ParseUint(strings.TrimSuffix(name, walSegmentExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		segments = append(segments, base)
+	}
+	sort.Slice(segments, func(i, j int) bool { return segments[i] < segments[j] })
+	return segments, nil
+}
+
+// recoverSegment counts the valid records in a segment and truncates anything
+// after the last one, such as a record torn by a crash mid-write.
+func recoverSegment(path string) (count uint64, size int64, err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReader(f)
+	for {
+		n, err := skipRecord(br, true)
+		if err != nil {
+			break
+		}
+		count++
+		size += n
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if info.Size() != size {
+		log.Printf("WAL: truncating %s from %d to %d bytes", path, info.Size(), size)
+		if err := f.Truncate(size); err != nil {
+			return 0, 0, err
+		}
+	}
+	return count, size, nil
+}
+
+// readRecord reads one record and verifies its checksum.
+func readRecord(br *bufio.Reader) ([]byte, error) {
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(header[0:4])
+	if n > maxWALRecordBytes {
+		return nil, errors.New("record too large")
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(br, payload); err != nil {
+		return nil, err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errors.New("checksum mismatch")
+	}
+	return payload, nil
+}
+
+// skipRecord advances past one record, returning its size on disk.
+func skipRecord(br *bufio.Reader, verify bool) (int64, error) {
+	if verify {
+		payload, err := readRecord(br)
+		if err != nil {
+			return 0, err
+		}
+		return int64(walHeaderSize + len(payload)), nil
+	}
+
+	var header [walHeaderSize]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return 0, err
+	}
+	n := int(binary.BigEndian.Uint32(header[0:4]))
+	if _, err := br.Discard(n); err != nil {
+		return 0, err
+	}
+	return int64(walHeaderSize + n), nil
+}
+
+// walReader reads records sequentially for one subscriber, reopening the
+// right segment whenever the offset crosses a segment boundary.
+type walReader struct {
+	b      *WALBroker
+	f      *os.File
+	br     *bufio.Reader
+	base   uint64 // base offset of the open segment
+	offset uint64 // next offset to read
+}
+
+func (r *walReader) next() ([]model.LogEntry, error) {
+	if base := r.b.segmentFor(r.offset); r.f == nil || base != r.base {
+		if err := r.open(base); err != nil {
+			return nil, err
+		}
+	}
+
+	payload, err := readRecord(r.br)
+	if err != nil {
+		return nil, err
+	}
+
+	var batch []model.LogEntry
+	if err := json.Unmarshal(payload, &batch); err != nil {
+		// The record is intact but undecodable, skip it rather than stall.
+		log.Printf("WAL: skipping undecodable record at offset %d: %v", r.offset, err)
+	}
+	r.offset++
+	return batch, nil
+}
+
+func (r *walReader) open(base uint64) error {
+	r.close()
+
+	f, err := os.Open(r.b.segmentPath(base))
+	if err != nil {
+		return err
+	}
+	br := bufio.NewReaderSize(f, 256*1024)
+	for i := base; i < r.offset; i++ {
+		if _, err := skipRecord(br, false); err != nil {
+			f.Close()
+			return fmt.Errorf("failed to seek to offset %d: %w", r.offset, err)
+		}
+	}
+
+	r.f, r.br, r.base = f, br, base
+	return nil
+}
+
+func (r *walReader) close() {
+	if r.f != nil {
+		r.f.Close()
+		r.f, r.br = nil, nil
+	}
+}
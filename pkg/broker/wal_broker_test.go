@@ -0,0 +1,298 @@
+package broker
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+// receive returns the next non-empty batch from ch.
+func receive(t *testing.T, ch <-chan []model.LogEntry) []model.LogEntry {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case batch := <-ch:
+			if len(batch) == 0 {
+				continue // commit marker
+			}
+			return batch
+		case <-timeout:
+			t.Fatal("Timeout waiting for logs")
+		}
+	}
+}
+
+func TestWALBroker_PublishSubscribe(t *testing.T) {
+	b, err := NewWALBroker(WALOptions{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to open wal: %v", err)
+	}
+	defer b.Close()
+
+	ctx := context.Background()
+	ch, err := b.Subscribe(ctx, WithName("test"))
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+
+	logs := []model.LogEntry{
+		{Message: "test log 1", Level: model.LogLevelInfo},
+		{Message: "test log 2", Level: model.LogLevelSevere},
+	}
+	if err := b.Publish(ctx, logs); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	received := receive(t, ch)
+	if len(received) != 2 {
+		t.Errorf("Expected 2 logs, got %d", len(received))
+	}
+	if received[0].Message != "test log 1" {
+		t.Errorf("Unexpected log message: %s", received[0].Message)
+	}
+
+	ingested, dropped := b.Stats()
+	if ingested != 2 || dropped != 0 {
+		t.Errorf("Expected 2 ingested and 0 dropped, got %d and %d", ingested, dropped)
+	}
+
+	if _, err := b.Subscribe(ctx, WithName("test")); err == nil {
+		t.Error("Expected error on duplicate subscriber name, got nil")
+	}
+}
+
+func TestWALBroker_DefaultNamesStayUnique(t *testing.T) {
+	b, err := NewWALBroker(WALOptions{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Failed to open wal: %v", err)
+	}
+	defer b.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first, err := b.Subscribe(ctx)
+	if err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	if _, err := b.Subscribe(context.Background()); err != nil {
+		t.Fatalf("Failed to subscribe: %v", err)
+	}
+	cancel()
+	for range first {
+	}
+
+	// One subscriber is left, but its name is not handed out again.
+	if _, err := b.Subscribe(context.Background()); err != nil {
+		t.Errorf("Expected a fresh default name, got %v", err)
+	}
+}
+
+func TestWALBroker_ResumeFromCommittedOffset(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	b, err := NewWALBroker(WALOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("Failed to open wal: %v", err)
+	}
+	for _, msg := range []string{"one", "two", "three"} {
+		if err := b.Publish(ctx, []model.LogEntry{{Message: msg}}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	subCtx, cancel := context.WithCancel(ctx)
+	ch, _ := b.Subscribe(subCtx, WithName("resume"))
+	if got := receive(t, ch)[0].Message; got != "one" {
+		t.Fatalf("Expected 'one', got %s", got)
+	}
+	// Receiving "two" commits "one".
+	if got := receive(t, ch)[0].Message; got != "two" {
+		t.Fatalf("Expected 'two', got %s", got)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for b.SubscriberStats()[0].QueueDepth != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Simulate a crash while "two" is being processed.
+	cancel()
+	for range ch {
+	}
+	b.Close()
+
+	// "two" was never committed, so it is delivered again.
+	b, err = NewWALBroker(WALOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("Failed to reopen wal: %v", err)
+	}
+	defer b.Close()
+
+	ch, _ = b.Subscribe(ctx, WithName("resume"))
+	if got := receive(t, ch)[0].Message; got != "two" {
+		t.Errorf("Expected redelivery of 'two', got %s", got)
+	}
+	if got := receive(t, ch)[0].Message; got != "three" {
+		t.Errorf("Expected 'three', got %s", got)
+	}
+}
+
+func TestWALBroker_SegmentsAndRecovery(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	b, err := NewWALBroker(WALOptions{Dir: dir, SegmentBytes: 1})
+	if err != nil {
+		t.Fatalf("Failed to open wal: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := b.Publish(ctx, []model.LogEntry{{Message: "msg", Sequence: uint64(i)}}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+	b.Close()
+
+	segments, _ := listSegments(dir)
+	if len(segments) != 3 {
+		t.Fatalf("Expected 3 segments, got %d", len(segments))
+	}
+
+	// Simulate a crash in the middle of writing a record.
+	last := filepath.Join(dir, "00000000000000000002.wal")
+	f, _ := os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{0, 0, 1, 0, 1, 2})
+	f.Close()
+
+	b, err = NewWALBroker(WALOptions{Dir: dir, SegmentBytes: 1})
+	if err != nil {
+		t.Fatalf("Failed to reopen wal: %v", err)
+	}
+	defer b.Close()
+
+	ch, _ := b.Subscribe(ctx, WithName("reader"))
+	for i := 0; i < 3; i++ {
+		batch := receive(t, ch)
+		if batch[0].Sequence != uint64(i) {
+			t.Errorf("Expected sequence %d, got %d", i, batch[0].Sequence)
+		}
+	}
+
+	// Once everything is committed, fully consumed segments are removed.
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if segments, _ = listSegments(dir); len(segments) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if len(segments) != 1 {
+		t.Errorf("Expected consumed segments to be removed, %d remain", len(segments))
+	}
+}
+
+func TestWALBroker_KeepsSegmentsOfDisconnectedSubscribers(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	b, err := NewWALBroker(WALOptions{Dir: dir, SegmentBytes: 1})
+	if err != nil {
+		t.Fatalf("Failed to open wal: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := b.Publish(ctx, []model.LogEntry{{Message: "msg", Sequence: uint64(i)}}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	// "slow" commits the first batch and disconnects.
+	slowCtx, cancel := context.WithCancel(ctx)
+	ch, _ := b.Subscribe(slowCtx, WithName("slow"))
+	receive(t, ch)
+	receive(t, ch)
+	deadline := time.Now().Add(2 * time.Second)
+	for b.SubscriberStats()[0].QueueDepth != 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	for range ch {
+	}
+	b.Close()
+
+	// After a restart, "fast" reads everything still retained while "slow"
+	// is away.
+	b, err = NewWALBroker(WALOptions{Dir: dir, SegmentBytes: 1})
+	if err != nil {
+		t.Fatalf("Failed to reopen wal: %v", err)
+	}
+	defer b.Close()
+	ch, _ = b.Subscribe(ctx, WithName("fast"))
+	for i := 1; i < 3; i++ {
+		if batch := receive(t, ch); batch[0].Sequence != uint64(i) {
+			t.Fatalf("Expected sequence %d, got %d", i, batch[0].Sequence)
+		}
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for b.SubscriberStats()[0].QueueDepth != 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	segments, _ := listSegments(dir)
+	if len(segments) == 0 || segments[0] != 1 {
+		t.Fatalf("Expected segments from offset 1 to be kept for slow, got %v", segments)
+	}
+
+	ch, _ = b.Subscribe(ctx, WithName("slow"))
+	if batch := receive(t, ch); batch[0].Sequence != 1 {
+		t.Errorf("Expected slow to resume at sequence 1, got %d", batch[0].Sequence)
+	}
+}
+
+func TestWALBroker_CloseCommitsHeldBatch(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	b, err := NewWALBroker(WALOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("Failed to open wal: %v", err)
+	}
+	for _, msg := range []string{"one", "two"} {
+		if err := b.Publish(ctx, []model.LogEntry{{Message: msg}}); err != nil {
+			t.Fatalf("Publish failed: %v", err)
+		}
+	}
+
+	ch, _ := b.Subscribe(ctx, WithName("drain"))
+	if got := receive(t, ch)[0].Message; got != "one" {
+		t.Fatalf("Expected 'one', got %s", got)
+	}
+
+	if err := b.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	if err := b.Publish(ctx, []model.LogEntry{{Message: "late"}}); err != ErrClosed {
+		t.Errorf("Expected ErrClosed after Close, got %v", err)
+	}
+
+	// Coming back for more after Close commits "one", then the channel closes
+	// without delivering "two", which is still on disk.
+	for batch := range ch {
+		if len(batch) != 0 {
+			t.Errorf("Unexpected batch after Close: %v", batch)
+		}
+	}
+
+	b, err = NewWALBroker(WALOptions{Dir: dir})
+	if err != nil {
+		t.Fatalf("Failed to reopen wal: %v", err)
+	}
+	defer b.Close()
+
+	ch, _ = b.Subscribe(ctx, WithName("drain"))
+	if got := receive(t, ch)[0].Message; got != "two" {
+		t.Errorf("Expected 'two', got %s", got)
+	}
+}
@@ -0,0 +1,228 @@
+// Package export writes log entries as NDJSON, CSV or Parquet.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+// Format is an export file format.
+type Format string
+
+const (
+	FormatNDJSON  Format = "ndjson"
+	FormatCSV     Format = "csv"
+	FormatParquet Format = "parquet"
+)
+
+// ParseFormat accepts the Format names; empty means NDJSON.
+func ParseFormat(s string) (Format, error) {
+	switch f := Format(s); f {
+	case "":
+		return FormatNDJSON, nil
+	case FormatNDJSON, FormatCSV, FormatParquet:
+		return f, nil
+	}
+	return "", fmt.Errorf("unknown format %q (expected ndjson, csv or parquet)", s)
+}
+
+// ContentType returns the MIME type of the format.
+func (f Format) ContentType() string {
+	switch f {
+	case FormatCSV:
+		return "text/csv"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	}
+	return "application/x-ndjson"
+}
+
+// Columns lists the CSV columns in their default order. object and extra are
+// written as JSON.
+var Columns = []string{
+	"time", "level", "message", "logger_name", "sequence", "error", "stacktrace",
+	"session_id", "client_id", "source", "client_ip", "trace_id", "span_id", "trace_flags",
+	"object", "extra",
+}
+
+// ParseColumns parses a comma-separated column list; empty means Columns.
+func ParseColumns(s string) ([]string, error) {
+	if s == "" {
+		return Columns, nil
+	}
+	var columns []string
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if _, ok := column(model.LogEntry{}, name); !ok {
+			return nil, fmt.Errorf("unknown column %q (expected some of %s)", name, strings.Join(Columns, ", "))
+		}
+		columns = append(columns, name)
+	}
+	return columns, nil
+}
+
+// column returns the text of one column of entry.
+func column(entry model.LogEntry, name string) (string, bool) {
+	switch name {
+	case "time":
+		return entry.Time.Format(time.RFC3339Nano), true
+	case "level":
+		return string(entry.Level), true
+	case "message":
+		return entry.Message, true
+	case "logger_name":
+		return entry.LoggerName, true
+	case "sequence":
+		return strconv.FormatUint(entry.Sequence, 10), true
+	case "error":
+		return entry.Error, true
+	case "stacktrace":
+		return entry.Stacktrace, true
+	case "session_id":
+		return entry.SessionID, true
+	case "client_id":
+		return entry.ClientID, true
+	case "source":
+		return entry.Source, true
+	case "client_ip":
+		return entry.ClientIP, true
+	case "trace_id":
+		return entry.TraceID, true
+	case "span_id":
+		return entry.SpanID, true
+	case "trace_flags":
+		return strconv.Itoa(int(entry.TraceFlags)), true
+	case "object":
+		return jsonString(entry.Object), true
+	case "extra":
+		return jsonString(entry.Extra), true
+	}
+	return "", false
+}
+
+func jsonString(m map[string]interface{}) string {
+	if len(m) == 0 {
+		return ""
+	}
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// Writer encodes entries one at a time. Close must be called to complete
+// the output; it does not close the underlying writer.
+type Writer interface {
+	Write(entry model.LogEntry) error
+	Close() error
+}
+
+// NewWriter returns a Writer for format. columns only applies to CSV.
+func NewWriter(format Format, w io.Writer, columns []string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		cw := &csvWriter{w: csv.NewWriter(w), columns: columns, row: make([]string, len(columns))}
+		if err := cw.w.Write(columns); err != nil {
+			return nil, fmt.Errorf("failed to write CSV header: %w", err)
+		}
+		return cw, nil
+	case FormatParquet:
+		pw, err := writer.NewParquetWriterFromWriter(w, new(parquetRow), 1)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create Parquet writer: %w", err)
+		}
+		pw.RowGroupSize = parquetRowGroupSize
+		return &parquetWriter{w: pw}, nil
+	}
+	return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(entry model.LogEntry) error {
+	return n.enc.Encode(entry)
+}
+
+func (n *ndjsonWriter) Close() error {
+	return nil
+}
+
+type csvWriter struct {
+	w       *csv.Writer
+	columns []string
+	row     []string
+}
+
+func (c *csvWriter) Write(entry model.LogEntry) error {
+	for i, name := range c.columns {
+		c.row[i], _ = column(entry, name)
+	}
+	return c.w.Write(c.row)
+}
+
+func (c *csvWriter) Close() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// parquetRowGroupSize bounds how much of an export is buffered before a row
+// group is written out.
+const parquetRowGroupSize = 16 * 1024 * 1024
+
+// parquetRow is the Parquet schema: every field of LogEntry, with object and
+// extra as JSON strings.
+type parquetRow struct {
+	Time       int64  `parquet:"name=time, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Level      string `parquet:"name=level, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Message    string `parquet:"name=message, type=BYTE_ARRAY, convertedtype=UTF8"`
+	LoggerName string `parquet:"name=logger_name, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Sequence   int64  `parquet:"name=sequence, type=INT64, convertedtype=UINT_64"`
+	Error      string `parquet:"name=error, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Stacktrace string `parquet:"name=stacktrace, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SessionID  string `parquet:"name=session_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	ClientID   string `parquet:"name=client_id, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	Source     string `parquet:"name=source, type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY"`
+	ClientIP   string `parquet:"name=client_ip, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TraceID    string `parquet:"name=trace_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	SpanID     string `parquet:"name=span_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TraceFlags int32  `parquet:"name=trace_flags, type=INT32, convertedtype=UINT_8"`
+	Object     string `parquet:"name=object, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Extra      string `parquet:"name=extra, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type parquetWriter struct {
+	w *writer.ParquetWriter
+}
+
+func (p *parquetWriter) Write(entry model.LogEntry) error {
+	return p.w.Write(parquetRow{
+		Time:       entry.Time.UnixMilli(),
+		Level:      string(entry.Level),
+		Message:    entry.Message,
+		LoggerName: entry.LoggerName,
+		Sequence:   int64(entry.Sequence),
+		Error:      entry.Error,
+		Stacktrace: entry.Stacktrace,
+		SessionID:  entry.SessionID,
+		ClientID:   entry.ClientID,
+		Source:     entry.Source,
+		ClientIP:   entry.ClientIP,
+		TraceID:    entry.TraceID,
+		SpanID:     entry.SpanID,
+		TraceFlags: int32(entry.TraceFlags),
+		Object:     jsonString(entry.Object),
+		Extra:      jsonString(entry.Extra),
+	})
+}
+
+func (p *parquetWriter) Close() error {
+	return p.w.WriteStop()
+}
@@ -0,0 +1,90 @@
+package export
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+var entries = []model.LogEntry{
+	{Time: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Level: "INFO", Message: "hello, world", Sequence: 1},
+	{Time: time.Date(2024, 1, 1, 0, 0, 1, 0, time.UTC), Level: "SEVERE", Message: "boom", Object: map[string]interface{}{"id": "A-1"}},
+}
+
+func write(t *testing.T, format Format, columns []string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := NewWriter(format, &buf, columns)
+	if err != nil {
+		t.Fatalf("NewWriter(%s) failed: %v", format, err)
+	}
+	for _, entry := range entries {
+		if err := w.Write(entry); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestNDJSON(t *testing.T) {
+	dec := json.NewDecoder(bytes.NewReader(write(t, FormatNDJSON, nil)))
+	for i := range entries {
+		var got model.LogEntry
+		if err := dec.Decode(&got); err != nil || got.Message != entries[i].Message {
+			t.Errorf("Line %d: expected %q, got %+v, %v", i, entries[i].Message, got, err)
+		}
+	}
+}
+
+func TestCSV(t *testing.T) {
+	columns, err := ParseColumns("time, message,object")
+	if err != nil {
+		t.Fatalf("ParseColumns failed: %v", err)
+	}
+	records, err := csv.NewReader(bytes.NewReader(write(t, FormatCSV, columns))).ReadAll()
+	if err != nil {
+		t.Fatalf("Invalid CSV: %v", err)
+	}
+	want := [][]string{
+		{"time", "message", "object"},
+		{"2024-01-01T00:00:00Z", "hello, world", ""},
+		{"2024-01-01T00:00:01Z", "boom", `{"id":"A-1"}`},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("Expected %d records, got %v", len(want), records)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if records[i][j] != want[i][j] {
+				t.Errorf("Record %d column %d: expected %q, got %q", i, j, want[i][j], records[i][j])
+			}
+		}
+	}
+
+	if _, err := ParseColumns("time,password"); err == nil {
+		t.Error("Expected an unknown column to be rejected")
+	}
+}
+
+func TestParquet(t *testing.T) {
+	data := write(t, FormatParquet, nil)
+	if len(data) < 8 || string(data[:4]) != "PAR1" || string(data[len(data)-4:]) != "PAR1" {
+		t.Errorf("Expected a Parquet file, got %d bytes", len(data))
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat(""); err != nil || f != FormatNDJSON {
+		t.Errorf("Expected NDJSON by default, got %q, %v", f, err)
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("Expected an unknown format to be rejected")
+	}
+}
@@ -0,0 +1,173 @@
+package model
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// levelOrder lists the canonical levels from least to most severe.
+var levelOrder = []LogLevel{
+	LogLevelFinest,
+	LogLevelFiner,
+	LogLevelFine,
+	LogLevelConfig,
+	LogLevelInfo,
+	LogLevelWarning,
+	LogLevelSevere,
+}
+
+// levelAliases maps level names used by other logging libraries and syslog
+// onto the canonical levels. Keys are upper case.
+var levelAliases = map[string]LogLevel{
+	"TRACE":       LogLevelFinest,
+	"VERBOSE":     LogLevelFiner,
+	"DEBUG":       LogLevelFine,
+	"INFORMATION": LogLevelInfo,
+	"NOTICE":      LogLevelInfo,
+	"WARN":        LogLevelWarning,
+	"ERROR":       LogLevelSevere,
+	"ERR":         LogLevelSevere,
+	"CRITICAL":    LogLevelSevere,
+	"CRIT":        LogLevelSevere,
+	"FATAL":       LogLevelSevere,
+	"ALERT":       LogLevelSevere,
+	"EMERGENCY":   LogLevelSevere,
+	"EMERG":       LogLevelSevere,
+	"PANIC":       LogLevelSevere,
+}
+
+// ParseLevel maps a level name, alias or numeric severity onto a canonical
+// level, ignoring case. Numbers below 300 follow Python's logging module
+// (10 DEBUG .. 50 CRITICAL); larger ones follow java.util.logging (300 FINEST
+// .. 1000 SEVERE).
+func ParseLevel(s string) (LogLevel, bool) {
+	name := strings.ToUpper(strings.TrimSpace(s))
+	if name == "" {
+		return "", false
+	}
+	if l := LogLevel(name); l.Valid() {
+		return l, true
+	}
+	if l, ok := levelAliases[name]; ok {
+		return l, true
+	}
+	if n, err := strconv.Atoi(name); err == nil && n >= 0 {
+		return numericLevel(n), true
+	}
+	return "", false
+}
+
+func numericLevel(n int) LogLevel {
+	if n >= 300 {
+		switch {
+		case n >= 1000:
+			return LogLevelSevere
+		case n >= 900:
+			return LogLevelWarning
+		case n >= 800:
+			return LogLevelInfo
+		case n >= 700:
+			return LogLevelConfig
+		case n >= 500:
+			return LogLevelFine
+		case n >= 400:
+			return LogLevelFiner
+		default:
+			return LogLevelFinest
+		}
+	}
+	switch {
+	case n >= 40:
+		return LogLevelSevere
+	case n >= 30:
+		return LogLevelWarning
+	case n >= 20:
+		return LogLevelInfo
+	case n >= 10:
+		return LogLevelFine
+	default:
+		return LogLevelFinest
+	}
+}
+
+// Valid reports whether l is one of the canonical levels.
+func (l LogLevel) Valid() bool {
+	return l.Severity() >= 0
+}
+
+// NormalizeLevel returns the canonical form of l, or l unchanged when it is
+// not a known level or alias.
+func NormalizeLevel(l LogLevel) LogLevel {
+	if canonical, ok := ParseLevel(string(l)); ok {
+		return canonical
+	}
+	return l
+}
+
+// Severity orders the canonical levels from 0 (FINEST) to 6 (SEVERE). It is
+// -1 for anything else.
+func (l LogLevel) Severity() int {
+	for i, level := range levelOrder {
+		if level == l {
+			return i
+		}
+	}
+	return -1
+}
+
+// AtLeast reports whether l, once normalised, is min or more severe.
+func (l LogLevel) AtLeast(min LogLevel) bool {
+	severity := NormalizeLevel(l).Severity()
+	return severity >= 0 && severity >= NormalizeLevel(min).Severity()
+}
+
+// LevelsAtLeast returns the canonical levels at least as severe as min.
+func LevelsAtLeast(min LogLevel) []LogLevel {
+	severity := NormalizeLevel(min).Severity()
+	if severity < 0 {
+		return nil
+	}
+	return append([]LogLevel(nil), levelOrder[severity:]...)
+}
+
+// LevelNames returns the upper case names, canonical and aliases, stored
+// entries may carry for levels. Entries ingested before levels were
+// normalised may still use an alias.
+func LevelNames(levels ...LogLevel) []string {
+	var names []string
+	for _, l := range levels {
+		names = append(names, string(l))
+		for alias, canonical := range levelAliases {
+			if canonical == l {
+				names = append(names, alias)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// UnmarshalJSON accepts numeric levels as well as strings. Numbers are kept
+// as their decimal text until ParseLevel normalises them.
+func (l *LogLevel) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && (data[0] == '-' || (data[0] >= '0' && data[0] <= '9')) {
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		*l = LogLevel(n.String())
+		return nil
+	}
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	*l = LogLevel(s)
+	return nil
+}
@@ -0,0 +1,66 @@
+package model
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		in   string
+		want LogLevel
+		ok   bool
+	}{
+		{"INFO", LogLevelInfo, true},
+		{"warning", LogLevelWarning, true},
+		{"WARN", LogLevelWarning, true},
+		{"debug", LogLevelFine, true},
+		{"Trace", LogLevelFinest, true},
+		{"ERROR", LogLevelSevere, true},
+		{"fatal", LogLevelSevere, true},
+		{"10", LogLevelFine, true},
+		{"30", LogLevelWarning, true},
+		{"50", LogLevelSevere, true},
+		{"800", LogLevelInfo, true},
+		{"1000", LogLevelSevere, true},
+		{"", "", false},
+		{"LOUD", "", false},
+		{"-5", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseLevel(tt.in)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ParseLevel(%q) = %q, %v; want %q, %v", tt.in, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestLevelOrdering(t *testing.T) {
+	if !LogLevelSevere.AtLeast(LogLevelWarning) || !LogLevel("error").AtLeast("WARN") {
+		t.Error("Expected SEVERE/error to be at least WARNING")
+	}
+	if LogLevelInfo.AtLeast(LogLevelWarning) || LogLevel("custom").AtLeast(LogLevelFinest) {
+		t.Error("Expected INFO and unknown levels to be below WARNING")
+	}
+
+	if got := LevelsAtLeast("warn"); !reflect.DeepEqual(got, []LogLevel{LogLevelWarning, LogLevelSevere}) {
+		t.Errorf("Unexpected levels: %v", got)
+	}
+	if got := LevelNames(LogLevelWarning); !reflect.DeepEqual(got, []string{"WARN", "WARNING"}) {
+		t.Errorf("Unexpected names: %v", got)
+	}
+}
+
+func TestLogLevel_UnmarshalNumeric(t *testing.T) {
+	var entries []LogEntry
+	if err := json.Unmarshal([]byte(`[{"level":40},{"level":"DEBUG"},{"level":null}]`), &entries); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	want := []LogLevel{"40", "DEBUG", ""}
+	for i, entry := range entries {
+		if entry.Level != want[i] {
+			t.Errorf("Entry %d: expected %q, got %q", i, want[i], entry.Level)
+		}
+	}
+}
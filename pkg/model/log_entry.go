@@ -40,6 +40,11 @@ type LogEntry struct {
 	ClientID  string `json:"client_id"`
 	Source    string `json:"source"`
 
+	// Trace Correlation (W3C trace context, lowercase hex)
+	TraceID    string `json:"trace_id,omitempty"`
+	SpanID     string `json:"span_id,omitempty"`
+	TraceFlags uint8  `json:"trace_flags,omitempty"`
+
 	// Enriched Fields
 	ClientIP string `json:"client_ip,omitempty"`
 }
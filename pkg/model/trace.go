@@ -0,0 +1,54 @@
+package model
+
+import (
+	"strconv"
+	"strings"
+)
+
+// ParseTraceparent extracts the trace context from a W3C traceparent header
+// (version-traceid-spanid-flags). IDs are returned in lowercase hex.
+func ParseTraceparent(header string) (traceID, spanID string, flags uint8, ok bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return "", "", 0, false
+	}
+	// Version 00 has exactly four fields; later versions may append more.
+	if parts[0] == "00" && len(parts) != 4 {
+		return "", "", 0, false
+	}
+	if !ValidTraceID(parts[1]) || !ValidSpanID(parts[2]) || len(parts[3]) != 2 {
+		return "", "", 0, false
+	}
+	f, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return "", "", 0, false
+	}
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2]), uint8(f), true
+}
+
+// ValidTraceID reports whether id is 32 hex digits and not all zero.
+func ValidTraceID(id string) bool {
+	return validHexID(id, 32)
+}
+
+// ValidSpanID reports whether id is 16 hex digits and not all zero.
+func ValidSpanID(id string) bool {
+	return validHexID(id, 16)
+}
+
+func validHexID(id string, n int) bool {
+	if len(id) != n {
+		return false
+	}
+	zero := true
+	for _, c := range id {
+		switch {
+		case c == '0':
+		case c >= '1' && c <= '9', c >= 'a' && c <= 'f', c >= 'A' && c <= 'F':
+			zero = false
+		default:
+			return false
+		}
+	}
+	return !zero
+}
@@ -0,0 +1,101 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ValidationLimits bounds what a single LogEntry may contain. Zero values
+// disable the corresponding check.
+type ValidationLimits struct {
+	MaxMessageBytes    int
+	MaxStacktraceBytes int
+	// MaxObjectBytes caps the JSON-encoded size of Object.
+	MaxObjectBytes int
+	// MaxFutureSkew is how far ahead of the server clock Time may be.
+	MaxFutureSkew time.Duration
+	// MaxAge is how far in the past Time may be.
+	MaxAge time.Duration
+}
+
+// DefaultValidationLimits are used by the ingestor unless overridden.
+var DefaultValidationLimits = ValidationLimits{
+	MaxMessageBytes:    64 << 10,
+	MaxStacktraceBytes: 256 << 10,
+	MaxObjectBytes:     256 << 10,
+	MaxFutureSkew:      10 * time.Minute,
+	MaxAge:             30 * 24 * time.Hour,
+}
+
+// FieldError describes why a field of an entry was rejected.
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// ValidationErrors lists every problem found in one entry.
+type ValidationErrors []FieldError
+
+func (v ValidationErrors) Error() string {
+	parts := make([]string, len(v))
+	for i, fe := range v {
+		parts[i] = fe.Field + ": " + fe.Error
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Validate checks e against limits, returning ValidationErrors or nil. Level
+// must be canonical, so normalise it with ParseLevel first. An empty Level or
+// zero Time is valid since the ingestor fills in defaults.
+func (e *LogEntry) Validate(limits ValidationLimits, now time.Time) error {
+	var errs ValidationErrors
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, FieldError{Field: field, Error: fmt.Sprintf(format, args...)})
+	}
+
+	if strings.TrimSpace(e.Message) == "" {
+		add("message", "is required")
+	} else if limits.MaxMessageBytes > 0 && len(e.Message) > limits.MaxMessageBytes {
+		add("message", "exceeds %d bytes", limits.MaxMessageBytes)
+	}
+
+	if e.Level != "" && !e.Level.Valid() {
+		add("level", "unknown level %q", e.Level)
+	}
+
+	if limits.MaxStacktraceBytes > 0 && len(e.Stacktrace) > limits.MaxStacktraceBytes {
+		add("stacktrace", "exceeds %d bytes", limits.MaxStacktraceBytes)
+	}
+
+	if limits.MaxObjectBytes > 0 && len(e.Object) > 0 {
+		data, err := json.Marshal(e.Object)
+		if err != nil {
+			add("object", "is not encodable: %v", err)
+		} else if len(data) > limits.MaxObjectBytes {
+			add("object", "exceeds %d bytes", limits.MaxObjectBytes)
+		}
+	}
+
+	if e.TraceID != "" && !ValidTraceID(e.TraceID) {
+		add("trace_id", "must be 32 hex digits, not all zero")
+	}
+	if e.SpanID != "" && !ValidSpanID(e.SpanID) {
+		add("span_id", "must be 16 hex digits, not all zero")
+	}
+
+	if !e.Time.IsZero() {
+		if limits.MaxFutureSkew > 0 && e.Time.After(now.Add(limits.MaxFutureSkew)) {
+			add("time", "more than %s in the future", limits.MaxFutureSkew)
+		}
+		if limits.MaxAge > 0 && e.Time.Before(now.Add(-limits.MaxAge)) {
+			add("time", "older than %s", limits.MaxAge)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
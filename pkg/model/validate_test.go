@@ -0,0 +1,57 @@
+package model
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogEntry_Validate(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	limits := ValidationLimits{
+		MaxMessageBytes:    10,
+		MaxStacktraceBytes: 10,
+		MaxObjectBytes:     20,
+		MaxFutureSkew:      time.Minute,
+		MaxAge:             time.Hour,
+	}
+
+	tests := []struct {
+		name   string
+		entry  LogEntry
+		fields []string
+	}{
+		{"valid", LogEntry{Message: "ok", Level: LogLevelWarning, Time: now}, nil},
+		{"defaults", LogEntry{Message: "ok"}, nil},
+		{"empty message", LogEntry{Message: " "}, []string{"message"}},
+		{"long message", LogEntry{Message: strings.Repeat("x", 11)}, []string{"message"}},
+		{"unknown level", LogEntry{Message: "ok", Level: "info"}, []string{"level"}},
+		{"long stacktrace", LogEntry{Message: "ok", Stacktrace: strings.Repeat("x", 11)}, []string{"stacktrace"}},
+		{"large object", LogEntry{Message: "ok", Object: map[string]interface{}{"k": strings.Repeat("x", 20)}}, []string{"object"}},
+		{"future", LogEntry{Message: "ok", Time: now.Add(2 * time.Minute)}, []string{"time"}},
+		{"too old", LogEntry{Message: "ok", Time: now.Add(-2 * time.Hour)}, []string{"time"}},
+		{"several", LogEntry{Level: "LOUD"}, []string{"message", "level"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.entry.Validate(limits, now)
+			if tt.fields == nil {
+				if err != nil {
+					t.Errorf("Expected valid, got %v", err)
+				}
+				return
+			}
+			var errs ValidationErrors
+			if !errors.As(err, &errs) || len(errs) != len(tt.fields) {
+				t.Fatalf("Expected errors for %v, got %v", tt.fields, err)
+			}
+			for i, field := range tt.fields {
+				if errs[i].Field != field {
+					t.Errorf("Expected %s error, got %+v", field, errs[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+// Node is an expression in a parsed query: *BinaryExpr, *NotExpr or *Term.
+type Node interface {
+	String() string
+}
+
+// BinaryOp combines two expressions.
+type BinaryOp string
+
+const (
+	OpAnd BinaryOp = "AND"
+	OpOr  BinaryOp = "OR"
+)
+
+type BinaryExpr struct {
+	Op          BinaryOp
+	Left, Right Node
+}
+
+func (b *BinaryExpr) String() string {
+	return "(" + b.Left.String() + " " + string(b.Op) + " " + b.Right.String() + ")"
+}
+
+type NotExpr struct {
+	Expr Node
+}
+
+func (n *NotExpr) String() string {
+	return "NOT " + n.Expr.String()
+}
+
+// TermOp is how a Term compares a field with its value.
+type TermOp int
+
+const (
+	// OpMatch is containment for text fields and equality for the others.
+	OpMatch TermOp = iota
+	// OpWildcard matches a glob with * and ?; see Term.Regex and Term.Like.
+	OpWildcard
+	// OpRegex matches an RE2 regular expression anywhere in the value.
+	OpRegex
+	// OpRange bounds the value by Low and/or High.
+	OpRange
+	// OpExists matches entries where the field is set.
+	OpExists
+)
+
+// FieldKind decides which operators a field supports and how they compare.
+type FieldKind int
+
+const (
+	// KindText fields (message, error, ...) match substrings, ignoring case.
+	KindText FieldKind = iota
+	// KindExact fields (ids) match whole values, ignoring case.
+	KindExact
+	// KindLevel matches normalised levels and orders them by severity.
+	KindLevel
+	// KindTime only supports ranges.
+	KindTime
+	// KindNumber compares numerically.
+	KindNumber
+	// KindJSON addresses a value inside Object or Extra.
+	KindJSON
+)
+
+var fieldKinds = map[string]FieldKind{
+	"message":     KindText,
+	"error":       KindText,
+	"stacktrace":  KindText,
+	"logger_name": KindText,
+	"source":      KindText,
+	"session_id":  KindExact,
+	"client_id":   KindExact,
+	"trace_id":    KindExact,
+	"span_id":     KindExact,
+	"client_ip":   KindExact,
+	"level":       KindLevel,
+	"time":        KindTime,
+	"sequence":    KindNumber,
+}
+
+// Term is a single field comparison.
+type Term struct {
+	// Field is a column name such as "message", or a dotted path starting with
+	// "object." or "extra." for KindJSON.
+	Field string
+	Kind  FieldKind
+	// Keys is the path below object/extra for KindJSON fields.
+	Keys []string
+	Op   TermOp
+	// Value is the unescaped value of OpMatch terms.
+	Value string
+	// Regex is set for OpRegex and OpWildcard.
+	Regex *regexp.Regexp
+	// Like is the OpWildcard pattern in SQL LIKE syntax.
+	Like string
+	// Low and High bound OpRange terms; nil means unbounded.
+	Low, High *Bound
+	// Pos is the 1-based position of the term in the query.
+	Pos int
+}
+
+// Bound is one end of a range, parsed according to the field kind.
+type Bound struct {
+	Value     string
+	Inclusive bool
+	Number    float64
+	Time      time.Time
+	Level     model.LogLevel
+}
+
+func (t *Term) String() string {
+	switch t.Op {
+	case OpWildcard:
+		return t.Field + ":~" + t.Like
+	case OpRegex:
+		return t.Field + ":/" + t.Regex.String() + "/"
+	case OpExists:
+		return t.Field + ":*"
+	case OpRange:
+		var b strings.Builder
+		b.WriteString(t.Field + ":")
+		if t.Low != nil && t.Low.Inclusive {
+			b.WriteString("[")
+		} else {
+			b.WriteString("{")
+		}
+		b.WriteString(boundString(t.Low) + " TO " + boundString(t.High))
+		if t.High != nil && t.High.Inclusive {
+			b.WriteString("]")
+		} else {
+			b.WriteString("}")
+		}
+		return b.String()
+	default:
+		return fmt.Sprintf("%s:%q", t.Field, t.Value)
+	}
+}
+
+func boundString(b *Bound) string {
+	if b == nil {
+		return "*"
+	}
+	return b.Value
+}
+
+// Levels returns the canonical levels a KindLevel range covers.
+func (t *Term) Levels() []model.LogLevel {
+	var levels []model.LogLevel
+	for _, l := range model.LevelsAtLeast(model.LogLevelFinest) {
+		if inRange(l.Severity(), t.Low, t.High, func(b *Bound) int { return b.Level.Severity() }) {
+			levels = append(levels, l)
+		}
+	}
+	return levels
+}
+
+// inRange reports whether v lies within low and high, where bound extracts the
+// comparable value of a bound.
+func inRange[T int | int64 | float64](v T, low, high *Bound, bound func(*Bound) T) bool {
+	if low != nil {
+		b := bound(low)
+		if v < b || (v == b && !low.Inclusive) {
+			return false
+		}
+	}
+	if high != nil {
+		b := bound(high)
+		if v > b || (v == b && !high.Inclusive) {
+			return false
+		}
+	}
+	return true
+}
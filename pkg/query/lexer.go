@@ -0,0 +1,210 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SyntaxError reports where a query could not be parsed.
+type SyntaxError struct {
+	// Pos is the 1-based character position of the problem.
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokRegex
+	tokRange
+	tokLParen
+	tokRParen
+	tokAnd
+	tokOr
+	tokNot
+)
+
+type token struct {
+	kind tokenKind
+	// text is the raw word, or the unescaped contents of strings, regexes and
+	// ranges (without delimiters).
+	text string
+	// inclusiveLow/High are set for ranges opened with [ or closed with ].
+	inclusiveLow, inclusiveHigh bool
+	// pos and end are 0-based byte offsets into the query.
+	pos, end int
+}
+
+type lexer struct {
+	src  string
+	pos  int
+	toks []token
+}
+
+// lex splits a query into tokens.
+func lex(src string) ([]token, error) {
+	l := &lexer{src: src}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.src) {
+			l.toks = append(l.toks, token{kind: tokEOF, pos: l.pos, end: l.pos})
+			return l.toks, nil
+		}
+
+		start := l.pos
+		var err error
+		switch c := l.src[l.pos]; {
+		case c == '(':
+			l.pos++
+			l.emit(tokLParen, start, "")
+		case c == ')':
+			l.pos++
+			l.emit(tokRParen, start, "")
+		case c == '"':
+			err = l.lexString()
+		case c == '/':
+			err = l.lexRegex()
+		case c == '[' || c == '{':
+			err = l.lexRange()
+		case c == '-' && l.pos+1 < len(l.src) && !isSpace(l.src[l.pos+1]):
+			l.pos++
+			l.emit(tokNot, start, "-")
+		default:
+			l.lexWord()
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (l *lexer) emit(kind tokenKind, start int, text string) {
+	l.toks = append(l.toks, token{kind: kind, text: text, pos: start, end: l.pos})
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.src) && isSpace(l.src[l.pos]) {
+		l.pos++
+	}
+}
+
+// lexWord reads up to whitespace or a parenthesis. A quote, slash or bracket
+// right after an unescaped colon starts the value token of field:value.
+func (l *lexer) lexWord() {
+	start := l.pos
+	afterColon := false
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if isSpace(c) || c == '(' || c == ')' || c == '"' {
+			break
+		}
+		if afterColon && (c == '/' || c == '[' || c == '{') {
+			break
+		}
+		if c == '\\' && l.pos+1 < len(l.src) {
+			l.pos += 2
+			afterColon = false
+			continue
+		}
+		afterColon = c == ':'
+		l.pos++
+	}
+
+	word := l.src[start:l.pos]
+	switch word {
+	case "AND":
+		l.emit(tokAnd, start, word)
+	case "OR":
+		l.emit(tokOr, start, word)
+	case "NOT":
+		l.emit(tokNot, start, word)
+	default:
+		l.emit(tokWord, start, word)
+	}
+}
+
+// lexString reads a double-quoted phrase, resolving \" and \\.
+func (l *lexer) lexString() error {
+	start := l.pos
+	l.pos++
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\\' && l.pos+1 < len(l.src):
+			b.WriteByte(l.src[l.pos+1])
+			l.pos += 2
+		case c == '"':
+			l.pos++
+			l.emit(tokString, start, b.String())
+			return nil
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return &SyntaxError{Pos: start + 1, Msg: "unterminated quoted phrase"}
+}
+
+// lexRegex reads /pattern/. Only \/ is unescaped; other escapes are left for
+// the regular expression.
+func (l *lexer) lexRegex() error {
+	start := l.pos
+	l.pos++
+	var b strings.Builder
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		switch {
+		case c == '\\' && l.pos+1 < len(l.src) && l.src[l.pos+1] == '/':
+			b.WriteByte('/')
+			l.pos += 2
+		case c == '\\' && l.pos+1 < len(l.src):
+			b.WriteString(l.src[l.pos : l.pos+2])
+			l.pos += 2
+		case c == '/':
+			l.pos++
+			l.emit(tokRegex, start, b.String())
+			return nil
+		default:
+			b.WriteByte(c)
+			l.pos++
+		}
+	}
+	return &SyntaxError{Pos: start + 1, Msg: "unterminated regular expression"}
+}
+
+// lexRange reads [low TO high], where { and } exclude the bound.
+func (l *lexer) lexRange() error {
+	start := l.pos
+	inclusiveLow := l.src[l.pos] == '['
+	l.pos++
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == ']' || c == '}' {
+			text := l.src[start+1 : l.pos]
+			l.pos++
+			l.toks = append(l.toks, token{
+				kind:          tokRange,
+				text:          text,
+				inclusiveLow:  inclusiveLow,
+				inclusiveHigh: c == ']',
+				pos:           start,
+				end:           l.pos,
+			})
+			return nil
+		}
+		l.pos++
+	}
+	return &SyntaxError{Pos: start + 1, Msg: "unterminated range"}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,146 @@
+package query
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+// Match reports whether entry satisfies the query.
+func (q *Query) Match(entry model.LogEntry) bool {
+	return eval(q.Root, entry)
+}
+
+func eval(n Node, entry model.LogEntry) bool {
+	switch n := n.(type) {
+	case *BinaryExpr:
+		if n.Op == OpAnd {
+			return eval(n.Left, entry) && eval(n.Right, entry)
+		}
+		return eval(n.Left, entry) || eval(n.Right, entry)
+	case *NotExpr:
+		return !eval(n.Expr, entry)
+	case *Term:
+		return n.match(entry)
+	}
+	return false
+}
+
+func (t *Term) match(entry model.LogEntry) bool {
+	switch t.Kind {
+	case KindTime:
+		return t.Op == OpExists || inRange(entry.Time.UnixNano(), t.Low, t.High, func(b *Bound) int64 { return b.Time.UnixNano() })
+	case KindNumber:
+		return t.matchNumber(float64(entry.Sequence))
+	case KindJSON:
+		return t.matchJSON(entry)
+	case KindLevel:
+		if t.Op == OpRange {
+			severity := model.NormalizeLevel(entry.Level).Severity()
+			return severity >= 0 && inRange(severity, t.Low, t.High, func(b *Bound) int { return b.Level.Severity() })
+		}
+		if t.Op == OpMatch {
+			return strings.EqualFold(string(model.NormalizeLevel(entry.Level)), string(model.NormalizeLevel(model.LogLevel(t.Value))))
+		}
+		return t.matchString(string(entry.Level))
+	default:
+		return t.matchString(stringField(t.Field, entry))
+	}
+}
+
+// matchString applies the term to a text or exact field.
+func (t *Term) matchString(value string) bool {
+	switch t.Op {
+	case OpExists:
+		return value != ""
+	case OpRegex, OpWildcard:
+		return t.Regex.MatchString(value)
+	case OpMatch:
+		if t.Kind == KindText {
+			return strings.Contains(strings.ToLower(value), strings.ToLower(t.Value))
+		}
+		return strings.EqualFold(value, t.Value)
+	}
+	return false
+}
+
+func (t *Term) matchNumber(n float64) bool {
+	switch t.Op {
+	case OpExists:
+		return true
+	case OpRange:
+		return inRange(n, t.Low, t.High, func(b *Bound) float64 { return b.Number })
+	case OpMatch:
+		v, err := strconv.ParseFloat(t.Value, 64)
+		return err == nil && n == v
+	}
+	return false
+}
+
+// matchJSON applies the term to a value inside Object or Extra, comparing
+// like storage.FieldFilter does.
+func (t *Term) matchJSON(entry model.LogEntry) bool {
+	root := entry.Object
+	if strings.HasPrefix(t.Field, "extra.") {
+		root = entry.Extra
+	}
+	var value interface{} = root
+	for _, key := range t.Keys {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = m[key]; !ok {
+			return false
+		}
+	}
+
+	switch t.Op {
+	case OpExists:
+		return true
+	case OpRange:
+		n, ok := value.(float64)
+		return ok && t.matchNumber(n)
+	case OpRegex, OpWildcard:
+		s, ok := value.(string)
+		return ok && t.Regex.MatchString(s)
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.EqualFold(v, t.Value)
+	case float64:
+		return t.matchNumber(v)
+	default:
+		raw, err := json.Marshal(v)
+		return err == nil && string(raw) == t.Value
+	}
+}
+
+func stringField(field string, entry model.LogEntry) string {
+	switch field {
+	case "message":
+		return entry.Message
+	case "error":
+		return entry.Error
+	case "stacktrace":
+		return entry.Stacktrace
+	case "logger_name":
+		return entry.LoggerName
+	case "source":
+		return entry.Source
+	case "session_id":
+		return entry.SessionID
+	case "client_id":
+		return entry.ClientID
+	case "trace_id":
+		return entry.TraceID
+	case "span_id":
+		return entry.SpanID
+	case "client_ip":
+		return entry.ClientIP
+	}
+	return ""
+}
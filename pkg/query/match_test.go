@@ -0,0 +1,74 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+func TestQuery_Match(t *testing.T) {
+	base := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	now = func() time.Time { return base.Add(30 * time.Minute) }
+	defer func() { now = time.Now }()
+
+	entry := model.LogEntry{
+		Level:     "ERROR",
+		Message:   "Upstream request timed out after 30s",
+		Error:     "context deadline exceeded",
+		Source:    "api-gateway",
+		SessionID: "S-1",
+		Sequence:  42,
+		Time:      base,
+		Extra:     map[string]interface{}{"http_status": float64(504)},
+		Object:    map[string]interface{}{"order": map[string]interface{}{"id": "A-17"}, "retry": true},
+	}
+
+	tests := []struct {
+		q    string
+		want bool
+	}{
+		{`timed`, true},
+		{`"request timed out"`, true},
+		{`"timed request"`, false},
+		{`level:SEVERE`, true},
+		{`level:>=WARNING`, true},
+		{`level:<WARNING`, false},
+		{`level:[INFO TO WARNING]`, false},
+		{`error:timeout OR level:SEVERE`, true},
+		{`error:timeout AND level:SEVERE`, false},
+		{`NOT error:deadline`, false},
+		{`-source:health*`, true},
+		{`source:api-*`, true},
+		{`source:gate?ay`, true},
+		{`session_id:s-1`, true},
+		{`session_id:S`, false},
+		{`session_id:S*`, true},
+		{`message:/timed out after \d+s/`, true},
+		{`message:/^timed/`, false},
+		{`sequence:42`, true},
+		{`sequence:[40 TO 42}`, false},
+		{`sequence:{41 TO 50]`, true},
+		{`time:>now-1h`, true},
+		{`time:<2026-05-01`, false},
+		{`time:[2026-05-01 TO 2026-05-02]`, true},
+		{`extra.http_status:>=500`, true},
+		{`extra.http_status:504`, true},
+		{`object.order.id:a-17`, true},
+		{`object.order.id:A*`, true},
+		{`object.retry:true`, true},
+		{`object.order:*`, true},
+		{`object.user:*`, false},
+		{`trace_id:*`, false},
+		{`(level:INFO OR source:api*) AND sequence:>40`, true},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.q)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.q, err)
+		}
+		if got := q.Match(entry); got != tt.want {
+			t.Errorf("%s: expected %v, got %v (parsed %s)", tt.q, tt.want, got, q)
+		}
+	}
+}
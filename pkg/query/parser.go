@@ -0,0 +1,437 @@
+package query
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+// Query is a parsed query expression.
+type Query struct {
+	Root Node
+	// Source is the query text it was parsed from.
+	Source string
+}
+
+func (q *Query) String() string {
+	return q.Root.String()
+}
+
+// now is replaced in tests.
+var now = time.Now
+
+// Parse compiles a query such as
+//
+//	level:>=WARNING AND (error:timeout OR "connection reset") -source:health*
+//
+// Terms are field:value, bare words and "quoted phrases" (matched against the
+// message), /regular expressions/, globs with * and ?, ranges such as
+// sequence:[10 TO 20] or time:{now-1h TO *}, comparisons (>, >=, <, <=) and
+// field:* for existence. Terms combine with AND (also implied), OR, NOT or a
+// leading -, and parentheses. Errors are *SyntaxError.
+func Parse(src string) (*Query, error) {
+	toks, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{toks: toks}
+	if p.peek().kind == tokEOF {
+		return nil, &SyntaxError{Pos: 1, Msg: "empty query"}
+	}
+
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, p.unexpected(tok)
+	}
+	return &Query{Root: root, Source: src}, nil
+}
+
+type parser struct {
+	toks []token
+	i    int
+}
+
+func (p *parser) peek() token {
+	return p.toks[p.i]
+}
+
+func (p *parser) next() token {
+	tok := p.toks[p.i]
+	if tok.kind != tokEOF {
+		p.i++
+	}
+	return tok
+}
+
+func (p *parser) parseOr() (Node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == tokOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: OpOr, Left: left, Right: right}
+	}
+	return left, nil
+}
+
+// parseAnd joins unary expressions with explicit or implied AND.
+func (p *parser) parseAnd() (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch p.peek().kind {
+		case tokAnd:
+			p.next()
+		case tokWord, tokString, tokRegex, tokLParen, tokNot:
+		default:
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{Op: OpAnd, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	if p.peek().kind == tokNot {
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: expr}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokLParen:
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.peek(); closing.kind != tokRParen {
+			return nil, &SyntaxError{Pos: closing.pos + 1, Msg: "expected ')'"}
+		}
+		p.next()
+		return expr, nil
+	case tokWord:
+		return p.parseWord(tok)
+	case tokString:
+		return &Term{Field: "message", Kind: KindText, Op: OpMatch, Value: tok.text, Pos: tok.pos + 1}, nil
+	case tokRegex:
+		return regexTerm("message", KindText, tok)
+	case tokRange:
+		return nil, &SyntaxError{Pos: tok.pos + 1, Msg: "a range needs a field, e.g. sequence:[1 TO 10]"}
+	default:
+		return nil, p.unexpected(tok)
+	}
+}
+
+func (p *parser) unexpected(tok token) error {
+	switch tok.kind {
+	case tokEOF:
+		return &SyntaxError{Pos: tok.pos + 1, Msg: "unexpected end of query"}
+	case tokRParen:
+		return &SyntaxError{Pos: tok.pos + 1, Msg: "unexpected ')'"}
+	default:
+		return &SyntaxError{Pos: tok.pos + 1, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+}
+
+// parseWord handles bare words and field:value, where the value may be the
+// next token if it is a phrase, regex or range.
+func (p *parser) parseWord(tok token) (Node, error) {
+	colon := unescapedIndex(tok.text, ':')
+	if colon < 0 {
+		return valueTerm("message", KindText, nil, tok.text, tok.pos)
+	}
+
+	name := tok.text[:colon]
+	field, kind, keys, err := resolveField(name)
+	if err != nil {
+		return nil, &SyntaxError{Pos: tok.pos + 1, Msg: err.Error()}
+	}
+
+	if value := tok.text[colon+1:]; value != "" {
+		return valueTerm(field, kind, keys, value, tok.pos+colon+1)
+	}
+
+	// The value is the adjacent token.
+	valueTok := p.peek()
+	if valueTok.pos != tok.end {
+		return nil, &SyntaxError{Pos: tok.end + 1, Msg: fmt.Sprintf("expected a value after %q", tok.text)}
+	}
+	switch valueTok.kind {
+	case tokString:
+		p.next()
+		if kind == KindTime {
+			return nil, &SyntaxError{Pos: valueTok.pos + 1, Msg: "time only supports ranges, e.g. time:>now-1h"}
+		}
+		term := &Term{Field: field, Kind: kind, Keys: keys, Op: OpMatch, Value: valueTok.text, Pos: valueTok.pos + 1}
+		return term, checkMatch(term)
+	case tokRegex:
+		p.next()
+		if kind == KindTime || kind == KindNumber {
+			return nil, &SyntaxError{Pos: valueTok.pos + 1, Msg: fmt.Sprintf("%s does not support regular expressions", field)}
+		}
+		return regexTerm(field, kind, valueTok, keys...)
+	case tokRange:
+		p.next()
+		return rangeTerm(field, kind, keys, valueTok)
+	default:
+		return nil, &SyntaxError{Pos: tok.end + 1, Msg: fmt.Sprintf("expected a value after %q", tok.text)}
+	}
+}
+
+// resolveField validates a field name, returning the dotted path split into
+// keys for object./extra. fields.
+func resolveField(name string) (string, FieldKind, []string, error) {
+	if kind, ok := fieldKinds[name]; ok {
+		return name, kind, nil, nil
+	}
+	path := strings.Split(name, ".")
+	if len(path) >= 2 && (path[0] == "object" || path[0] == "extra") {
+		for _, key := range path[1:] {
+			if key == "" {
+				return "", 0, nil, fmt.Errorf("field %q has an empty path segment", name)
+			}
+		}
+		return name, KindJSON, path[1:], nil
+	}
+	return "", 0, nil, fmt.Errorf("unknown field %q", name)
+}
+
+// valueTerm interprets the raw value of a word: *, a comparison, a glob or a
+// plain value. pos is the 0-based offset of the value.
+func valueTerm(field string, kind FieldKind, keys []string, raw string, pos int) (Node, error) {
+	term := &Term{Field: field, Kind: kind, Keys: keys, Pos: pos + 1}
+
+	if raw == "*" {
+		term.Op = OpExists
+		return term, nil
+	}
+
+	for _, op := range []string{">=", "<=", ">", "<"} {
+		if !strings.HasPrefix(raw, op) {
+			continue
+		}
+		value := unescape(raw[len(op):])
+		if value == "" {
+			return nil, &SyntaxError{Pos: pos + len(op) + 1, Msg: fmt.Sprintf("expected a value after %q", op)}
+		}
+		bound, err := parseBound(field, kind, value, op == ">=" || op == "<=")
+		if err != nil {
+			return nil, &SyntaxError{Pos: pos + len(op) + 1, Msg: err.Error()}
+		}
+		term.Op = OpRange
+		if op[0] == '>' {
+			term.Low = bound
+		} else {
+			term.High = bound
+		}
+		return term, nil
+	}
+
+	if hasWildcard(raw) {
+		if kind == KindTime || kind == KindNumber {
+			return nil, &SyntaxError{Pos: pos + 1, Msg: fmt.Sprintf("%s does not support wildcards", field)}
+		}
+		// Text fields match anywhere in the value, like plain terms do.
+		anchored := kind != KindText
+		term.Op = OpWildcard
+		term.Regex, term.Like = compileGlob(raw, anchored)
+		return term, nil
+	}
+
+	term.Op = OpMatch
+	term.Value = unescape(raw)
+	if err := checkMatch(term); err != nil {
+		return nil, err
+	}
+	return term, nil
+}
+
+// checkMatch rejects OpMatch terms the field cannot compare.
+func checkMatch(term *Term) error {
+	switch term.Kind {
+	case KindTime:
+		return &SyntaxError{Pos: term.Pos, Msg: "time only supports ranges, e.g. time:>now-1h"}
+	case KindNumber:
+		if _, err := strconv.ParseFloat(term.Value, 64); err != nil {
+			return &SyntaxError{Pos: term.Pos, Msg: fmt.Sprintf("%s needs a number, got %q", term.Field, term.Value)}
+		}
+	}
+	return nil
+}
+
+func regexTerm(field string, kind FieldKind, tok token, keys ...string) (Node, error) {
+	re, err := regexp.Compile(tok.text)
+	if err != nil {
+		return nil, &SyntaxError{Pos: tok.pos + 1, Msg: fmt.Sprintf("invalid regular expression: %v", err)}
+	}
+	return &Term{Field: field, Kind: kind, Keys: keys, Op: OpRegex, Regex: re, Pos: tok.pos + 1}, nil
+}
+
+func rangeTerm(field string, kind FieldKind, keys []string, tok token) (Node, error) {
+	parts := strings.Fields(tok.text)
+	if len(parts) != 3 || parts[1] != "TO" {
+		return nil, &SyntaxError{Pos: tok.pos + 1, Msg: "a range must look like [low TO high]"}
+	}
+
+	term := &Term{Field: field, Kind: kind, Keys: keys, Op: OpRange, Pos: tok.pos + 1}
+	var err error
+	if parts[0] != "*" {
+		if term.Low, err = parseBound(field, kind, parts[0], tok.inclusiveLow); err != nil {
+			return nil, &SyntaxError{Pos: tok.pos + 2, Msg: err.Error()}
+		}
+	}
+	if parts[2] != "*" {
+		if term.High, err = parseBound(field, kind, parts[2], tok.inclusiveHigh); err != nil {
+			return nil, &SyntaxError{Pos: tok.pos + 1, Msg: err.Error()}
+		}
+	}
+	return term, nil
+}
+
+// parseBound parses one end of a range according to the field kind.
+func parseBound(field string, kind FieldKind, value string, inclusive bool) (*Bound, error) {
+	b := &Bound{Value: value, Inclusive: inclusive}
+	switch kind {
+	case KindNumber, KindJSON:
+		n, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s ranges need numbers, got %q", field, value)
+		}
+		b.Number = n
+	case KindTime:
+		t, err := parseTime(value)
+		if err != nil {
+			return nil, err
+		}
+		b.Time = t
+	case KindLevel:
+		level, ok := model.ParseLevel(value)
+		if !ok {
+			return nil, fmt.Errorf("unknown level %q", value)
+		}
+		b.Level = level
+	default:
+		return nil, fmt.Errorf("%s does not support ranges", field)
+	}
+	return b, nil
+}
+
+// parseTime accepts RFC 3339 timestamps, dates (UTC), "now" and "now-<duration>".
+func parseTime(value string) (time.Time, error) {
+	if strings.HasPrefix(value, "now") {
+		if value == "now" {
+			return now(), nil
+		}
+		if d, err := time.ParseDuration(value[len("now-"):]); err == nil && value[3] == '-' {
+			return now().Add(-d), nil
+		}
+		return time.Time{}, fmt.Errorf("invalid relative time %q, use now or now-<duration>", value)
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", time.DateOnly} {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339, a date or now-<duration>", value)
+}
+
+// compileGlob turns a glob into a case-insensitive regexp and a LIKE pattern.
+// Unanchored globs match anywhere in the value.
+func compileGlob(raw string, anchored bool) (*regexp.Regexp, string) {
+	var re, like strings.Builder
+	leadingStar, trailingStar := strings.HasPrefix(raw, "*"), false
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		trailingStar = c == '*'
+		switch {
+		case c == '\\' && i+1 < len(raw):
+			i++
+			re.WriteString(regexp.QuoteMeta(raw[i : i+1]))
+			like.WriteString(likeEscape(raw[i]))
+		case c == '*':
+			re.WriteString(".*")
+			like.WriteByte('%')
+		case c == '?':
+			re.WriteString(".")
+			like.WriteByte('_')
+		default:
+			re.WriteString(regexp.QuoteMeta(raw[i : i+1]))
+			like.WriteString(likeEscape(c))
+		}
+	}
+
+	if anchored {
+		return regexp.MustCompile("(?is)^" + re.String() + "$"), like.String()
+	}
+	pattern := like.String()
+	if !leadingStar {
+		pattern = "%" + pattern
+	}
+	if !trailingStar {
+		pattern += "%"
+	}
+	return regexp.MustCompile("(?is)" + re.String()), pattern
+}
+
+func likeEscape(c byte) string {
+	switch c {
+	case '%', '_', '\\':
+		return `\` + string(c)
+	}
+	return string(c)
+}
+
+func hasWildcard(raw string) bool {
+	return unescapedIndex(raw, '*') >= 0 || unescapedIndex(raw, '?') >= 0
+}
+
+// unescapedIndex returns the index of the first c not preceded by a backslash.
+func unescapedIndex(s string, c byte) int {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case c:
+			return i
+		}
+	}
+	return -1
+}
+
+func unescape(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
@@ -0,0 +1,75 @@
+package query
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`timeout`, `message:"timeout"`},
+		{`"connection reset"`, `message:"connection reset"`},
+		{`level:SEVERE OR error:timeout`, `(level:"SEVERE" OR error:"timeout")`},
+		{`a b OR c`, `((message:"a" AND message:"b") OR message:"c")`},
+		{`a AND (b OR c)`, `(message:"a" AND (message:"b" OR message:"c"))`},
+		{`NOT source:health -error:*`, `(NOT source:"health" AND NOT error:*)`},
+		{`error:/time.?out/`, `error:/time.?out/`},
+		{`source:api-*`, `source:~%api-%`},
+		{`session_id:ab?d`, `session_id:~ab_d`},
+		{`sequence:[10 TO 20}`, `sequence:[10 TO 20}`},
+		{`sequence:{* TO 5]`, `sequence:{* TO 5]`},
+		{`extra.http_status:>=500`, `extra.http_status:[500 TO *}`},
+		{`level:>warn`, `level:{warn TO *}`},
+		{`object.order_id:"A 17"`, `object.order_id:"A 17"`},
+		{`message:a\:b`, `message:"a:b"`},
+		{`time:>=2026-05-01T00:00:00Z`, `time:[2026-05-01T00:00:00Z TO *}`},
+	}
+	for _, tt := range tests {
+		q, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if got := q.String(); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	tests := []struct {
+		in  string
+		pos int
+	}{
+		{``, 1},
+		{`level:SEVERE AND`, 17},
+		{`(a OR b`, 8},
+		{`a)`, 2},
+		{`colour:red`, 1},
+		{`error:"unterminated`, 7},
+		{`error:/(/`, 7},
+		{`sequence:[1 TO`, 10},
+		{`sequence:[1 2]`, 10},
+		{`message:[a TO b]`, 10},
+		{`time:today`, 6},
+		{`sequence:>x`, 11},
+		{`level:>=LOUD`, 9},
+		{`error: x`, 7},
+		{`[1 TO 2]`, 1},
+		{`object..id:1`, 1},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.in)
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Parse(%q): expected syntax error, got %v", tt.in, err)
+			continue
+		}
+		if syntaxErr.Pos != tt.pos {
+			t.Errorf("Parse(%q): expected position %d, got %d (%v)", tt.in, tt.pos, syntaxErr.Pos, err)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package ratelimit
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrLimited is matched by every *LimitError.
+var ErrLimited = errors.New("rate limit exceeded")
+
+// LimitError is returned when a client is over its rate limit or quota.
+type LimitError struct {
+	ClientID string
+	// Reason is one of "entries_per_sec", "bytes_per_sec", "daily_entries" or "daily_bytes".
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("client %s exceeded %s", e.ClientID, e.Reason)
+}
+
+func (e *LimitError) Is(target error) bool {
+	return target == ErrLimited
+}
+
+// Limits configures one client. Zero values mean unlimited.
+type Limits struct {
+	EntriesPerSec float64 `json:"entries_per_sec,omitempty"`
+	BytesPerSec   float64 `json:"bytes_per_sec,omitempty"`
+	// Bursts default to one second worth of the rate.
+	EntriesBurst float64 `json:"entries_burst,omitempty"`
+	BytesBurst   float64 `json:"bytes_burst,omitempty"`
+	// Daily quotas reset at midnight UTC.
+	DailyEntries int64 `json:"daily_entries,omitempty"`
+	DailyBytes   int64 `json:"daily_bytes,omitempty"`
+}
+
+func (l Limits) unlimited() bool {
+	return l == Limits{}
+}
+
+// Config holds the default limits and per-client overrides. An override
+// replaces the defaults for that client entirely.
+type Config struct {
+	Default Limits            `json:"default"`
+	Clients map[string]Limits `json:"clients,omitempty"`
+}
+
+// LoadConfig reads a JSON config file.
+func LoadConfig(path string) (Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read rate limit config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return Config{}, fmt.Errorf("failed to parse rate limit config: %w", err)
+	}
+	return cfg, nil
+}
+
+// ClientStats is reported per client in /status.
+type ClientStats struct {
+	ClientID         string `json:"client_id"`
+	AcceptedEntries  uint64 `json:"accepted_entries"`
+	AcceptedBytes    uint64 `json:"accepted_bytes"`
+	RateLimited      uint64 `json:"rate_limited"`
+	QuotaExceeded    uint64 `json:"quota_exceeded"`
+	DailyEntriesUsed int64  `json:"daily_entries_used"`
+	DailyBytesUsed   int64  `json:"daily_bytes_used"`
+}
+
+// bucket is a token bucket. Requests larger than the burst are let through
+// once the bucket is full and leave it in debt, so oversized batches are
+// slowed down rather than rejected forever.
+type bucket struct {
+	rate, burst float64
+	tokens      float64
+	last        time.Time
+}
+
+func newBucket(rate, burst float64, now time.Time) *bucket {
+	if rate <= 0 {
+		return nil
+	}
+	if burst <= 0 {
+		burst = rate
+	}
+	return &bucket{rate: rate, burst: burst, tokens: burst, last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+// wait returns how long until n tokens can be taken, zero if they can be now.
+func (b *bucket) wait(n float64) time.Duration {
+	need := math.Min(n, b.burst)
+	if b.tokens >= need {
+		return 0
+	}
+	return time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+}
+
+type clientState struct {
+	limits         Limits
+	entries, bytes *bucket
+
+	day             string
+	dayEntries      int64
+	dayBytes        int64
+	acceptedEntries uint64
+	acceptedBytes   uint64
+	rateLimited     uint64
+	quotaExceeded   uint64
+}
+
+// Limiter enforces per-client token-bucket rate limits and daily quotas.
+type Limiter struct {
+	cfg Config
+	now func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*clientState
+}
+
+func NewLimiter(cfg Config) *Limiter {
+	return &Limiter{
+		cfg:     cfg,
+		now:     time.Now,
+		clients: make(map[string]*clientState),
+	}
+}
+
+// Enabled reports whether any limit is configured.
+func (l *Limiter) Enabled() bool {
+	if !l.cfg.Default.unlimited() {
+		return true
+	}
+	for _, limits := range l.cfg.Clients {
+		if !limits.unlimited() {
+			return true
+		}
+	}
+	return false
+}
+
+// Allow records a request of entries and bytes for clientID, or returns a
+// *LimitError without recording anything when it would exceed a limit.
+func (l *Limiter) Allow(clientID string, entries int, bytes int64) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	c := l.client(clientID, now)
+
+	if day := now.UTC().Format(time.DateOnly); day != c.day {
+		c.day, c.dayEntries, c.dayBytes = day, 0, 0
+	}
+	if c.limits.DailyEntries > 0 && c.dayEntries+int64(entries) > c.limits.DailyEntries {
+		c.quotaExceeded++
+		return &LimitError{ClientID: clientID, Reason: "daily_entries", RetryAfter: untilMidnight(now)}
+	}
+	if c.limits.DailyBytes > 0 && c.dayBytes+bytes > c.limits.DailyBytes {
+		c.quotaExceeded++
+		return &LimitError{ClientID: clientID, Reason: "daily_bytes", RetryAfter: untilMidnight(now)}
+	}
+
+	if c.entries != nil {
+		c.entries.refill(now)
+		if wait := c.entries.wait(float64(entries)); wait > 0 {
+			c.rateLimited++
+			return &LimitError{ClientID: clientID, Reason: "entries_per_sec", RetryAfter: wait}
+		}
+	}
+	if c.bytes != nil {
+		c.bytes.refill(now)
+		if wait := c.bytes.wait(float64(bytes)); wait > 0 {
+			c.rateLimited++
+			return &LimitError{ClientID: clientID, Reason: "bytes_per_sec", RetryAfter: wait}
+		}
+	}
+
+	if c.entries != nil {
+		c.entries.tokens -= float64(entries)
+	}
+	if c.bytes != nil {
+		c.bytes.tokens -= float64(bytes)
+	}
+	c.dayEntries += int64(entries)
+	c.dayBytes += bytes
+	c.acceptedEntries += uint64(entries)
+	c.acceptedBytes += uint64(bytes)
+	return nil
+}
+
+// Refund returns what Allow recorded for a request that was then not
+// accepted, e.g. because the broker refused it, so the client is not charged
+// for its retry twice.
+func (l *Limiter) Refund(clientID string, entries int, bytes int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	c, ok := l.clients[clientID]
+	if !ok {
+		return
+	}
+	now := l.now()
+	for _, refund := range []struct {
+		b *bucket
+		n float64
+	}{{c.entries, float64(entries)}, {c.bytes, float64(bytes)}} {
+		if refund.b != nil {
+			refund.b.refill(now)
+			refund.b.tokens = math.Min(refund.b.burst, refund.b.tokens+refund.n)
+		}
+	}
+	// Usage of a previous day has already been reset.
+	if c.day == now.UTC().Format(time.DateOnly) {
+		c.dayEntries = max(0, c.dayEntries-int64(entries))
+		c.dayBytes = max(0, c.dayBytes-bytes)
+	}
+	c.acceptedEntries -= min(c.acceptedEntries, uint64(entries))
+	c.acceptedBytes -= min(c.acceptedBytes, uint64(bytes))
+}
+
+func (l *Limiter) client(clientID string, now time.Time) *clientState {
+	if c, ok := l.clients[clientID]; ok {
+		return c
+	}
+
+	limits, ok := l.cfg.Clients[clientID]
+	if !ok {
+		limits = l.cfg.Default
+	}
+	c := &clientState{
+		limits:  limits,
+		entries: newBucket(limits.EntriesPerSec, limits.EntriesBurst, now),
+		bytes:   newBucket(limits.BytesPerSec, limits.BytesBurst, now),
+	}
+	l.clients[clientID] = c
+	return c
+}
+
+// Stats returns counters for every client seen so far, sorted by client ID.
+func (l *Limiter) Stats() []ClientStats {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	today := l.now().UTC().Format(time.DateOnly)
+	stats := make([]ClientStats, 0, len(l.clients))
+	for id, c := range l.clients {
+		s := ClientStats{
+			ClientID:        id,
+			AcceptedEntries: c.acceptedEntries,
+			AcceptedBytes:   c.acceptedBytes,
+			RateLimited:     c.rateLimited,
+			QuotaExceeded:   c.quotaExceeded,
+		}
+		if c.day == today {
+			s.DailyEntriesUsed, s.DailyBytesUsed = c.dayEntries, c.dayBytes
+		}
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool { return stats[i].ClientID < stats[j].ClientID })
+	return stats
+}
+
+func untilMidnight(now time.Time) time.Duration {
+	now = now.UTC()
+	midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	return midnight.Sub(now)
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter_TokenBucket(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(Config{
+		Default: Limits{EntriesPerSec: 10},
+		Clients: map[string]Limits{"big": {EntriesPerSec: 100}},
+	})
+	l.now = func() time.Time { return now }
+
+	if err := l.Allow("app", 10, 0); err != nil {
+		t.Fatalf("Expected burst of 10 to be allowed, got %v", err)
+	}
+	err := l.Allow("app", 1, 0)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Reason != "entries_per_sec" {
+		t.Fatalf("Expected entries_per_sec limit, got %v", err)
+	}
+	if !errors.Is(err, ErrLimited) {
+		t.Error("Expected LimitError to match ErrLimited")
+	}
+	if limitErr.RetryAfter != 100*time.Millisecond {
+		t.Errorf("Expected RetryAfter 100ms, got %v", limitErr.RetryAfter)
+	}
+
+	// Other clients have their own buckets and overrides.
+	if err := l.Allow("big", 50, 0); err != nil {
+		t.Errorf("Expected override to allow 50, got %v", err)
+	}
+
+	// Tokens refill over time.
+	now = now.Add(500 * time.Millisecond)
+	if err := l.Allow("app", 5, 0); err != nil {
+		t.Errorf("Expected refilled tokens, got %v", err)
+	}
+
+	// Batches larger than the burst get through once the bucket is full.
+	now = now.Add(time.Second)
+	if err := l.Allow("app", 25, 0); err != nil {
+		t.Errorf("Expected oversized batch on a full bucket, got %v", err)
+	}
+	now = now.Add(time.Second)
+	if err := l.Allow("app", 1, 0); err == nil {
+		t.Error("Expected bucket to still be in debt")
+	}
+}
+
+func TestLimiter_DailyQuota(t *testing.T) {
+	now := time.Date(2026, 5, 1, 23, 0, 0, 0, time.UTC)
+	l := NewLimiter(Config{Default: Limits{DailyBytes: 1000}})
+	l.now = func() time.Time { return now }
+
+	if err := l.Allow("app", 1, 800); err != nil {
+		t.Fatalf("Expected first request to fit the quota, got %v", err)
+	}
+	err := l.Allow("app", 1, 300)
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Reason != "daily_bytes" || limitErr.RetryAfter != time.Hour {
+		t.Fatalf("Expected daily_bytes limit until midnight, got %v", err)
+	}
+
+	stats := l.Stats()
+	if len(stats) != 1 || stats[0].AcceptedBytes != 800 || stats[0].QuotaExceeded != 1 || stats[0].DailyBytesUsed != 800 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+
+	// The quota resets the next day.
+	now = now.Add(time.Hour)
+	if err := l.Allow("app", 1, 300); err != nil {
+		t.Errorf("Expected quota to reset, got %v", err)
+	}
+}
+
+func TestLimiter_Refund(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	l := NewLimiter(Config{Default: Limits{EntriesPerSec: 10, DailyBytes: 1000}})
+	l.now = func() time.Time { return now }
+
+	if err := l.Allow("app", 10, 600); err != nil {
+		t.Fatalf("Expected request to be allowed, got %v", err)
+	}
+	l.Refund("app", 10, 600)
+
+	// The refunded request can be retried right away.
+	if err := l.Allow("app", 10, 600); err != nil {
+		t.Errorf("Expected the retry to be allowed after a refund, got %v", err)
+	}
+	stats := l.Stats()
+	if stats[0].AcceptedEntries != 10 || stats[0].DailyBytesUsed != 600 {
+		t.Errorf("Expected only the retry to be counted, got %+v", stats[0])
+	}
+}
@@ -0,0 +1,303 @@
+// Package retention deletes old file backend logs.
+package retention
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/segment"
+)
+
+// Config is the retention policy. Zero values mean unlimited.
+type Config struct {
+	// MaxAge deletes files not written to for this long.
+	MaxAge time.Duration
+	// MaxBytes deletes the least recently written files until the directory
+	// is at most this size.
+	MaxBytes int64
+	// Clients overrides MaxAge for files of these clients; zero keeps their
+	// files regardless of age.
+	Clients map[string]time.Duration
+	// DryRun only logs and counts what would be deleted.
+	DryRun bool
+}
+
+// Enabled reports whether any limit is configured.
+func (c Config) Enabled() bool {
+	if c.MaxAge > 0 || c.MaxBytes > 0 {
+		return true
+	}
+	for _, age := range c.Clients {
+		if age > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseClientAges parses "client-a=720h,client-b=24h".
+func ParseClientAges(s string) (map[string]time.Duration, error) {
+	ages := make(map[string]time.Duration)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		client, ageStr, ok := strings.Cut(pair, "=")
+		if !ok || client == "" {
+			return nil, fmt.Errorf("client max age %q must be client=duration", pair)
+		}
+		age, err := time.ParseDuration(ageStr)
+		if err != nil || age < 0 {
+			return nil, fmt.Errorf("client max age %q: invalid duration %q", pair, ageStr)
+		}
+		ages[client] = age
+	}
+	return ages, nil
+}
+
+// ClientStats is the share of one client in the directory.
+type ClientStats struct {
+	ClientID     string `json:"client_id"`
+	Files        int    `json:"files"`
+	Bytes        int64  `json:"bytes"`
+	DeletedFiles uint64 `json:"deleted_files"`
+	DeletedBytes uint64 `json:"deleted_bytes"`
+}
+
+// Stats is reported in /status. Deleted counters are totals since start; in
+// dry-run mode they count what each pass would have deleted.
+type Stats struct {
+	DryRun       bool          `json:"dry_run"`
+	LastRun      time.Time     `json:"last_run,omitzero"`
+	Files        int           `json:"files"`
+	Bytes        int64         `json:"bytes"`
+	DeletedFiles uint64        `json:"deleted_files"`
+	DeletedBytes uint64        `json:"deleted_bytes"`
+	LastError    string        `json:"last_error,omitempty"`
+	Clients      []ClientStats `json:"clients,omitempty"`
+}
+
+// Manager enforces a Config on a log directory.
+type Manager struct {
+	dir string
+	cfg Config
+	now func() time.Time
+
+	mu    sync.Mutex
+	stats Stats
+	// owners caches the client of each file, read from its first entry.
+	owners  map[string]string
+	clients map[string]*ClientStats
+}
+
+func NewManager(dir string, cfg Config) *Manager {
+	return &Manager{
+		dir:     dir,
+		cfg:     cfg,
+		now:     time.Now,
+		stats:   Stats{DryRun: cfg.DryRun},
+		owners:  make(map[string]string),
+		clients: make(map[string]*ClientStats),
+	}
+}
+
+// Run enforces the policy every interval until ctx is done.
+func (m *Manager) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Enforce(); err != nil {
+			log.Printf("Retention failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+type logFile struct {
+	name    string
+	client  string
+	size    int64
+	modTime time.Time
+}
+
+// Enforce runs one pass: first files past their client's max age are deleted,
+// then the least recently written ones until the directory fits MaxBytes.
+func (m *Manager) Enforce() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stats.LastError = ""
+	files, err := m.scan()
+	if err != nil {
+		m.stats.LastError = err.Error()
+		return err
+	}
+	now := m.now()
+	gone := make(map[string]bool)
+
+	var kept []logFile
+	var total int64
+	for _, f := range files {
+		maxAge, ok := m.cfg.Clients[f.client]
+		if !ok {
+			maxAge = m.cfg.MaxAge
+		}
+		if maxAge > 0 && now.Sub(f.modTime) > maxAge {
+			if m.delete(f, fmt.Sprintf("older than %s", maxAge)) {
+				gone[f.name] = true
+				continue
+			}
+		}
+		kept = append(kept, f)
+		total += f.size
+	}
+
+	if m.cfg.MaxBytes > 0 && total > m.cfg.MaxBytes {
+		sort.Slice(kept, func(i, j int) bool { return kept[i].modTime.Before(kept[j].modTime) })
+		for _, f := range kept {
+			if total <= m.cfg.MaxBytes {
+				break
+			}
+			if m.delete(f, fmt.Sprintf("directory over %d bytes", m.cfg.MaxBytes)) {
+				gone[f.name] = true
+				total -= f.size
+			}
+		}
+	}
+
+	if m.cfg.DryRun {
+		gone = nil // nothing was actually removed
+	}
+	m.record(files, gone, now)
+	return nil
+}
+
+// scan lists the log segments, compressed or not, with their owners.
+func (m *Manager) scan() ([]logFile, error) {
+	if _, err := os.Stat(m.dir); os.IsNotExist(err) {
+		return nil, nil // nothing written yet
+	}
+	segments, err := segment.List(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	var files []logFile
+	seen := make(map[string]bool)
+	for _, seg := range segments {
+		info, err := os.Stat(filepath.Join(m.dir, seg.File))
+		if err != nil {
+			continue // removed meanwhile
+		}
+		seen[seg.File] = true
+		files = append(files, logFile{name: seg.File, client: m.owner(seg), size: info.Size(), modTime: info.ModTime()})
+	}
+	for name := range m.owners {
+		if !seen[name] {
+			delete(m.owners, name)
+		}
+	}
+	return files, nil
+}
+
+// owner returns the client_id of the first entry of the file.
+func (m *Manager) owner(seg segment.Info) string {
+	if client, ok := m.owners[seg.File]; ok {
+		return client
+	}
+	r, err := segment.Open(m.dir, seg)
+	if err != nil {
+		return ""
+	}
+	defer r.Close()
+
+	reader := bufio.NewReaderSize(r, 64*1024)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return "" // empty or still being written; try again next pass
+	}
+	var entry struct {
+		ClientID string `json:"client_id"`
+	}
+	json.Unmarshal(line, &entry)
+	m.owners[seg.File] = entry.ClientID
+	return entry.ClientID
+}
+
+// delete removes f, or only logs it in dry-run mode, and reports whether the
+// file counts as gone.
+func (m *Manager) delete(f logFile, reason string) bool {
+	if m.cfg.DryRun {
+		log.Printf("Retention (dry run): would delete %s (%d bytes, %s)", f.name, f.size, reason)
+	} else {
+		if err := os.Remove(filepath.Join(m.dir, f.name)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Retention: failed to delete %s: %v", f.name, err)
+			m.stats.LastError = err.Error()
+			return false
+		}
+		log.Printf("Retention: deleted %s (%d bytes, %s)", f.name, f.size, reason)
+		delete(m.owners, f.name)
+	}
+
+	m.stats.DeletedFiles++
+	m.stats.DeletedBytes += uint64(f.size)
+	c := m.client(f.client)
+	c.DeletedFiles++
+	c.DeletedBytes += uint64(f.size)
+	return true
+}
+
+func (m *Manager) client(clientID string) *ClientStats {
+	c, ok := m.clients[clientID]
+	if !ok {
+		c = &ClientStats{ClientID: clientID}
+		m.clients[clientID] = c
+	}
+	return c
+}
+
+// record updates the directory totals after a pass from the files that are
+// still there.
+func (m *Manager) record(files []logFile, gone map[string]bool, now time.Time) {
+	for _, c := range m.clients {
+		c.Files, c.Bytes = 0, 0
+	}
+	m.stats.Files, m.stats.Bytes = 0, 0
+	for _, f := range files {
+		if gone[f.name] {
+			continue
+		}
+		c := m.client(f.client)
+		c.Files++
+		c.Bytes += f.size
+		m.stats.Files++
+		m.stats.Bytes += f.size
+	}
+	m.stats.LastRun = now
+}
+
+// Stats returns a snapshot of the retention counters.
+func (m *Manager) Stats() Stats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	stats := m.stats
+	stats.Clients = make([]ClientStats, 0, len(m.clients))
+	for _, c := range m.clients {
+		stats.Clients = append(stats.Clients, *c)
+	}
+	sort.Slice(stats.Clients, func(i, j int) bool { return stats.Clients[i].ClientID < stats.Clients[j].ClientID })
+	return stats
+}
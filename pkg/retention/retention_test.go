@@ -0,0 +1,131 @@
+package retention
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeFile creates a log file of client with size bytes, last written age
+// before now.
+func writeFile(t *testing.T, dir, name, client string, size int, now time.Time, age time.Duration) {
+	t.Helper()
+	line := fmt.Sprintf("{\"client_id\":%q,\"message\":\"x\"}\n", client)
+	data := line + strings.Repeat("x", size-len(line))
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	modTime := now.Add(-age)
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set mtime of %s: %v", name, err)
+	}
+}
+
+func exists(dir, name string) bool {
+	_, err := os.Stat(filepath.Join(dir, name))
+	return err == nil
+}
+
+func newTestManager(dir string, cfg Config, now time.Time) *Manager {
+	m := NewManager(dir, cfg)
+	m.now = func() time.Time { return now }
+	return m
+}
+
+func TestManager_MaxAge(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeFile(t, dir, "session_old.log", "client-a", 100, now, 48*time.Hour)
+	writeFile(t, dir, "session_new.log", "client-a", 100, now, time.Hour)
+	writeFile(t, dir, "session_vip.log", "client-vip", 100, now, 48*time.Hour)
+	writeFile(t, dir, "session_short.log", "client-short", 100, now, 2*time.Hour)
+
+	m := newTestManager(dir, Config{
+		MaxAge:  24 * time.Hour,
+		Clients: map[string]time.Duration{"client-vip": 0, "client-short": time.Hour},
+	}, now)
+	if err := m.Enforce(); err != nil {
+		t.Fatalf("Enforce failed: %v", err)
+	}
+
+	for name, want := range map[string]bool{
+		"session_old.log":   false,
+		"session_new.log":   true,
+		"session_vip.log":   true,
+		"session_short.log": false,
+	} {
+		if got := exists(dir, name); got != want {
+			t.Errorf("%s exists = %v, want %v", name, got, want)
+		}
+	}
+
+	stats := m.Stats()
+	if stats.Files != 2 || stats.Bytes != 200 || stats.DeletedFiles != 2 || stats.DeletedBytes != 200 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if len(stats.Clients) != 3 || stats.Clients[0].ClientID != "client-a" || stats.Clients[0].DeletedFiles != 1 || stats.Clients[0].Files != 1 {
+		t.Errorf("Unexpected client stats: %+v", stats.Clients)
+	}
+}
+
+func TestManager_MaxBytes(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeFile(t, dir, "session_1.log", "client-a", 100, now, 3*time.Hour)
+	writeFile(t, dir, "session_2.log", "client-a", 100, now, 2*time.Hour)
+	writeFile(t, dir, "session_3.log", "client-b", 100, now, time.Hour)
+
+	m := newTestManager(dir, Config{MaxBytes: 250}, now)
+	if err := m.Enforce(); err != nil {
+		t.Fatalf("Enforce failed: %v", err)
+	}
+
+	if exists(dir, "session_1.log") {
+		t.Errorf("Expected the least recently written file to be deleted")
+	}
+	if !exists(dir, "session_2.log") || !exists(dir, "session_3.log") {
+		t.Errorf("Expected the newer files to be kept")
+	}
+	if stats := m.Stats(); stats.Files != 2 || stats.Bytes != 200 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestManager_DryRun(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeFile(t, dir, "session_old.log", "client-a", 100, now, 48*time.Hour)
+
+	m := newTestManager(dir, Config{MaxAge: time.Hour, DryRun: true}, now)
+	if err := m.Enforce(); err != nil {
+		t.Fatalf("Enforce failed: %v", err)
+	}
+
+	if !exists(dir, "session_old.log") {
+		t.Errorf("Dry run deleted a file")
+	}
+	stats := m.Stats()
+	if !stats.DryRun || stats.DeletedFiles != 1 || stats.Files != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+}
+
+func TestParseClientAges(t *testing.T) {
+	ages, err := ParseClientAges("client-a=720h, client-b=0s")
+	if err != nil {
+		t.Fatalf("ParseClientAges failed: %v", err)
+	}
+	if ages["client-a"] != 720*time.Hour || len(ages) != 2 {
+		t.Errorf("Unexpected ages: %v", ages)
+	}
+
+	for _, s := range []string{"client-a", "=1h", "client-a=soon", "client-a=-1h"} {
+		if _, err := ParseClientAges(s); err == nil {
+			t.Errorf("Expected error for %q", s)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package segment names, lists and opens the session log files written by the
+// file subscriber.
+//
+// A session is written to numbered segments, session_<id>.000001.log,
+// session_<id>.000002.log and so on. Closed segments may be compressed, which
+// appends .gz or .zst to the name. Files from before rotation existed,
+// session_<id>.log, are segment 0 of their session.
+package segment
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression is the codec of closed segments.
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// ParseCompression accepts gzip, zstd and none; empty means none.
+func ParseCompression(s string) (Compression, error) {
+	switch c := Compression(s); c {
+	case "", "none":
+		return CompressionNone, nil
+	case CompressionGzip, CompressionZstd:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown compression %q (expected gzip, zstd or none)", s)
+}
+
+// Ext returns the file name suffix of the codec.
+func (c Compression) Ext() string {
+	switch c {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// Name returns the file name of segment seq of a session.
+func Name(sessionID string, seq int) string {
+	return fmt.Sprintf("session_%s.%06d.log", sessionID, seq)
+}
+
+// Info describes a segment file.
+type Info struct {
+	// File is the name on disk.
+	File string
+	// Name is File without the compression suffix. Offsets into a segment
+	// are offsets into its uncompressed content, so Name and an offset keep
+	// pointing at the same line after the segment is compressed.
+	Name        string
+	Session     string
+	Seq         int
+	Compression Compression
+}
+
+// Parse reports whether file is a log segment and describes it.
+func Parse(file string) (Info, bool) {
+	info := Info{File: file, Name: file}
+	for _, c := range []Compression{CompressionGzip, CompressionZstd} {
+		if strings.HasSuffix(file, ".log"+c.Ext()) {
+			info.Name = strings.TrimSuffix(file, c.Ext())
+			info.Compression = c
+		}
+	}
+	base, ok := strings.CutSuffix(info.Name, ".log")
+	if !ok {
+		return Info{}, false
+	}
+	info.Session = base
+	if i := strings.LastIndexByte(base, '.'); i >= 0 && len(base)-i-1 == 6 {
+		if seq, err := strconv.Atoi(base[i+1:]); err == nil && seq >= 0 {
+			info.Session, info.Seq = base[:i], seq
+		}
+	}
+	return info, true
+}
+
+// List returns the segments in dir, by session and then in write order.
+// While a segment is being compressed both files exist briefly; the
+// uncompressed one is listed.
+func List(dir string) ([]Info, error) {
+	return list(dir, "")
+}
+
+// Session returns the segments of one session in write order.
+func Session(dir, sessionID string) ([]Info, error) {
+	return list(dir, "session_"+sessionID)
+}
+
+// list lists the segments of session, or of all sessions when it is empty.
+func list(dir, session string) ([]Info, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log directory: %w", err)
+	}
+	byName := make(map[string]Info)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasPrefix(entry.Name(), session) {
+			continue
+		}
+		info, ok := Parse(entry.Name())
+		if !ok || (session != "" && info.Session != session) {
+			continue
+		}
+		if prev, ok := byName[info.Name]; ok && prev.Compression == CompressionNone {
+			continue
+		}
+		byName[info.Name] = info
+	}
+
+	infos := make([]Info, 0, len(byName))
+	for _, info := range byName {
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		if infos[i].Session != infos[j].Session {
+			return infos[i].Session < infos[j].Session
+		}
+		return infos[i].Seq < infos[j].Seq
+	})
+	return infos, nil
+}
+
+// Open opens a segment for reading its uncompressed content. If an
+// uncompressed segment has been compressed since it was listed, the
+// compressed file is opened instead.
+func Open(dir string, info Info) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Join(dir, info.File))
+	if os.IsNotExist(err) && info.Compression == CompressionNone {
+		for _, c := range []Compression{CompressionGzip, CompressionZstd} {
+			compressed := Info{File: info.Name + c.Ext(), Name: info.Name, Session: info.Session, Seq: info.Seq, Compression: c}
+			if r, cerr := Open(dir, compressed); !os.IsNotExist(cerr) {
+				return r, cerr
+			}
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch info.Compression {
+	case CompressionGzip:
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to read gzip segment %s: %w", info.File, err)
+		}
+		return readCloser{Reader: zr, close: func() error { zr.Close(); return f.Close() }}, nil
+	case CompressionZstd:
+		zr, err := zstd.NewReader(f, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			f.Close()
+			return nil, fmt.Errorf("failed to read zstd segment %s: %w", info.File, err)
+		}
+		return readCloser{Reader: zr, close: func() error { zr.Close(); return f.Close() }}, nil
+	}
+	return f, nil
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r readCloser) Close() error {
+	return r.close()
+}
+
+// Compress writes a compressed copy of the uncompressed segment file in dir
+// and then removes the original. The copy is written under a temporary name
+// and renamed once synced, so readers never see a partial segment.
+func Compress(dir, file string, c Compression) (err error) {
+	if c == CompressionNone {
+		return nil
+	}
+	src, err := os.Open(filepath.Join(dir, file))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst := filepath.Join(dir, file+c.Ext())
+	tmp, err := os.CreateTemp(dir, file+c.Ext()+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create compressed segment: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	var w io.WriteCloser
+	if c == CompressionGzip {
+		w = gzip.NewWriter(tmp)
+	} else if w, err = zstd.NewWriter(tmp); err != nil {
+		return fmt.Errorf("failed to create zstd writer: %w", err)
+	}
+	if _, err = io.Copy(w, src); err != nil {
+		return fmt.Errorf("failed to compress segment %s: %w", file, err)
+	}
+	if err = w.Close(); err != nil {
+		return fmt.Errorf("failed to compress segment %s: %w", file, err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("failed to sync compressed segment: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close compressed segment: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), dst); err != nil {
+		return fmt.Errorf("failed to rename compressed segment: %w", err)
+	}
+	return os.Remove(filepath.Join(dir, file))
+}
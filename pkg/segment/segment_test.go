@@ -0,0 +1,144 @@
+package segment
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		file string
+		want Info
+		ok   bool
+	}{
+		{"session_abc.log", Info{File: "session_abc.log", Name: "session_abc.log", Session: "session_abc"}, true},
+		{"session_abc.000012.log", Info{File: "session_abc.000012.log", Name: "session_abc.000012.log", Session: "session_abc", Seq: 12}, true},
+		{"session_abc.000012.log.gz", Info{File: "session_abc.000012.log.gz", Name: "session_abc.000012.log", Session: "session_abc", Seq: 12, Compression: CompressionGzip}, true},
+		{"session_abc.000003.log.zst", Info{File: "session_abc.000003.log.zst", Name: "session_abc.000003.log", Session: "session_abc", Seq: 3, Compression: CompressionZstd}, true},
+		{"session_a.b.log", Info{File: "session_a.b.log", Name: "session_a.b.log", Session: "session_a.b"}, true},
+		{"session_abc.log.gz.123.tmp", Info{}, false},
+		{"notes.txt", Info{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := Parse(tt.file)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("Parse(%q) = %+v, %v, want %+v, %v", tt.file, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"session_b.000002.log",
+		"session_b.000010.log.gz",
+		"session_b.000001.log.zst",
+		"session_a.000001.log",
+		"session_a.000001.log.gz", // compression in progress
+		"session_a.log",
+		"session_a.000002.log.gz.42.tmp",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	infos, err := List(dir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var got []string
+	for _, info := range infos {
+		got = append(got, info.File)
+	}
+	want := []string{"session_a.log", "session_a.000001.log", "session_b.000001.log.zst", "session_b.000002.log", "session_b.000010.log.gz"}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Expected %v, got %v", want, got)
+			break
+		}
+	}
+
+	infos, err = Session(dir, "b")
+	if err != nil || len(infos) != 3 || infos[2].File != "session_b.000010.log.gz" {
+		t.Errorf("Expected the 3 segments of session b, got %v (%v)", infos, err)
+	}
+}
+
+func TestCompress(t *testing.T) {
+	content := `{"message":"one"}` + "\n" + `{"message":"two"}` + "\n"
+	for _, c := range []Compression{CompressionGzip, CompressionZstd} {
+		dir := t.TempDir()
+		name := Name("s1", 1)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write segment: %v", err)
+		}
+
+		if err := Compress(dir, name, c); err != nil {
+			t.Fatalf("Compress(%s) failed: %v", c, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be removed after %s compression", name, c)
+		}
+
+		infos, err := List(dir)
+		if err != nil || len(infos) != 1 {
+			t.Fatalf("Expected one segment, got %v (%v)", infos, err)
+		}
+		if infos[0].Name != name || infos[0].Compression != c {
+			t.Errorf("Unexpected segment %+v", infos[0])
+		}
+		r, err := Open(dir, infos[0])
+		if err != nil {
+			t.Fatalf("Open failed: %v", err)
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil || string(data) != content {
+			t.Errorf("Expected %q after %s round trip, got %q (%v)", content, c, data, err)
+		}
+	}
+}
+
+func TestOpen_CompressedSinceListed(t *testing.T) {
+	dir := t.TempDir()
+	name := Name("s1", 1)
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("line\n"), 0644); err != nil {
+		t.Fatalf("Failed to write segment: %v", err)
+	}
+	infos, _ := List(dir)
+	if err := Compress(dir, name, CompressionZstd); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+
+	r, err := Open(dir, infos[0])
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "line\n" {
+		t.Errorf("Expected the compressed content, got %q", data)
+	}
+
+	os.Remove(filepath.Join(dir, name+".zst"))
+	if _, err := Open(dir, infos[0]); !os.IsNotExist(err) {
+		t.Errorf("Expected not-exist for a removed segment, got %v", err)
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	for s, want := range map[string]Compression{"": CompressionNone, "none": CompressionNone, "gzip": CompressionGzip, "zstd": CompressionZstd} {
+		if got, err := ParseCompression(s); err != nil || got != want {
+			t.Errorf("ParseCompression(%q) = %q, %v", s, got, err)
+		}
+	}
+	if _, err := ParseCompression("lz4"); err == nil {
+		t.Errorf("Expected error for lz4")
+	}
+}
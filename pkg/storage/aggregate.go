@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+// Dimension is an entry field counts can be grouped by.
+type Dimension string
+
+const (
+	DimensionLevel      Dimension = "level"
+	DimensionSource     Dimension = "source"
+	DimensionClientID   Dimension = "client_id"
+	DimensionLoggerName Dimension = "logger_name"
+)
+
+// ParseDimension accepts the Dimension names; empty means no grouping.
+func ParseDimension(s string) (Dimension, error) {
+	switch d := Dimension(s); d {
+	case "", DimensionLevel, DimensionSource, DimensionClientID, DimensionLoggerName:
+		return d, nil
+	}
+	return "", fmt.Errorf("unknown group_by %q (expected level, source, client_id or logger_name)", s)
+}
+
+// Value returns the entry's value for the dimension. Levels are normalised so
+// aliases count towards their canonical level.
+func (d Dimension) Value(entry model.LogEntry) string {
+	switch d {
+	case DimensionLevel:
+		return string(model.NormalizeLevel(entry.Level))
+	case DimensionSource:
+		return entry.Source
+	case DimensionClientID:
+		return entry.ClientID
+	case DimensionLoggerName:
+		return entry.LoggerName
+	}
+	return ""
+}
+
+// AggregateParams selects what to count. Paging and context fields of the
+// filter are ignored.
+type AggregateParams struct {
+	Filter QueryParams
+	// Interval is the bucket width, in whole seconds. Zero counts everything in
+	// a single bucket.
+	Interval time.Duration
+	// GroupBy splits each bucket by a dimension; empty means no split.
+	GroupBy Dimension
+}
+
+// Bucket is the number of matching entries in one time bucket and group.
+type Bucket struct {
+	// Time is the start of the bucket, zero without an interval.
+	Time  time.Time `json:"time,omitzero"`
+	Group string    `json:"group,omitempty"`
+	Count uint64    `json:"count"`
+}
+
+// Aggregator is implemented by stores that can count matching entries.
+type Aggregator interface {
+	Aggregate(ctx context.Context, params AggregateParams) ([]Bucket, error)
+}
+
+// BucketStart returns the start of the interval containing t, aligned to the
+// Unix epoch like ClickHouse's toStartOfInterval.
+func BucketStart(t time.Time, interval time.Duration) time.Time {
+	if interval <= 0 {
+		return time.Time{}
+	}
+	sec := int64(interval / time.Second)
+	unix := t.Unix()
+	start := unix - unix%sec
+	if unix < 0 && unix%sec != 0 {
+		start -= sec
+	}
+	return time.Unix(start, 0).UTC()
+}
+
+type bucketKey struct {
+	time  time.Time
+	group string
+}
+
+// BucketCounter sums counts per bucket and group.
+type BucketCounter struct {
+	counts map[bucketKey]uint64
+}
+
+func NewBucketCounter() *BucketCounter {
+	return &BucketCounter{counts: make(map[bucketKey]uint64)}
+}
+
+func (c *BucketCounter) Add(t time.Time, group string, n uint64) {
+	c.counts[bucketKey{time: t.UTC(), group: group}] += n
+}
+
+// Buckets returns the counts ordered by time, then group.
+func (c *BucketCounter) Buckets() []Bucket {
+	buckets := make([]Bucket, 0, len(c.counts))
+	for k, n := range c.counts {
+		buckets = append(buckets, Bucket{Time: k.time, Group: k.group, Count: n})
+	}
+	sort.Slice(buckets, func(i, j int) bool {
+		if !buckets[i].Time.Equal(buckets[j].Time) {
+			return buckets[i].Time.Before(buckets[j].Time)
+		}
+		return buckets[i].Group < buckets[j].Group
+	})
+	return buckets
+}
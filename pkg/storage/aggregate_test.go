@@ -0,0 +1,59 @@
+package storage
+
+import (
+	"testing"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+func TestBucketStart(t *testing.T) {
+	ts := time.Date(2024, 1, 1, 12, 34, 56, 789, time.FixedZone("IST", 19800))
+	if got := BucketStart(ts, time.Hour); !got.Equal(time.Date(2024, 1, 1, 7, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected 07:00 UTC, got %v", got)
+	}
+	if got := BucketStart(ts, 0); !got.IsZero() {
+		t.Errorf("Expected the zero time without an interval, got %v", got)
+	}
+}
+
+func TestBucketCounter(t *testing.T) {
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewBucketCounter()
+	c.Add(base.Add(time.Minute), "INFO", 1)
+	c.Add(base, "SEVERE", 2)
+	c.Add(base.In(time.FixedZone("IST", 19800)), "SEVERE", 3)
+	c.Add(base, "INFO", 1)
+
+	want := []Bucket{
+		{Time: base, Group: "INFO", Count: 1},
+		{Time: base, Group: "SEVERE", Count: 5},
+		{Time: base.Add(time.Minute), Group: "INFO", Count: 1},
+	}
+	got := c.Buckets()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d buckets, got %+v", len(want), got)
+	}
+	for i := range want {
+		if !got[i].Time.Equal(want[i].Time) || got[i].Group != want[i].Group || got[i].Count != want[i].Count {
+			t.Errorf("Bucket %d: expected %+v, got %+v", i, want[i], got[i])
+		}
+	}
+}
+
+func TestDimensionValue(t *testing.T) {
+	entry := model.LogEntry{Level: "error", Source: "api", ClientID: "client-a", LoggerName: "db"}
+	for d, want := range map[Dimension]string{
+		DimensionLevel:      "SEVERE",
+		DimensionSource:     "api",
+		DimensionClientID:   "client-a",
+		DimensionLoggerName: "db",
+	} {
+		if got := d.Value(entry); got != want {
+			t.Errorf("%s: expected %q, got %q", d, want, got)
+		}
+	}
+	if _, err := ParseDimension("message"); err == nil {
+		t.Error("Expected an unknown dimension to be rejected")
+	}
+}
@@ -0,0 +1,160 @@
+package clickhouse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/query"
+	"github.com/predatorx7/logtopus/pkg/storage"
+)
+
+// compileQuery translates a parsed query into a WHERE expression with
+// positional arguments, mirroring query.Query.Match.
+func compileQuery(n query.Node) (string, []interface{}) {
+	switch n := n.(type) {
+	case *query.BinaryExpr:
+		left, leftArgs := compileQuery(n.Left)
+		right, rightArgs := compileQuery(n.Right)
+		return "(" + left + " " + string(n.Op) + " " + right + ")", append(leftArgs, rightArgs...)
+	case *query.NotExpr:
+		expr, args := compileQuery(n.Expr)
+		return "NOT (" + expr + ")", args
+	case *query.Term:
+		return compileTerm(n)
+	}
+	return "1=0", nil
+}
+
+func compileTerm(t *query.Term) (string, []interface{}) {
+	switch t.Kind {
+	case query.KindJSON:
+		return compileJSONTerm(t)
+	case query.KindTime:
+		if t.Op == query.OpExists {
+			return "1=1", nil
+		}
+		return rangeClause("timestamp", t, func(b *query.Bound) interface{} { return b.Time })
+	case query.KindNumber:
+		switch t.Op {
+		case query.OpExists:
+			return "1=1", nil
+		case query.OpMatch:
+			n, _ := strconv.ParseFloat(t.Value, 64)
+			return "sequence = ?", []interface{}{n}
+		}
+		return rangeClause("sequence", t, func(b *query.Bound) interface{} { return b.Number })
+	case query.KindLevel:
+		switch t.Op {
+		case query.OpRange:
+			return levelIn(model.LevelNames(t.Levels()...))
+		case query.OpMatch:
+			if level, ok := model.ParseLevel(t.Value); ok {
+				return levelIn(model.LevelNames(level))
+			}
+		}
+	}
+	return stringClause(t.Field, t)
+}
+
+// stringClause applies a term to a String column.
+func stringClause(column string, t *query.Term) (string, []interface{}) {
+	switch t.Op {
+	case query.OpExists:
+		return column + " != ''", nil
+	case query.OpRegex:
+		return "match(" + column + ", ?)", []interface{}{t.Regex.String()}
+	case query.OpWildcard:
+		return column + " ILIKE ?", []interface{}{t.Like}
+	}
+	if t.Kind == query.KindText {
+		return "positionCaseInsensitiveUTF8(" + column + ", ?) > 0", []interface{}{t.Value}
+	}
+	return "lower(" + column + ") = lower(?)", []interface{}{t.Value}
+}
+
+// rangeClause bounds column by the term's Low and High.
+func rangeClause(column string, t *query.Term, value func(*query.Bound) interface{}) (string, []interface{}) {
+	var clauses []string
+	var args []interface{}
+	if t.Low != nil {
+		op := ">"
+		if t.Low.Inclusive {
+			op = ">="
+		}
+		clauses = append(clauses, column+" "+op+" ?")
+		args = append(args, value(t.Low))
+	}
+	if t.High != nil {
+		op := "<"
+		if t.High.Inclusive {
+			op = "<="
+		}
+		clauses = append(clauses, column+" "+op+" ?")
+		args = append(args, value(t.High))
+	}
+	if len(clauses) == 0 {
+		return "1=1", nil
+	}
+	return "(" + strings.Join(clauses, " AND ") + ")", args
+}
+
+// compileJSONTerm reuses the field filter translation for object and extra
+// paths, adding glob and regex matching on string values.
+func compileJSONTerm(t *query.Term) (string, []interface{}) {
+	root, _, _ := strings.Cut(t.Field, ".")
+	filter := storage.FieldFilter{Root: root, Keys: t.Keys}
+
+	switch t.Op {
+	case query.OpExists:
+		filter.Op = storage.FieldExists
+		return fieldClause(filter)
+	case query.OpMatch:
+		filter.Op = storage.FieldEquals
+		filter.Value = t.Value
+		if n, err := strconv.ParseFloat(t.Value, 64); err == nil {
+			filter.Number, filter.IsNumeric = n, true
+		}
+		return fieldClause(filter)
+	case query.OpRange:
+		var clauses []string
+		var args []interface{}
+		for _, b := range []struct {
+			bound              *query.Bound
+			inclusive, exclude storage.FieldOp
+		}{
+			{t.Low, storage.FieldGTE, storage.FieldGT},
+			{t.High, storage.FieldLTE, storage.FieldLT},
+		} {
+			if b.bound == nil {
+				continue
+			}
+			f := filter
+			f.Op, f.Number, f.IsNumeric = b.exclude, b.bound.Number, true
+			if b.bound.Inclusive {
+				f.Op = b.inclusive
+			}
+			clause, fieldArgs := fieldClause(f)
+			clauses = append(clauses, clause)
+			args = append(args, fieldArgs...)
+		}
+		if len(clauses) == 0 {
+			return "1=1", nil
+		}
+		return "(" + strings.Join(clauses, " AND ") + ")", args
+	}
+
+	path := root + strings.Repeat(", ?", len(t.Keys))
+	args := make([]interface{}, 0, 2*len(t.Keys)+1)
+	for i := 0; i < 2; i++ {
+		for _, key := range t.Keys {
+			args = append(args, key)
+		}
+	}
+	isString := fmt.Sprintf("JSONType(%s) = 'String'", path)
+	if t.Op == query.OpRegex {
+		return fmt.Sprintf("(%s AND match(JSONExtractString(%s), ?))", isString, path), append(args, t.Regex.String())
+	}
+	return fmt.Sprintf("(%s AND JSONExtractString(%s) ILIKE ?)", isString, path), append(args, t.Like)
+}
@@ -0,0 +1,58 @@
+package clickhouse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/predatorx7/logtopus/pkg/query"
+)
+
+func TestCompileQuery(t *testing.T) {
+	tests := []struct {
+		q      string
+		clause string
+		args   []interface{}
+	}{
+		{
+			`level:>=WARNING OR error:timeout`,
+			"(upper(level) IN (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) OR positionCaseInsensitiveUTF8(error, ?) > 0)",
+			[]interface{}{"ALERT", "CRIT", "CRITICAL", "EMERG", "EMERGENCY", "ERR", "ERROR", "FATAL", "PANIC", "SEVERE", "WARN", "WARNING", "timeout"},
+		},
+		{
+			`-source:health* session_id:S-1`,
+			"(NOT (source ILIKE ?) AND lower(session_id) = lower(?))",
+			[]interface{}{"%health%", "S-1"},
+		},
+		{
+			`message:/time.?out/ sequence:[10 TO 20}`,
+			"(match(message, ?) AND (sequence >= ? AND sequence < ?))",
+			[]interface{}{"time.?out", 10.0, 20.0},
+		},
+		{
+			`object.user.id:U-*`,
+			"(JSONType(object, ?, ?) = 'String' AND JSONExtractString(object, ?, ?) ILIKE ?)",
+			[]interface{}{"user", "id", "user", "id", "U-%"},
+		},
+	}
+	for _, tt := range tests {
+		q, err := query.Parse(tt.q)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.q, err)
+		}
+		clause, args := compileQuery(q.Root)
+		if clause != tt.clause || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s:\n got %s %v\nwant %s %v", tt.q, clause, args, tt.clause, tt.args)
+		}
+	}
+
+	// Placeholders and arguments must line up for every kind of term.
+	q, err := query.Parse(`extra.status:[500 TO 599] object.id:42 object.tag:/a+/ time:>now-1h level:info trace_id:* NOT sequence:7`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	clause, args := compileQuery(q.Root)
+	if n := strings.Count(clause, "?"); n != len(args) {
+		t.Errorf("Expected %d args for %d placeholders: %s", len(args), n, clause)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
 	"github.com/ClickHouse/clickhouse-go/v2/lib/driver"
@@ -15,6 +16,9 @@ import (
 type ClickHouseStore struct {
 	conn driver.Conn
 	db   string
+	// TailLookback is how late a row may be inserted, behind the newest row
+	// a tail has delivered, and still be delivered. Default 30s.
+	TailLookback time.Duration
 }
 
 func NewClickHouseStore(dsn string) (*ClickHouseStore, error) {
@@ -43,69 +47,79 @@ func NewClickHouseStore(dsn string) (*ClickHouseStore, error) {
 	}, nil
 }
 
+// selectColumns must stay in the order scanRow reads them.
+const selectColumns = "timestamp, level, message, object, extra, logger_name, sequence, error, stacktrace, session_id, client_id, source, client_ip, trace_id, span_id, trace_flags"
+
+// rowHash is the last tiebreaker of QueryPage, for rows that agree on
+// timestamp, sequence, client_id and session_id, such as those of clients
+// that never set a sequence.
+const rowHash = "cityHash64(level, message, object, extra, logger_name, error, stacktrace, source, client_ip, trace_id, span_id)"
+
 func (s *ClickHouseStore) Query(ctx context.Context, params storage.QueryParams) ([]model.LogEntry, error) {
-	query := fmt.Sprintf("SELECT timestamp, level, message, object, extra, logger_name, sequence, error, stacktrace, session_id, client_id, source, client_ip FROM %s.logs WHERE 1=1", s.db)
-	args := []interface{}{}
+	page, err := s.QueryPage(ctx, params)
+	return page.Logs, err
+}
 
-	if !params.StartTime.IsZero() {
-		query += " AND timestamp >= ?"
-		args = append(args, params.StartTime)
-	}
-	if !params.EndTime.IsZero() {
-		query += " AND timestamp <= ?"
-		args = append(args, params.EndTime)
-	}
-	if params.Level != "" {
-		query += " AND lower(level) = lower(?)"
-		args = append(args, params.Level)
-	}
-	if params.Search != "" {
-		query += " AND message ILIKE ?" // ClickHouse ILIKE for case-insensitive
-		args = append(args, "%"+params.Search+"%")
-	}
-	if params.SessionID != "" {
-		query += " AND lower(session_id) = lower(?)"
-		args = append(args, params.SessionID)
-	}
-	if params.ClientID != "" {
-		query += " AND lower(client_id) = lower(?)"
-		args = append(args, params.ClientID)
+// QueryPage orders matches by timestamp with sequence, client_id, session_id
+// and a hash of the remaining columns as tiebreakers, which is also what the
+// cursor records. Only rows identical in every column can tie; one of them may
+// be skipped when a page ends between them.
+func (s *ClickHouseStore) QueryPage(ctx context.Context, params storage.QueryParams) (storage.Page, error) {
+	page, _, err := s.queryPage(ctx, params)
+	return page, err
+}
+
+// queryPage is QueryPage that also returns the cursor of every match.
+func (s *ClickHouseStore) queryPage(ctx context.Context, params storage.QueryParams) (storage.Page, []storage.Cursor, error) {
+	if params.Cursor != nil && params.Cursor.File != "" {
+		return storage.Page{}, nil, fmt.Errorf("%w: issued by the file store", storage.ErrInvalidCursor)
 	}
-	if params.Source != "" {
-		query += " AND source ILIKE ?"
-		args = append(args, "%"+params.Source+"%")
+
+	where, args := filterClause(params)
+	query := fmt.Sprintf("SELECT %s, %s AS row_hash FROM %s.logs WHERE %s", selectColumns, rowHash, s.db, where)
+
+	direction, compare := "DESC", "<"
+	if params.Order == storage.OrderOldest {
+		direction, compare = "ASC", ">"
 	}
-	if params.Error != "" {
-		query += " AND error ILIKE ?"
-		args = append(args, "%"+params.Error+"%")
+	if c := params.Cursor; c != nil {
+		query += fmt.Sprintf(" AND (timestamp, sequence, client_id, session_id, row_hash) %s (fromUnixTimestamp64Milli(toInt64(?)), ?, ?, ?, ?)", compare)
+		args = append(args, c.Time.UnixMilli(), c.Sequence, c.ClientID, c.SessionID, c.Hash)
 	}
+	query += fmt.Sprintf(" ORDER BY timestamp %[1]s, sequence %[1]s, client_id %[1]s, session_id %[1]s, row_hash %[1]s", direction)
 
-	query += " ORDER BY timestamp DESC"
-
-	if params.Limit > 0 {
-		query += " LIMIT ?"
-		args = append(args, params.Limit)
-	} else {
-		query += " LIMIT 100"
+	limit := params.Limit
+	if limit <= 0 {
+		limit = 100
 	}
+	query += " LIMIT ?"
+	args = append(args, limit)
 
 	// 1. Initial Query
 	rows, err := s.conn.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %w", err)
+		return storage.Page{}, nil, fmt.Errorf("failed to execute query: %w", err)
 	}
 	defer rows.Close()
 
 	var initialEntries []model.LogEntry
+	var cursors []storage.Cursor
 	for rows.Next() {
-		entry, err := scanRow(rows)
+		var hash uint64
+		entry, err := scanRow(rows, &hash)
 		if err != nil {
-			return nil, err
+			return storage.Page{}, nil, err
 		}
 		initialEntries = append(initialEntries, entry)
+		cursors = append(cursors, cursorFor(entry, hash))
 	}
 	rows.Close()
 
+	var next *storage.Cursor
+	if len(initialEntries) == limit {
+		next = &cursors[len(cursors)-1]
+	}
+
 	// 2. Fetch Context if needed
 	if (params.Before > 0 || params.After > 0) && len(initialEntries) > 0 {
 		finalResults := make([]model.LogEntry, 0, len(initialEntries)*(params.Before+params.After+1))
@@ -123,6 +137,10 @@ func (s *ClickHouseStore) Query(ctx context.Context, params storage.QueryParams)
 				whereClauses = append(whereClauses, "client_id = ?")
 				args = append(args, match.ClientID)
 			}
+			if params.TenantID != "" {
+				whereClauses = append(whereClauses, "client_id = ?")
+				args = append(args, params.TenantID)
+			}
 
 			baseWhere := strings.Join(whereClauses, " AND ")
 			if baseWhere == "" {
@@ -133,7 +151,7 @@ func (s *ClickHouseStore) Query(ctx context.Context, params storage.QueryParams)
 			// Fetch Before
 			if params.Before > 0 {
 				beforeArgs := append(append([]interface{}{}, args...), match.Time, params.Before)
-				beforeQuery := fmt.Sprintf(`SELECT timestamp, level, message, object, extra, logger_name, sequence, error, stacktrace, session_id, client_id, source, client_ip FROM %s.logs WHERE %s AND timestamp < ? ORDER BY timestamp DESC LIMIT ?`, s.db, baseWhere)
+				beforeQuery := fmt.Sprintf(`SELECT %s FROM %s.logs WHERE %s AND timestamp < ? ORDER BY timestamp DESC LIMIT ?`, selectColumns, s.db, baseWhere)
 
 				beforeRows, err := s.conn.Query(ctx, beforeQuery, beforeArgs...)
 				if err == nil {
@@ -156,7 +174,7 @@ func (s *ClickHouseStore) Query(ctx context.Context, params storage.QueryParams)
 			// Fetch After
 			if params.After > 0 {
 				afterArgs := append(append([]interface{}{}, args...), match.Time, params.After)
-				afterQuery := fmt.Sprintf(`SELECT timestamp, level, message, object, extra, logger_name, sequence, error, stacktrace, session_id, client_id, source, client_ip FROM %s.logs WHERE %s AND timestamp > ? ORDER BY timestamp ASC LIMIT ?`, s.db, baseWhere)
+				afterQuery := fmt.Sprintf(`SELECT %s FROM %s.logs WHERE %s AND timestamp > ? ORDER BY timestamp ASC LIMIT ?`, selectColumns, s.db, baseWhere)
 
 				afterRows, err := s.conn.Query(ctx, afterQuery, afterArgs...)
 				if err == nil {
@@ -168,18 +186,253 @@ func (s *ClickHouseStore) Query(ctx context.Context, params storage.QueryParams)
 				}
 			}
 		}
-		return finalResults, nil
+		return storage.Page{Logs: finalResults, Next: next}, cursors, nil
+	}
+
+	return storage.Page{Logs: initialEntries, Next: next}, cursors, nil
+}
+
+// cursorFor returns the position of entry in the ORDER BY of QueryPage.
+func cursorFor(entry model.LogEntry, hash uint64) storage.Cursor {
+	return storage.Cursor{Time: entry.Time, Sequence: entry.Sequence, ClientID: entry.ClientID, SessionID: entry.SessionID, Hash: hash}
+}
+
+const (
+	// tailInterval is how often Tail polls for new rows.
+	tailInterval = 2 * time.Second
+	// tailBatch is how many rows one poll reads at a time.
+	tailBatch = 1000
+	// defaultTailLookback is the TailLookback when it is not set.
+	defaultTailLookback = 30 * time.Second
+)
+
+// Tail polls for rows after the cursor, oldest first. Each poll reads again
+// the TailLookback before the newest row delivered, so rows inserted late
+// with an earlier timestamp, e.g. from clients with skewed clocks, are still
+// delivered, once. Rows later than that are not delivered.
+func (s *ClickHouseStore) Tail(ctx context.Context, params storage.QueryParams, fn func(model.LogEntry, storage.Cursor) error) error {
+	params.Order = storage.OrderOldest
+	params.Limit = tailBatch
+	params.Before, params.After = 0, 0
+	if params.Cursor == nil {
+		params.Cursor = &storage.Cursor{Time: time.Now()}
+	}
+	lookback := s.TailLookback
+	if lookback <= 0 {
+		lookback = defaultTailLookback
+	}
+
+	from, startTime := *params.Cursor, params.StartTime
+	newest := from.Time
+	// sent holds the rows delivered within the lookback, by cursor.
+	sent := make(map[string]time.Time)
+
+	ticker := time.NewTicker(tailInterval)
+	defer ticker.Stop()
+	for {
+		since := newest.Add(-lookback)
+		params.StartTime = startTime
+		if since.After(startTime) {
+			params.StartTime = since
+		}
+		params.Cursor = &from
+		for {
+			page, cursors, err := s.queryPage(ctx, params)
+			if err != nil {
+				return err
+			}
+			for i, entry := range page.Logs {
+				c := cursors[i]
+				key := c.Encode()
+				if _, ok := sent[key]; ok {
+					continue
+				}
+				if err := fn(entry, c); err != nil {
+					return err
+				}
+				sent[key] = c.Time
+				if c.Time.After(newest) {
+					newest = c.Time
+				}
+			}
+			if page.Next == nil {
+				break
+			}
+			params.Cursor = page.Next
+		}
+		for key, t := range sent {
+			if t.Before(newest.Add(-lookback)) {
+				delete(sent, key)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Export streams every matching row, oldest first, from a single query.
+func (s *ClickHouseStore) Export(ctx context.Context, params storage.QueryParams, fn func(model.LogEntry) error) error {
+	where, args := filterClause(params)
+	query := fmt.Sprintf("SELECT %s FROM %s.logs WHERE %s ORDER BY timestamp, sequence, client_id, session_id", selectColumns, s.db, where)
+
+	rows, err := s.conn.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute export: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		entry, err := scanRow(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
 	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read export: %w", err)
+	}
+	return nil
+}
 
-	return initialEntries, nil
+// dimensionColumns maps each dimension to the expression it groups by.
+var dimensionColumns = map[storage.Dimension]string{
+	storage.DimensionLevel:      "upper(level)",
+	storage.DimensionSource:     "source",
+	storage.DimensionClientID:   "client_id",
+	storage.DimensionLoggerName: "logger_name",
 }
 
-func scanRow(rows driver.Rows) (model.LogEntry, error) {
+// Aggregate counts matching rows with GROUP BY on the bucket and dimension.
+func (s *ClickHouseStore) Aggregate(ctx context.Context, params storage.AggregateParams) ([]storage.Bucket, error) {
+	where, whereArgs := filterClause(params.Filter)
+
+	bucket, group := "toDateTime64(0, 3)", "''"
+	var args []interface{}
+	if params.Interval > 0 {
+		bucket = "toStartOfInterval(timestamp, toIntervalSecond(?))"
+		args = append(args, int64(params.Interval/time.Second))
+	}
+	if params.GroupBy != "" {
+		group = dimensionColumns[params.GroupBy]
+	}
+	query := fmt.Sprintf("SELECT %s AS bucket, %s AS grp, count() FROM %s.logs WHERE %s GROUP BY bucket, grp", bucket, group, s.db, where)
+	args = append(args, whereArgs...)
+
+	rows, err := s.conn.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute aggregation: %w", err)
+	}
+	defer rows.Close()
+
+	// Level aliases are stored verbatim, so their counts are merged here.
+	counter := storage.NewBucketCounter()
+	for rows.Next() {
+		var (
+			t     time.Time
+			value string
+			count uint64
+		)
+		if err := rows.Scan(&t, &value, &count); err != nil {
+			return nil, fmt.Errorf("failed to scan row: %w", err)
+		}
+		if params.Interval <= 0 {
+			t = time.Time{}
+		}
+		if params.GroupBy == storage.DimensionLevel {
+			value = string(model.NormalizeLevel(model.LogLevel(value)))
+		}
+		counter.Add(t, value, count)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read aggregation: %w", err)
+	}
+	return counter.Buckets(), nil
+}
+
+// filterClause builds the WHERE condition for the filter fields of params.
+func filterClause(params storage.QueryParams) (string, []interface{}) {
+	where := "1=1"
+	args := []interface{}{}
+
+	if !params.StartTime.IsZero() {
+		where += " AND timestamp >= ?"
+		args = append(args, params.StartTime)
+	}
+	if !params.EndTime.IsZero() {
+		where += " AND timestamp <= ?"
+		args = append(args, params.EndTime)
+	}
+	if params.Level != "" {
+		// Match the level's aliases too, older rows were stored verbatim.
+		if level, ok := model.ParseLevel(params.Level); ok {
+			clause, levelArgs := levelIn(model.LevelNames(level))
+			where += " AND " + clause
+			args = append(args, levelArgs...)
+		} else {
+			where += " AND lower(level) = lower(?)"
+			args = append(args, params.Level)
+		}
+	}
+	if params.MinLevel != "" {
+		clause, levelArgs := levelIn(model.LevelNames(model.LevelsAtLeast(params.MinLevel)...))
+		where += " AND " + clause
+		args = append(args, levelArgs...)
+	}
+	if params.Search != "" {
+		where += " AND message ILIKE ?" // ClickHouse ILIKE for case-insensitive
+		args = append(args, "%"+params.Search+"%")
+	}
+	if params.SessionID != "" {
+		where += " AND lower(session_id) = lower(?)"
+		args = append(args, params.SessionID)
+	}
+	if params.ClientID != "" {
+		where += " AND lower(client_id) = lower(?)"
+		args = append(args, params.ClientID)
+	}
+	if params.TenantID != "" {
+		where += " AND client_id = ?"
+		args = append(args, params.TenantID)
+	}
+	if params.TraceID != "" {
+		where += " AND trace_id = ?"
+		args = append(args, strings.ToLower(params.TraceID))
+	}
+	if params.Source != "" {
+		where += " AND source ILIKE ?"
+		args = append(args, "%"+params.Source+"%")
+	}
+	if params.Error != "" {
+		where += " AND error ILIKE ?"
+		args = append(args, "%"+params.Error+"%")
+	}
+	for _, f := range params.Fields {
+		clause, fieldArgs := fieldClause(f)
+		where += " AND " + clause
+		args = append(args, fieldArgs...)
+	}
+	if params.Query != nil {
+		clause, queryArgs := compileQuery(params.Query.Root)
+		where += " AND " + clause
+		args = append(args, queryArgs...)
+	}
+	return where, args
+}
+
+// scanRow reads the selectColumns of a row, followed by any extra columns
+// into extra.
+func scanRow(rows driver.Rows, extra ...interface{}) (model.LogEntry, error) {
 	var entry model.LogEntry
 	var objStr, extraStr string
 	var levelStr string
 
-	if err := rows.Scan(
+	if err := rows.Scan(append([]interface{}{
 		&entry.Time,
 		&levelStr,
 		&entry.Message,
@@ -193,7 +446,10 @@ func scanRow(rows driver.Rows) (model.LogEntry, error) {
 		&entry.ClientID,
 		&entry.Source,
 		&entry.ClientIP,
-	); err != nil {
+		&entry.TraceID,
+		&entry.SpanID,
+		&entry.TraceFlags,
+	}, extra...)...); err != nil {
 		return entry, fmt.Errorf("failed to scan row: %w", err)
 	}
 
@@ -207,3 +463,57 @@ func scanRow(rows driver.Rows) (model.LogEntry, error) {
 	}
 	return entry, nil
 }
+
+// levelIn builds an "upper(level) IN (...)" clause for names.
+func levelIn(names []string) (string, []interface{}) {
+	if len(names) == 0 {
+		return "1=0", nil
+	}
+	args := make([]interface{}, len(names))
+	for i, name := range names {
+		args[i] = name
+	}
+	return "upper(level) IN (?" + strings.Repeat(", ?", len(names)-1) + ")", args
+}
+
+// fieldClause translates a field filter into JSONExtract calls on the object
+// or extra column, mirroring storage.FieldFilter.Match.
+func fieldClause(f storage.FieldFilter) (string, []interface{}) {
+	column := "object"
+	if f.Root == "extra" {
+		column = "extra"
+	}
+	// Every JSON function below takes the column followed by the path keys.
+	path := column + strings.Repeat(", ?", len(f.Keys))
+	withKeys := func(values ...interface{}) []interface{} {
+		args := make([]interface{}, 0, len(f.Keys)+len(values))
+		for _, key := range f.Keys {
+			args = append(args, key)
+		}
+		return append(args, values...)
+	}
+	isNumber := fmt.Sprintf("JSONType(%s) IN ('Int64', 'UInt64', 'Double')", path)
+
+	switch f.Op {
+	case storage.FieldExists:
+		return fmt.Sprintf("JSONHas(%s)", path), withKeys()
+	case storage.FieldContains:
+		return fmt.Sprintf("positionCaseInsensitiveUTF8(JSONExtractString(%s), ?) > 0", path), withKeys(f.Value)
+	case storage.FieldEquals:
+		clause := fmt.Sprintf("JSONHas(%s) AND (lower(JSONExtractString(%s)) = lower(?) OR JSONExtractRaw(%s) = ?", path, path, path)
+		args := append(append(withKeys(), withKeys(f.Value)...), withKeys(f.Value)...)
+		if f.IsNumeric {
+			clause += fmt.Sprintf(" OR (%s AND JSONExtractFloat(%s) = ?)", isNumber, path)
+			args = append(append(args, withKeys()...), withKeys(f.Number)...)
+		}
+		return "(" + clause + "))", args
+	}
+
+	ops := map[storage.FieldOp]string{
+		storage.FieldGT:  ">",
+		storage.FieldGTE: ">=",
+		storage.FieldLT:  "<",
+		storage.FieldLTE: "<=",
+	}
+	return fmt.Sprintf("(%s AND JSONExtractFloat(%s) %s ?)", isNumber, path, ops[f.Op]), append(withKeys(), withKeys(f.Number)...)
+}
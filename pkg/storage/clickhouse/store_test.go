@@ -0,0 +1,50 @@
+package clickhouse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/predatorx7/logtopus/pkg/storage"
+)
+
+func TestFieldClause(t *testing.T) {
+	tests := []struct {
+		filter string
+		clause string
+		args   []interface{}
+	}{
+		{
+			"extra.http.status:gte:500",
+			"(JSONType(extra, ?, ?) IN ('Int64', 'UInt64', 'Double') AND JSONExtractFloat(extra, ?, ?) >= ?)",
+			[]interface{}{"http", "status", "http", "status", 500.0},
+		},
+		{
+			"object.user:exists",
+			"JSONHas(object, ?)",
+			[]interface{}{"user"},
+		},
+		{
+			"object.path:contains:/api",
+			"positionCaseInsensitiveUTF8(JSONExtractString(object, ?), ?) > 0",
+			[]interface{}{"path", "/api"},
+		},
+	}
+	for _, tt := range tests {
+		f, err := storage.ParseFieldFilter(tt.filter)
+		if err != nil {
+			t.Fatalf("ParseFieldFilter(%q): %v", tt.filter, err)
+		}
+		clause, args := fieldClause(f)
+		if clause != tt.clause || !reflect.DeepEqual(args, tt.args) {
+			t.Errorf("%s:\n got %s %v\nwant %s %v", tt.filter, clause, args, tt.clause, tt.args)
+		}
+	}
+
+	// Placeholders and arguments must line up for equality, which has the most.
+	f, _ := storage.ParseFieldFilter("object.order.id:eq:42")
+	clause, args := fieldClause(f)
+	if n := strings.Count(clause, "?"); n != len(args) {
+		t.Errorf("Expected %d args for %d placeholders: %s", len(args), n, clause)
+	}
+}
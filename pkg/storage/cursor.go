@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidCursor is returned for cursors that cannot be decoded or were
+// issued by a different store.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Order is the direction results are returned in.
+type Order string
+
+const (
+	// OrderNewest returns the most recent entries first. It is the default.
+	OrderNewest Order = "desc"
+	// OrderOldest returns the oldest entries first.
+	OrderOldest Order = "asc"
+)
+
+// ParseOrder accepts "desc"/"newest" and "asc"/"oldest"; empty means newest
+// first.
+func ParseOrder(s string) (Order, error) {
+	switch s {
+	case "", "desc", "newest":
+		return OrderNewest, nil
+	case "asc", "oldest":
+		return OrderOldest, nil
+	}
+	return "", fmt.Errorf("unknown order %q (expected asc or desc)", s)
+}
+
+// Cursor is the position of the last match of a page. Results continue
+// strictly after it in the requested order, so entries sharing a timestamp
+// are neither repeated nor skipped. Each store fills in its own tiebreaker;
+// clients only ever see the encoded form.
+type Cursor struct {
+	Time time.Time `json:"t"`
+
+	// ClickHouse tiebreakers.
+	Sequence  uint64 `json:"s,omitempty"`
+	ClientID  string `json:"c,omitempty"`
+	SessionID string `json:"e,omitempty"`
+	// Hash is cityHash64 of the remaining columns.
+	Hash uint64 `json:"h,omitempty"`
+
+	// File store tiebreakers: the file and byte offset of the line.
+	File   string `json:"f,omitempty"`
+	Offset int64  `json:"o,omitempty"`
+}
+
+// Encode returns the opaque form of the cursor.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor produced by Encode.
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
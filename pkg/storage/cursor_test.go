@@ -0,0 +1,34 @@
+package storage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCursor_RoundTrip(t *testing.T) {
+	c := Cursor{Time: time.Date(2024, 1, 1, 0, 0, 0, 5e6, time.UTC), Sequence: 7, ClientID: "client-a", SessionID: "s1", Hash: 1 << 63}
+	got, err := DecodeCursor(c.Encode())
+	if err != nil {
+		t.Fatalf("DecodeCursor failed: %v", err)
+	}
+	if !got.Time.Equal(c.Time) || got.Sequence != 7 || got.ClientID != "client-a" || got.SessionID != "s1" || got.Hash != 1<<63 {
+		t.Errorf("Expected %+v, got %+v", c, got)
+	}
+
+	for _, s := range []string{"not base64!", "bm90IGpzb24"} {
+		if _, err := DecodeCursor(s); err != ErrInvalidCursor {
+			t.Errorf("Expected %q to be rejected, got %v", s, err)
+		}
+	}
+}
+
+func TestParseOrder(t *testing.T) {
+	for s, want := range map[string]Order{"": OrderNewest, "desc": OrderNewest, "oldest": OrderOldest, "asc": OrderOldest} {
+		if got, err := ParseOrder(s); err != nil || got != want {
+			t.Errorf("ParseOrder(%q) = %q, %v; expected %q", s, got, err, want)
+		}
+	}
+	if _, err := ParseOrder("sideways"); err == nil {
+		t.Error("Expected an unknown order to be rejected")
+	}
+}
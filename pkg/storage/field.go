@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+// FieldOp is a comparison applied by a FieldFilter.
+type FieldOp string
+
+const (
+	FieldEquals   FieldOp = "eq"
+	FieldContains FieldOp = "contains"
+	FieldGT       FieldOp = "gt"
+	FieldGTE      FieldOp = "gte"
+	FieldLT       FieldOp = "lt"
+	FieldLTE      FieldOp = "lte"
+	FieldExists   FieldOp = "exists"
+)
+
+// FieldFilter is a predicate on a value inside Object or Extra, addressed by
+// a dotted path such as "object.user.id" or "extra.http_status".
+type FieldFilter struct {
+	// Root is "object" or "extra".
+	Root string
+	// Keys is the path below Root.
+	Keys  []string
+	Op    FieldOp
+	Value string
+	// Number is Value parsed as a number, set for the range operators and for
+	// equality with a numeric value.
+	Number    float64
+	IsNumeric bool
+}
+
+// ParseFieldFilter parses "path:op[:value]", e.g. "object.order_id:eq:A-17",
+// "extra.http_status:gte:500" or "object.user:exists". The value may itself
+// contain colons.
+func ParseFieldFilter(s string) (FieldFilter, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 2 {
+		return FieldFilter{}, fmt.Errorf("field filter %q must be path:op[:value]", s)
+	}
+
+	path := strings.Split(parts[0], ".")
+	if len(path) < 2 || (path[0] != "object" && path[0] != "extra") {
+		return FieldFilter{}, fmt.Errorf("field path %q must start with object. or extra.", parts[0])
+	}
+	for _, key := range path[1:] {
+		if key == "" {
+			return FieldFilter{}, fmt.Errorf("field path %q has an empty segment", parts[0])
+		}
+	}
+
+	f := FieldFilter{Root: path[0], Keys: path[1:], Op: FieldOp(parts[1])}
+	if len(parts) == 3 {
+		f.Value = parts[2]
+	}
+	if n, err := strconv.ParseFloat(f.Value, 64); err == nil {
+		f.Number, f.IsNumeric = n, true
+	}
+
+	switch f.Op {
+	case FieldExists:
+		if len(parts) == 3 {
+			return FieldFilter{}, fmt.Errorf("field filter %q: exists takes no value", s)
+		}
+	case FieldEquals, FieldContains:
+		if len(parts) < 3 {
+			return FieldFilter{}, fmt.Errorf("field filter %q needs a value", s)
+		}
+	case FieldGT, FieldGTE, FieldLT, FieldLTE:
+		if !f.IsNumeric {
+			return FieldFilter{}, fmt.Errorf("field filter %q needs a numeric value", s)
+		}
+	default:
+		return FieldFilter{}, fmt.Errorf("field filter %q: unknown operator %q (expected eq, contains, gt, gte, lt, lte or exists)", s, parts[1])
+	}
+	return f, nil
+}
+
+// Path returns the dotted path the filter was parsed from.
+func (f FieldFilter) Path() string {
+	return f.Root + "." + strings.Join(f.Keys, ".")
+}
+
+// Match reports whether entry satisfies the filter. String comparisons ignore
+// case; range operators only match numbers.
+func (f FieldFilter) Match(entry model.LogEntry) bool {
+	root := entry.Object
+	if f.Root == "extra" {
+		root = entry.Extra
+	}
+
+	var value interface{} = root
+	for _, key := range f.Keys {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+		if value, ok = m[key]; !ok {
+			return false
+		}
+	}
+
+	switch f.Op {
+	case FieldExists:
+		return true
+	case FieldEquals:
+		switch v := value.(type) {
+		case string:
+			return strings.EqualFold(v, f.Value)
+		case float64:
+			return f.IsNumeric && v == f.Number
+		default:
+			raw, err := json.Marshal(v)
+			return err == nil && string(raw) == f.Value
+		}
+	case FieldContains:
+		s, ok := value.(string)
+		return ok && strings.Contains(strings.ToLower(s), strings.ToLower(f.Value))
+	}
+
+	n, ok := value.(float64)
+	if !ok {
+		return false
+	}
+	switch f.Op {
+	case FieldGT:
+		return n > f.Number
+	case FieldGTE:
+		return n >= f.Number
+	case FieldLT:
+		return n < f.Number
+	case FieldLTE:
+		return n <= f.Number
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package storage
+
+import (
+	"testing"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+)
+
+func TestParseFieldFilter_Errors(t *testing.T) {
+	for _, s := range []string{
+		"object.user",
+		"user.id:eq:1",
+		"object:exists",
+		"object..id:exists",
+		"object.id:eq",
+		"object.id:exists:1",
+		"object.status:gt:high",
+		"object.id:like:x",
+	} {
+		if _, err := ParseFieldFilter(s); err == nil {
+			t.Errorf("Expected %q to be rejected", s)
+		}
+	}
+
+	f, err := ParseFieldFilter("object.url:eq:http://example.com")
+	if err != nil || f.Value != "http://example.com" || f.Path() != "object.url" {
+		t.Errorf("Expected colons in the value to be kept, got %+v, %v", f, err)
+	}
+}
+
+func TestFieldFilter_Match(t *testing.T) {
+	entry := model.LogEntry{
+		Object: map[string]interface{}{
+			"user":   map[string]interface{}{"id": "U-42", "admin": true},
+			"amount": 12.5,
+			"path":   "/api/orders",
+		},
+		Extra: map[string]interface{}{"http_status": float64(503)},
+	}
+
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{"object.user.id:eq:u-42", true},
+		{"object.user.id:eq:U-43", false},
+		{"object.user.admin:eq:true", true},
+		{"object.amount:eq:12.5", true},
+		{"object.path:contains:ORDERS", true},
+		{"object.amount:contains:12", false},
+		{"extra.http_status:gte:500", true},
+		{"extra.http_status:lt:500", false},
+		{"object.path:gt:1", false},
+		{"object.user:exists", true},
+		{"object.user.email:exists", false},
+		{"object.path.deeper:exists", false},
+		{"extra.missing:eq:x", false},
+	}
+	for _, tt := range tests {
+		f, err := ParseFieldFilter(tt.filter)
+		if err != nil {
+			t.Fatalf("ParseFieldFilter(%q): %v", tt.filter, err)
+		}
+		if got := f.Match(entry); got != tt.want {
+			t.Errorf("%s: expected %v, got %v", tt.filter, tt.want, got)
+		}
+	}
+}
@@ -2,15 +2,19 @@ package file
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/segment"
 	"github.com/predatorx7/logtopus/pkg/storage"
 )
 
@@ -26,126 +30,135 @@ func NewFileStore(dir string) (*FileStore, error) {
 }
 
 func (s *FileStore) Query(ctx context.Context, params storage.QueryParams) ([]model.LogEntry, error) {
-	files, err := os.ReadDir(s.dir)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read log directory: %w", err)
-	}
-
-	// Sort files by modification time (or name) descending to read newest first
-	// Assuming log filenames don't strictly sort chronologically across rotations unless numbered.
-	// `ls -t` equivalent.
-	fileInfos := make([]os.FileInfo, 0, len(files))
-	for _, entry := range files {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".log") {
-			info, err := entry.Info()
-			if err == nil {
-				fileInfos = append(fileInfos, info)
-			}
-		}
+	page, err := s.QueryPage(ctx, params)
+	return page.Logs, err
+}
+
+// QueryPage returns matches ordered by time, then file name and byte offset,
+// so paging stays stable while session files keep being appended to.
+func (s *FileStore) QueryPage(ctx context.Context, params storage.QueryParams) (storage.Page, error) {
+	if params.Cursor != nil && params.Cursor.File == "" {
+		return storage.Page{}, fmt.Errorf("%w: not issued by the file store", storage.ErrInvalidCursor)
 	}
 
-	sort.Slice(fileInfos, func(i, j int) bool {
-		return fileInfos[i].ModTime().After(fileInfos[j].ModTime())
-	})
+	files, err := s.logFiles()
+	if err != nil {
+		return storage.Page{}, err
+	}
 
-	var results []model.LogEntry
 	limit := params.Limit
 	if limit <= 0 {
 		limit = 100
 	}
+	oldest := params.Order == storage.OrderOldest
 
-	for _, info := range fileInfos {
+	// Any session file may hold the next match, so every file is scanned and
+	// only the best `limit` groups are kept.
+	var groups []fileGroup
+	for _, file := range files {
 		if ctx.Err() != nil {
-			return nil, ctx.Err()
+			return storage.Page{}, ctx.Err()
 		}
 
-		path := filepath.Join(s.dir, info.Name())
-		entries, err := s.scanFile(ctx, path, params)
+		fileGroups, err := s.scanFile(ctx, file, params)
+		if os.IsNotExist(err) {
+			continue // removed by retention
+		}
 		if err != nil {
-			// Log error but continue? or fail? Fails fast for now.
-			return nil, fmt.Errorf("failed to scan file %s: %w", info.Name(), err)
+			return storage.Page{}, fmt.Errorf("failed to scan file %s: %w", file.File, err)
 		}
+		for _, g := range fileGroups {
+			if params.Cursor == nil || g.after(*params.Cursor, oldest) {
+				groups = append(groups, g)
+			}
+		}
+		groups = bestGroups(groups, limit, oldest)
+	}
 
-		// Since we scan file lines in efficient order (ideally reverse, but simple scan is forward),
-		// if we scan forward, we get oldest logs in file first.
-		// BUT we iterate files Newest -> Oldest.
-		// If we want "Limit 5" most recent, we want the LAST 5 lines of the NEWEST file.
-
-		// To be efficient for "tail", we should ideally read file backward or read all and reverse.
-		// Reading full file for large logs is bad.
-		// For simplicity/v1: Read lines, parse, filter.
-		// Optimization: Read file forward, append to temp buffer, sort/trim?
-		// Better: Scan backward. But implementing reliable backward scanner is complex.
-		// Compromise for now: Read forward, filter, append.
-		// NOTE: This puts oldest logs of the newest file first in 'entries'.
-		// We need to handle this order.
-
-		// Let's assume we collect ALL matches from this file (respecting global time limits)
-		// and then see if we have enough.
-
-		// Wait, if we iterate files Newest->Oldest, but read lines Oldest->Newest (forward scan),
-		// we get: [FileNew: Old->New], [FileOld: Old->New].
-		// This is mixed order.
+	var page storage.Page
+	for _, g := range groups {
+		if !oldest {
+			// Newest first reads each group backwards, context included.
+			reverseEntries(g.entries)
+		}
+		page.Logs = append(page.Logs, g.entries...)
+	}
+	if len(groups) == limit {
+		last := groups[len(groups)-1]
+		page.Next = &storage.Cursor{Time: last.time, File: last.file, Offset: last.offset}
+	}
+	return page, nil
+}
 
-		// Let's reverse 'entries' from this file so they are New->Old.
-		reverseEntries(entries)
+// fileGroup is a match together with its context lines.
+type fileGroup struct {
+	// time, file and offset (of the match line) order the groups. file is
+	// the segment name without compression suffix.
+	time    time.Time
+	file    string
+	offset  int64
+	entries []model.LogEntry
+}
 
-		results = append(results, entries...)
-		if len(results) >= limit {
-			results = results[:limit]
-			break
-		}
+// before reports whether g sorts before the given position in oldest-first
+// order.
+func (g fileGroup) before(t time.Time, file string, offset int64) bool {
+	if !g.time.Equal(t) {
+		return g.time.Before(t)
+	}
+	if g.file != file {
+		return g.file < file
 	}
+	return g.offset < offset
+}
 
-	return results, nil
+// after reports whether g comes after the cursor in the requested order.
+func (g fileGroup) after(c storage.Cursor, oldest bool) bool {
+	if g.time.Equal(c.Time) && g.file == c.File && g.offset == c.Offset {
+		return false
+	}
+	return g.before(c.Time, c.File, c.Offset) != oldest
 }
 
-func (s *FileStore) scanFile(ctx context.Context, path string, params storage.QueryParams) ([]model.LogEntry, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
+// bestGroups sorts groups in the requested order and keeps the first limit.
+func bestGroups(groups []fileGroup, limit int, oldest bool) []fileGroup {
+	sort.SliceStable(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		if !oldest {
+			a, b = b, a
+		}
+		return a.before(b.time, b.file, b.offset)
+	})
+	if len(groups) > limit {
+		groups = groups[:limit]
 	}
-	defer f.Close()
+	return groups
+}
 
-	var matches []model.LogEntry
-	scanner := bufio.NewScanner(f)
-	// handling large lines
-	buf := make([]byte, 0, 64*1024)
-	scanner.Buffer(buf, 1024*1024)
+func (s *FileStore) scanFile(ctx context.Context, file segment.Info, params storage.QueryParams) ([]fileGroup, error) {
+	var groups []fileGroup
 
-	// Context buffers
+	// Context buffers, negative context is none
+	params.Before, params.After = max(0, params.Before), max(0, params.After)
 	ringBuffer := make([]model.LogEntry, 0, params.Before+1)
 	afterCount := 0
 
-	for scanner.Scan() {
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
-
-		line := scanner.Bytes()
-		var entry model.LogEntry
-		if err := json.Unmarshal(line, &entry); err != nil {
-			continue // skip malformed
-		}
-
+	_, err := s.forEachEntry(ctx, file, params.TenantID, 0, func(entry model.LogEntry, offset int64) error {
 		isMatch := match(entry, params)
 
 		if isMatch {
-			// Found a match!
-			// 1. Flush ring buffer (before context)
-			matches = append(matches, ringBuffer...)
+			// Found a match: it opens a group with the buffered before context.
+			entries := make([]model.LogEntry, 0, len(ringBuffer)+1+params.After)
+			entries = append(append(entries, ringBuffer...), entry)
+			groups = append(groups, fileGroup{time: entry.Time, file: file.Name, offset: offset, entries: entries})
 			ringBuffer = ringBuffer[:0] // clear buffer
-
-			// 2. Add the clean match
-			matches = append(matches, entry)
-
-			// 3. Reset after counter
 			afterCount = params.After
 		} else {
 			// Not a match
 			if afterCount > 0 {
 				// We are in the "after" context of a previous match
-				matches = append(matches, entry)
+				last := &groups[len(groups)-1]
+				last.entries = append(last.entries, entry)
 				afterCount--
 			}
 
@@ -159,9 +172,211 @@ func (s *FileStore) scanFile(ctx context.Context, path string, params storage.Qu
 				ringBuffer = append(ringBuffer, entry)
 			}
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// forEachEntry calls fn for every well-formed entry of the file in write
+// order, starting at byte offset from, with the byte offset of its line.
+// Offsets of compressed segments are into the uncompressed content. Entries
+// of other clients than tenantID, when set, are skipped. A trailing line
+// without a newline is still being written and is left for later. It returns
+// the offset after the last line read; an error from fn stops the scan and is
+// returned.
+func (s *FileStore) forEachEntry(ctx context.Context, file segment.Info, tenantID string, from int64, fn func(entry model.LogEntry, offset int64) error) (int64, error) {
+	r, err := segment.Open(s.dir, file)
+	if err != nil {
+		return from, err
+	}
+	defer r.Close()
+	if from > 0 {
+		if seeker, ok := r.(io.Seeker); ok {
+			_, err = seeker.Seek(from, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, r, from)
+		}
+		if err != nil {
+			return from, err
+		}
+	}
+
+	scanner := bufio.NewScanner(r)
+	// handling large lines
+	buf := make([]byte, 0, 64*1024)
+	scanner.Buffer(buf, 1024*1024)
+
+	// Track the byte offset of each line as the cursor tiebreaker.
+	offset, lineStart := from, from
+	scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		if bytes.IndexByte(data, '\n') < 0 {
+			return 0, nil, nil // incomplete line, or EOF
+		}
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		if token != nil {
+			lineStart = offset
+		}
+		offset += int64(advance)
+		return advance, token, err
+	})
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return lineStart, ctx.Err()
+		}
+
+		var entry model.LogEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // skip malformed
+		}
+		if tenantID != "" && entry.ClientID != tenantID {
+			continue // other tenants are never returned, not even as context
+		}
+		if err := fn(entry, lineStart); err != nil {
+			return lineStart, err
+		}
+	}
+	return offset, scanner.Err()
+}
+
+// Aggregate counts matching entries in a single pass over the session files.
+func (s *FileStore) Aggregate(ctx context.Context, params storage.AggregateParams) ([]storage.Bucket, error) {
+	files, err := s.logFiles()
+	if err != nil {
+		return nil, err
+	}
+
+	counter := storage.NewBucketCounter()
+	for _, file := range files {
+		_, err := s.forEachEntry(ctx, file, params.Filter.TenantID, 0, func(entry model.LogEntry, _ int64) error {
+			if match(entry, params.Filter) {
+				counter.Add(storage.BucketStart(entry.Time, params.Interval), params.GroupBy.Value(entry), 1)
+			}
+			return nil
+		})
+		if os.IsNotExist(err) {
+			continue // removed by retention
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan file %s: %w", file.File, err)
+		}
+	}
+	return counter.Buckets(), nil
+}
+
+// Export streams the matches of each session in write order, sessions in
+// name order, so entries are grouped by session rather than sorted globally.
+func (s *FileStore) Export(ctx context.Context, params storage.QueryParams, fn func(model.LogEntry) error) error {
+	files, err := s.logFiles()
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		_, err := s.forEachEntry(ctx, file, params.TenantID, 0, func(entry model.LogEntry, _ int64) error {
+			if !match(entry, params) {
+				return nil
+			}
+			return fn(entry)
+		})
+		if os.IsNotExist(err) {
+			continue // removed while exporting
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tailInterval is how often Tail looks for new lines.
+var tailInterval = time.Second
+
+// tailDone marks a compressed segment Tail has read to the end.
+const tailDone = -1
+
+// Tail follows the session files, remembering how far each was read. When
+// resuming, every file is read from the start once and only entries after
+// the cursor are delivered. A segment compressed after it was last polled is
+// read on from the same offset once, since offsets are into its uncompressed
+// content.
+func (s *FileStore) Tail(ctx context.Context, params storage.QueryParams, fn func(model.LogEntry, storage.Cursor) error) error {
+	from := params.Cursor
+	if from != nil && from.File == "" {
+		return fmt.Errorf("%w: not issued by the file store", storage.ErrInvalidCursor)
+	}
+
+	offsets := make(map[string]int64)
+	if from == nil {
+		files, err := s.logFiles()
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if file.Compression != segment.CompressionNone {
+				offsets[file.Name] = tailDone
+			} else if info, err := os.Stat(filepath.Join(s.dir, file.File)); err == nil {
+				offsets[file.Name] = info.Size()
+			}
+		}
+	}
+
+	ticker := time.NewTicker(tailInterval)
+	defer ticker.Stop()
+	for {
+		files, err := s.logFiles()
+		if err != nil {
+			return err
+		}
+		current := make(map[string]int64, len(files))
+		for _, file := range files {
+			offset := offsets[file.Name]
+			if file.Compression != segment.CompressionNone {
+				if offset == tailDone {
+					current[file.Name] = tailDone
+					continue
+				}
+			} else if info, err := os.Stat(filepath.Join(s.dir, file.File)); err == nil && info.Size() < offset {
+				offset = 0 // truncated or replaced
+			}
+			next, err := s.forEachEntry(ctx, file, params.TenantID, offset, func(entry model.LogEntry, lineOffset int64) error {
+				if !match(entry, params) {
+					return nil
+				}
+				pos := fileGroup{time: entry.Time, file: file.Name, offset: lineOffset}
+				if from != nil && !pos.after(*from, true) {
+					return nil
+				}
+				return fn(entry, storage.Cursor{Time: entry.Time, File: file.Name, Offset: lineOffset})
+			})
+			if os.IsNotExist(err) {
+				current[file.Name] = offsets[file.Name] // keep the offset in case it reappears compressed
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if file.Compression != segment.CompressionNone {
+				next = tailDone
+			}
+			current[file.Name] = next
+		}
+		// Files removed since the last pass are forgotten.
+		offsets, from = current, nil
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
 	}
+}
 
-	return matches, scanner.Err()
+// logFiles lists the log segments in the store directory.
+func (s *FileStore) logFiles() ([]segment.Info, error) {
+	return segment.List(s.dir)
 }
 
 func match(entry model.LogEntry, params storage.QueryParams) bool {
@@ -172,7 +387,10 @@ func match(entry model.LogEntry, params storage.QueryParams) bool {
 	if !params.EndTime.IsZero() && entry.Time.After(params.EndTime) {
 		return false
 	}
-	if params.Level != "" && !strings.EqualFold(string(entry.Level), params.Level) {
+	if params.Level != "" && !strings.EqualFold(string(model.NormalizeLevel(entry.Level)), string(model.NormalizeLevel(model.LogLevel(params.Level)))) {
+		return false
+	}
+	if params.MinLevel != "" && !entry.Level.AtLeast(params.MinLevel) {
 		return false
 	}
 	if params.Search != "" && !strings.Contains(strings.ToLower(entry.Message), strings.ToLower(params.Search)) {
@@ -184,12 +402,23 @@ func match(entry model.LogEntry, params storage.QueryParams) bool {
 	if params.ClientID != "" && !strings.EqualFold(entry.ClientID, params.ClientID) {
 		return false
 	}
+	if params.TraceID != "" && !strings.EqualFold(entry.TraceID, params.TraceID) {
+		return false
+	}
 	if params.Source != "" && !strings.Contains(strings.ToLower(entry.Source), strings.ToLower(params.Source)) {
 		return false
 	}
 	if params.Error != "" && !strings.Contains(strings.ToLower(entry.Error), strings.ToLower(params.Error)) {
 		return false
 	}
+	for _, f := range params.Fields {
+		if !f.Match(entry) {
+			return false
+		}
+	}
+	if params.Query != nil && !params.Query.Match(entry) {
+		return false
+	}
 	return true
 }
 
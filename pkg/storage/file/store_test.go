@@ -0,0 +1,423 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/segment"
+	"github.com/predatorx7/logtopus/pkg/storage"
+)
+
+func writeLogs(t *testing.T, dir string, logs []model.LogEntry) {
+	t.Helper()
+	f, err := os.Create(filepath.Join(dir, "logs.log"))
+	if err != nil {
+		t.Fatalf("Failed to create log file: %v", err)
+	}
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, entry := range logs {
+		enc.Encode(entry)
+	}
+}
+
+func TestFileStore_TenantScoping(t *testing.T) {
+	dir := t.TempDir()
+	writeLogs(t, dir, []model.LogEntry{
+		{Message: "a1", ClientID: "client-a", SessionID: "s1"},
+		{Message: "b1", ClientID: "client-b", SessionID: "s1"},
+		{Message: "a2", ClientID: "client-a", SessionID: "s1"},
+	})
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	logs, err := store.Query(context.Background(), storage.QueryParams{TenantID: "client-a"})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("Expected 2 logs for client-a, got %d", len(logs))
+	}
+	for _, entry := range logs {
+		if entry.ClientID != "client-a" {
+			t.Errorf("Leaked entry of %s", entry.ClientID)
+		}
+	}
+
+	// Context lines of other tenants are not returned either.
+	logs, err = store.Query(context.Background(), storage.QueryParams{
+		TenantID:  "client-a",
+		SessionID: "s1",
+		Search:    "a2",
+		Before:    2,
+	})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(logs) != 2 || logs[0].Message != "a2" || logs[1].Message != "a1" {
+		t.Errorf("Expected [a2 a1], got %v", logs)
+	}
+}
+
+func TestFileStore_LevelFilters(t *testing.T) {
+	dir := t.TempDir()
+	writeLogs(t, dir, []model.LogEntry{
+		{Message: "debug", Level: model.LogLevelFine},
+		{Message: "info", Level: model.LogLevelInfo},
+		{Message: "warn", Level: model.LogLevelWarning},
+		{Message: "legacy error", Level: "ERROR"},
+		{Message: "severe", Level: model.LogLevelSevere},
+	})
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		params storage.QueryParams
+		want   int
+	}{
+		{"min level", storage.QueryParams{MinLevel: model.LogLevelWarning}, 3},
+		{"min level alias", storage.QueryParams{MinLevel: "error"}, 2},
+		{"level alias", storage.QueryParams{Level: "error"}, 2},
+		{"level canonical", storage.QueryParams{Level: "severe"}, 2},
+		{"level debug", storage.QueryParams{Level: "DEBUG"}, 1},
+	}
+	for _, tt := range tests {
+		logs, err := store.Query(context.Background(), tt.params)
+		if err != nil {
+			t.Fatalf("%s: query failed: %v", tt.name, err)
+		}
+		if len(logs) != tt.want {
+			t.Errorf("%s: expected %d logs, got %d", tt.name, tt.want, len(logs))
+		}
+	}
+}
+
+func TestFileStore_TraceID(t *testing.T) {
+	dir := t.TempDir()
+	trace := "4bf92f3577b34da6a3ce929d0e0e4736"
+	writeLogs(t, dir, []model.LogEntry{
+		{Message: "first", TraceID: trace},
+		{Message: "other", TraceID: "0af7651916cd43dd8448eb211c80319c"},
+		{Message: "untraced"},
+		{Message: "second", TraceID: trace},
+	})
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	logs, err := store.Query(context.Background(), storage.QueryParams{TraceID: strings.ToUpper(trace)})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(logs) != 2 || logs[0].Message != "second" || logs[1].Message != "first" {
+		t.Errorf("Unexpected logs for trace: %+v", logs)
+	}
+}
+
+func TestFileStore_NegativeContext(t *testing.T) {
+	dir := t.TempDir()
+	writeLogs(t, dir, []model.LogEntry{
+		{Message: "before", SessionID: "s1"},
+		{Message: "match", SessionID: "s1"},
+		{Message: "after", SessionID: "s1"},
+	})
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	logs, err := store.Query(context.Background(), storage.QueryParams{Search: "match", SessionID: "s1", Before: -5, After: -5})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(logs) != 1 || logs[0].Message != "match" {
+		t.Errorf("Expected negative context to be none, got %+v", logs)
+	}
+}
+
+func TestFileStore_FieldFilters(t *testing.T) {
+	dir := t.TempDir()
+	writeLogs(t, dir, []model.LogEntry{
+		{Message: "ok", Extra: map[string]interface{}{"http_status": 200}, Object: map[string]interface{}{"order_id": "A-1"}},
+		{Message: "fail", Extra: map[string]interface{}{"http_status": 502}, Object: map[string]interface{}{"order_id": "A-2"}},
+		{Message: "fail again", Extra: map[string]interface{}{"http_status": 503}, Object: map[string]interface{}{"order_id": "A-2"}},
+	})
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	var fields []storage.FieldFilter
+	for _, s := range []string{"extra.http_status:gte:500", "object.order_id:eq:a-2"} {
+		f, err := storage.ParseFieldFilter(s)
+		if err != nil {
+			t.Fatalf("ParseFieldFilter(%q): %v", s, err)
+		}
+		fields = append(fields, f)
+	}
+	logs, err := store.Query(context.Background(), storage.QueryParams{Fields: fields})
+	if err != nil {
+		t.Fatalf("Query failed: %v", err)
+	}
+	if len(logs) != 2 || logs[0].Message != "fail again" {
+		t.Errorf("Unexpected logs: %+v", logs)
+	}
+}
+
+func TestFileStore_Paging(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	// Two session files with interleaved and identical timestamps.
+	for name, logs := range map[string][]model.LogEntry{
+		"session_a.log": {{Message: "a0", Time: base}, {Message: "a1", Time: base.Add(time.Second)}, {Message: "a2", Time: base.Add(time.Second)}},
+		"session_b.log": {{Message: "b0", Time: base}, {Message: "b1", Time: base.Add(time.Second)}, {Message: "b2", Time: base.Add(2 * time.Second)}},
+	} {
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Failed to create log file: %v", err)
+		}
+		enc := json.NewEncoder(f)
+		for _, entry := range logs {
+			enc.Encode(entry)
+		}
+		f.Close()
+	}
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	tests := []struct {
+		order storage.Order
+		want  string
+	}{
+		{storage.OrderNewest, "b2 b1 a2 a1 b0 a0"},
+		{storage.OrderOldest, "a0 b0 a1 a2 b1 b2"},
+	}
+	for _, tt := range tests {
+		var got []string
+		params := storage.QueryParams{Limit: 4, Order: tt.order}
+		for pages := 0; pages < 5; pages++ {
+			page, err := store.QueryPage(context.Background(), params)
+			if err != nil {
+				t.Fatalf("QueryPage failed: %v", err)
+			}
+			for _, entry := range page.Logs {
+				got = append(got, entry.Message)
+			}
+			if page.Next == nil {
+				break
+			}
+			// Cursors survive the round trip through their opaque form.
+			params.Cursor, err = storage.DecodeCursor(page.Next.Encode())
+			if err != nil {
+				t.Fatalf("DecodeCursor failed: %v", err)
+			}
+		}
+		if strings.Join(got, " ") != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.order, tt.want, strings.Join(got, " "))
+		}
+	}
+
+	_, err = store.QueryPage(context.Background(), storage.QueryParams{Cursor: &storage.Cursor{Time: base, Sequence: 1}})
+	if !errors.Is(err, storage.ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for a foreign cursor, got %v", err)
+	}
+}
+
+func TestFileStore_Aggregate(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	writeLogs(t, dir, []model.LogEntry{
+		{Message: "a", Level: "INFO", Time: base},
+		{Message: "b", Level: "ERROR", Time: base.Add(10 * time.Second)},
+		{Message: "c", Level: "SEVERE", Time: base.Add(30 * time.Second)},
+		{Message: "d", Level: "INFO", Time: base.Add(90 * time.Second)},
+		{Message: "e", Level: "FINE", Time: base.Add(100 * time.Second), ClientID: "client-b"},
+	})
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	buckets, err := store.Aggregate(context.Background(), storage.AggregateParams{
+		Filter:   storage.QueryParams{MinLevel: model.LogLevelInfo},
+		Interval: time.Minute,
+		GroupBy:  storage.DimensionLevel,
+	})
+	if err != nil {
+		t.Fatalf("Aggregate failed: %v", err)
+	}
+	want := []storage.Bucket{
+		{Time: base, Group: "INFO", Count: 1},
+		{Time: base, Group: "SEVERE", Count: 2},
+		{Time: base.Add(time.Minute), Group: "INFO", Count: 1},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("Expected %d buckets, got %+v", len(want), buckets)
+	}
+	for i := range want {
+		if !buckets[i].Time.Equal(want[i].Time) || buckets[i].Group != want[i].Group || buckets[i].Count != want[i].Count {
+			t.Errorf("Bucket %d: expected %+v, got %+v", i, want[i], buckets[i])
+		}
+	}
+
+	// Without an interval or grouping everything lands in one bucket.
+	buckets, err = store.Aggregate(context.Background(), storage.AggregateParams{Filter: storage.QueryParams{TenantID: "client-b"}})
+	if err != nil || len(buckets) != 1 || buckets[0].Count != 1 || !buckets[0].Time.IsZero() {
+		t.Errorf("Expected a single bucket of 1, got %+v, %v", buckets, err)
+	}
+}
+
+func TestFileStore_Tail(t *testing.T) {
+	tailInterval = 10 * time.Millisecond
+	dir := t.TempDir()
+	writeLogs(t, dir, []model.LogEntry{{Message: "old", Level: "INFO"}})
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	tail := func(params storage.QueryParams, n int) ([]string, storage.Cursor) {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		var got []string
+		var last storage.Cursor
+		stop := errors.New("stop")
+		err := store.Tail(ctx, params, func(entry model.LogEntry, c storage.Cursor) error {
+			got, last = append(got, entry.Message), c
+			if len(got) == n {
+				return stop
+			}
+			return nil
+		})
+		if err != stop {
+			t.Fatalf("Tail stopped with %v after %v", err, got)
+		}
+		return got, last
+	}
+
+	// New lines in existing and new files are delivered, old ones are not.
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		f, _ := os.OpenFile(filepath.Join(dir, "logs.log"), os.O_APPEND|os.O_WRONLY, 0644)
+		f.WriteString(`{"message":"skipped","level":"FINE"}` + "\n" + `{"message":"new","level":"INFO"}` + "\n" + `{"message":"partial`)
+		f.Close()
+		os.WriteFile(filepath.Join(dir, "session_b.log"), []byte(`{"message":"other file","level":"SEVERE"}`+"\n"), 0644)
+	}()
+	got, _ := tail(storage.QueryParams{MinLevel: model.LogLevelInfo}, 2)
+	if strings.Join(got, ",") != "new,other file" && strings.Join(got, ",") != "other file,new" {
+		t.Errorf("Expected the two new entries, got %v", got)
+	}
+
+	// Resuming from a cursor replays what came after it.
+	_, cursor := tail(storage.QueryParams{Search: "old", Cursor: &storage.Cursor{File: "logs.log", Offset: -1}}, 1)
+	got, _ = tail(storage.QueryParams{Cursor: &cursor, Search: "new"}, 1)
+	if len(got) != 1 || got[0] != "new" {
+		t.Errorf("Expected to resume with the new entry, got %v", got)
+	}
+}
+
+func TestFileStore_Export(t *testing.T) {
+	dir := t.TempDir()
+	entries := make([]model.LogEntry, 250)
+	for i := range entries {
+		entries[i] = model.LogEntry{Message: "entry", Sequence: uint64(i), ClientID: "client-a"}
+	}
+	entries[7].ClientID = "client-b"
+	writeLogs(t, dir, entries)
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	var got []uint64
+	err = store.Export(context.Background(), storage.QueryParams{TenantID: "client-a", Limit: 10}, func(entry model.LogEntry) error {
+		got = append(got, entry.Sequence)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	// No limit applies, and entries come in write order.
+	if len(got) != 249 || got[0] != 0 || got[7] != 8 || got[248] != 249 {
+		t.Errorf("Unexpected export of %d entries", len(got))
+	}
+}
+
+func TestFileStore_CompressedSegments(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	segments := [][]int{{0, 1, 2}, {3, 4}, {5, 6}}
+	for i, seqs := range segments {
+		var data []byte
+		for _, seq := range seqs {
+			line, _ := json.Marshal(model.LogEntry{Message: "entry", Sequence: uint64(seq), Time: base.Add(time.Duration(seq) * time.Second)})
+			data = append(append(data, line...), '\n')
+		}
+		name := segment.Name("s1", i+1)
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			t.Fatalf("Failed to write segment: %v", err)
+		}
+	}
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	page, err := store.QueryPage(context.Background(), storage.QueryParams{Order: storage.OrderOldest, Limit: 4})
+	if err != nil || page.Next == nil {
+		t.Fatalf("QueryPage failed: %v", err)
+	}
+
+	// Compressing the first two segments keeps the cursor valid.
+	if err := segment.Compress(dir, segment.Name("s1", 1), segment.CompressionGzip); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	if err := segment.Compress(dir, segment.Name("s1", 2), segment.CompressionZstd); err != nil {
+		t.Fatalf("Compress failed: %v", err)
+	}
+	page, err = store.QueryPage(context.Background(), storage.QueryParams{Order: storage.OrderOldest, Limit: 4, Cursor: page.Next})
+	if err != nil {
+		t.Fatalf("QueryPage failed: %v", err)
+	}
+	if len(page.Logs) != 3 || page.Logs[0].Sequence != 4 || page.Logs[2].Sequence != 6 {
+		t.Errorf("Expected entries 4 to 6 on the second page, got %v", page.Logs)
+	}
+
+	// Export reads the segments of a session in order.
+	var got []uint64
+	err = store.Export(context.Background(), storage.QueryParams{}, func(entry model.LogEntry) error {
+		got = append(got, entry.Sequence)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	for i, seq := range got {
+		if seq != uint64(i) {
+			t.Fatalf("Expected entries in write order, got %v", got)
+		}
+	}
+	if len(got) != 7 {
+		t.Errorf("Expected 7 entries, got %v", got)
+	}
+}
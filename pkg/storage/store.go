@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/query"
 )
 
 // QueryParams defines criteria for filtering logs
@@ -13,16 +14,58 @@ type QueryParams struct {
 	EndTime   time.Time
 	Limit     int
 	Level     string
+	// MinLevel keeps entries at least this severe. Aliases such as ERROR are
+	// accepted; see model.ParseLevel.
+	MinLevel  model.LogLevel
 	Search    string
 	SessionID string
 	ClientID  string
 	Source    string
 	Error     string
-	Before    int
-	After     int
+	TraceID   string
+	// Fields are ANDed predicates on Object and Extra.
+	Fields []FieldFilter
+	// Query is a parsed query language expression, ANDed with the rest.
+	Query  *query.Query
+	Before int
+	After  int
+	// Order defaults to newest first.
+	Order Order
+	// Cursor continues a previous page; see Page.Next.
+	Cursor *Cursor
+
+	// TenantID, when set, restricts results (including context lines) to
+	// entries with exactly this ClientID. It is derived from the caller's
+	// credentials, never from user input.
+	TenantID string
+}
+
+// Page is one page of query results. Limit counts matches; context lines
+// come on top.
+type Page struct {
+	Logs []model.LogEntry
+	// Next continues after the last match, nil when the page was not full.
+	Next *Cursor
 }
 
 // LogStore defines the interface for querying logs from a storage backend
 type LogStore interface {
 	Query(ctx context.Context, params QueryParams) ([]model.LogEntry, error)
+	// QueryPage is Query that also returns the cursor for the next page.
+	QueryPage(ctx context.Context, params QueryParams) (Page, error)
+}
+
+// Tailer is implemented by stores that can follow entries as they are
+// written.
+type Tailer interface {
+	// Tail calls fn with each entry matching params that is written from now
+	// on, or after params.Cursor when resuming, together with its cursor. It
+	// runs until ctx is done or fn returns an error.
+	Tail(ctx context.Context, params QueryParams, fn func(entry model.LogEntry, cursor Cursor) error) error
+}
+
+// Exporter is implemented by stores that can stream every match of a filter,
+// without a limit. Paging and context fields are ignored.
+type Exporter interface {
+	Export(ctx context.Context, params QueryParams, fn func(entry model.LogEntry) error) error
 }
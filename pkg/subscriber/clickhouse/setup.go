@@ -73,7 +73,11 @@ func Setup(ctx context.Context, dsn string) error {
 			session_id String,
 			client_id String,
 			source String,
-			client_ip String
+			client_ip String,
+			trace_id String,
+			span_id String,
+			trace_flags UInt8,
+			INDEX idx_trace_id trace_id TYPE bloom_filter GRANULARITY 4
 		) ENGINE = MergeTree()
 		ORDER BY timestamp
 		TTL timestamp + INTERVAL 3 DAY
@@ -85,5 +89,18 @@ func Setup(ctx context.Context, dsn string) error {
 		return fmt.Errorf("failed to create table: %w", err)
 	}
 
+	// Bring tables created by older versions up to date.
+	migrations := []string{
+		"ALTER TABLE %s.logs ADD COLUMN IF NOT EXISTS trace_id String",
+		"ALTER TABLE %s.logs ADD COLUMN IF NOT EXISTS span_id String",
+		"ALTER TABLE %s.logs ADD COLUMN IF NOT EXISTS trace_flags UInt8",
+		"ALTER TABLE %s.logs ADD INDEX IF NOT EXISTS idx_trace_id trace_id TYPE bloom_filter GRANULARITY 4",
+	}
+	for _, migration := range migrations {
+		if err := conn.Exec(ctx, fmt.Sprintf(migration, targetDB)); err != nil {
+			return fmt.Errorf("failed to migrate table: %w", err)
+		}
+	}
+
 	return nil
 }
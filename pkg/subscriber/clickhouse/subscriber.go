@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/ClickHouse/clickhouse-go/v2"
@@ -16,7 +17,11 @@ import (
 type Subscriber struct {
 	Broker broker.Subscriber
 	DSN    string
-	conn   driver.Conn
+	// Options are passed to Subscribe, e.g. a backpressure policy.
+	Options []broker.SubscribeOption
+	conn    driver.Conn
+
+	insertedCount, failedCount atomic.Uint64
 }
 
 func NewSubscriber(b broker.Subscriber, dsn string) *Subscriber {
@@ -54,24 +59,73 @@ func (s *Subscriber) Start(ctx context.Context) error {
 		}
 	}
 
-	ch, err := s.Broker.Subscribe(ctx)
+	opts := append([]broker.SubscribeOption{broker.WithName("clickhouse")}, s.Options...)
+	ch, err := s.Broker.Subscribe(ctx, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to subscribe: %w", err)
 	}
 
+	defer s.conn.Close()
+
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case batch := <-ch:
-			s.insertBatch(ctx, batch)
+		case batch, ok := <-ch:
+			if !ok {
+				log.Println("ClickHouse Subscriber drained, exiting")
+				return nil
+			}
+			if err := s.insertWithRetry(ctx, batch); err != nil {
+				return err
+			}
 		}
 	}
 }
 
-func (s *Subscriber) insertBatch(ctx context.Context, batch []model.LogEntry) {
+const (
+	// retryBackoff is the wait after the first failed insert of a batch,
+	// doubling up to maxRetryBackoff.
+	retryBackoff    = time.Second
+	maxRetryBackoff = 30 * time.Second
+)
+
+// insertWithRetry inserts a batch, retrying until it is stored or ctx is
+// done. The next batch is only received once this one is stored, so the
+// broker never commits past rows that were not inserted.
+func (s *Subscriber) insertWithRetry(ctx context.Context, batch []model.LogEntry) error {
+	backoff := retryBackoff
+	for {
+		err := s.insertBatch(ctx, batch)
+		if err == nil {
+			return nil
+		}
+		log.Printf("Failed to insert %d rows into ClickHouse, retrying in %v: %v", len(batch), backoff, err)
+		select {
+		case <-ctx.Done():
+			s.failedCount.Add(uint64(len(batch)))
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+}
+
+// Stats returns the number of rows inserted and the number lost, either
+// because they could not be encoded or because the subscriber stopped while
+// retrying them.
+func (s *Subscriber) Stats() (inserted, failed uint64) {
+	return s.insertedCount.Load(), s.failedCount.Load()
+}
+
+// insertColumns must stay in the order insertBatch appends values.
+const insertColumns = "timestamp, level, message, object, extra, logger_name, sequence, error, stacktrace, session_id, client_id, source, client_ip, trace_id, span_id, trace_flags"
+
+// insertBatch inserts a batch in one statement. Only failures worth retrying
+// are returned; a batch with rows that cannot be appended is dropped.
+func (s *Subscriber) insertBatch(ctx context.Context, batch []model.LogEntry) error {
 	if len(batch) == 0 {
-		return
+		return nil
 	}
 
 	start := time.Now()
@@ -80,10 +134,9 @@ func (s *Subscriber) insertBatch(ctx context.Context, batch []model.LogEntry) {
 	batchCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
 	defer cancel()
 
-	batchConn, err := s.conn.PrepareBatch(batchCtx, "INSERT INTO logs")
+	batchConn, err := s.conn.PrepareBatch(batchCtx, "INSERT INTO logs ("+insertColumns+")")
 	if err != nil {
-		log.Printf("Failed to prepare batch: %v", err)
-		return
+		return fmt.Errorf("failed to prepare batch: %w", err)
 	}
 
 	for _, entry := range batch {
@@ -104,16 +157,22 @@ func (s *Subscriber) insertBatch(ctx context.Context, batch []model.LogEntry) {
 			entry.ClientID,
 			entry.Source,
 			entry.ClientIP,
+			entry.TraceID,
+			entry.SpanID,
+			entry.TraceFlags,
 		)
 		if err != nil {
 			log.Printf("Failed to append to batch: %v", err)
-			return // abort batch
+			s.failedCount.Add(uint64(len(batch)))
+			batchConn.Abort()
+			return nil // abort batch
 		}
 	}
 
 	if err := batchConn.Send(); err != nil {
-		log.Printf("Failed to send batch to ClickHouse: %v", err)
-	} else {
-		log.Printf("[ClickHouse] Inserted %d rows in %v", len(batch), time.Since(start))
+		return fmt.Errorf("failed to send batch: %w", err)
 	}
+	s.insertedCount.Add(uint64(len(batch)))
+	log.Printf("[ClickHouse] Inserted %d rows in %v", len(batch), time.Since(start))
+	return nil
 }
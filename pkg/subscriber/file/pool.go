@@ -0,0 +1,221 @@
+package file
+
+import (
+	"bufio"
+	"container/list"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FsyncPolicy is when session files are synced to disk.
+type FsyncPolicy string
+
+const (
+	// FsyncNone leaves syncing to the OS.
+	FsyncNone FsyncPolicy = "none"
+	// FsyncBatch flushes and syncs every file written by a batch before the
+	// next batch is taken.
+	FsyncBatch FsyncPolicy = "batch"
+	// FsyncInterval syncs on every periodic flush.
+	FsyncInterval FsyncPolicy = "interval"
+)
+
+// ParseFsyncPolicy accepts the FsyncPolicy names; empty means none.
+func ParseFsyncPolicy(s string) (FsyncPolicy, error) {
+	switch p := FsyncPolicy(s); p {
+	case "":
+		return FsyncNone, nil
+	case FsyncNone, FsyncBatch, FsyncInterval:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown fsync policy %q (expected none, batch or interval)", s)
+}
+
+// WriteOptions tunes how session files are written. Zero values use the
+// defaults.
+type WriteOptions struct {
+	// MaxOpenFiles is how many session files are kept open; the least
+	// recently written one is closed to make room. Default 256.
+	MaxOpenFiles int
+	// BufferSize is the write buffer of each open file. A full buffer is
+	// written out right away. Default 64 KiB.
+	BufferSize int
+	// FlushInterval is how often buffered lines are written out, bounding
+	// how long they stay invisible to readers. Default 1s.
+	FlushInterval time.Duration
+	// IdleTimeout closes files not written to for this long, so files
+	// removed by retention are not kept alive by an open handle. Default 1m.
+	IdleTimeout time.Duration
+	// Fsync is when files are synced. Default none.
+	Fsync FsyncPolicy
+}
+
+func (o WriteOptions) withDefaults() WriteOptions {
+	if o.MaxOpenFiles <= 0 {
+		o.MaxOpenFiles = 256
+	}
+	if o.BufferSize <= 0 {
+		o.BufferSize = 64 * 1024
+	}
+	if o.FlushInterval <= 0 {
+		o.FlushInterval = time.Second
+	}
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = time.Minute
+	}
+	if o.Fsync == "" {
+		o.Fsync = FsyncNone
+	}
+	return o
+}
+
+// handle is an open session file.
+type handle struct {
+	name      string
+	f         *os.File
+	w         *bufio.Writer
+	lastWrite time.Time
+}
+
+// flush writes out the buffer, and syncs the file if sync is set.
+func (h *handle) flush(sync bool) error {
+	if err := h.w.Flush(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", h.name, err)
+	}
+	if sync {
+		if err := h.f.Sync(); err != nil {
+			return fmt.Errorf("failed to sync %s: %w", h.name, err)
+		}
+	}
+	return nil
+}
+
+// handlePool keeps up to max session files open, in least recently used
+// order. It is not safe for concurrent use.
+type handlePool struct {
+	dir     string
+	max     int
+	bufSize int
+	// syncOnClose syncs files before they are closed.
+	syncOnClose bool
+	// report is called with failures to flush or close files.
+	report func(error)
+	lru    *list.List // of *handle, most recently used first
+	byName map[string]*list.Element
+	// free holds the buffers of closed files for reuse.
+	free []*bufio.Writer
+}
+
+func newHandlePool(dir string, opts WriteOptions, report func(error)) *handlePool {
+	return &handlePool{
+		dir:         dir,
+		max:         opts.MaxOpenFiles,
+		bufSize:     opts.BufferSize,
+		syncOnClose: opts.Fsync != FsyncNone,
+		report:      report,
+		lru:         list.New(),
+		byName:      make(map[string]*list.Element),
+	}
+}
+
+// get returns the open handle of a file, opening it for appending if needed
+// and closing the least recently used file to make room.
+func (p *handlePool) get(name string) (*handle, error) {
+	if el, ok := p.byName[name]; ok {
+		p.lru.MoveToFront(el)
+		return el.Value.(*handle), nil
+	}
+
+	filename := filepath.Join(p.dir, name)
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	if p.lru.Len() >= p.max {
+		p.remove(p.lru.Back())
+	}
+	var w *bufio.Writer
+	if n := len(p.free); n > 0 {
+		w, p.free = p.free[n-1], p.free[:n-1]
+		w.Reset(f)
+	} else {
+		w = bufio.NewWriterSize(f, p.bufSize)
+	}
+	h := &handle{name: name, f: f, w: w}
+	p.byName[name] = p.lru.PushFront(h)
+	return h, nil
+}
+
+// close flushes and closes a file if it is open.
+func (p *handlePool) close(name string) {
+	if el, ok := p.byName[name]; ok {
+		p.remove(el)
+	}
+}
+
+// flush flushes a file if it is open, closing it if that fails.
+func (p *handlePool) flush(name string, sync bool) {
+	if el, ok := p.byName[name]; ok {
+		if err := el.Value.(*handle).flush(sync); err != nil {
+			p.report(err)
+			p.discard(name)
+		}
+	}
+}
+
+// discard closes a file without flushing, after a write to it failed.
+func (p *handlePool) discard(name string) {
+	if el, ok := p.byName[name]; ok {
+		h := p.lru.Remove(el).(*handle)
+		delete(p.byName, name)
+		h.f.Close()
+		p.release(h.w)
+	}
+}
+
+// remove flushes and closes the file of el.
+func (p *handlePool) remove(el *list.Element) {
+	h := p.lru.Remove(el).(*handle)
+	delete(p.byName, h.name)
+	if err := h.flush(p.syncOnClose); err != nil {
+		p.report(err)
+	}
+	if err := h.f.Close(); err != nil {
+		p.report(fmt.Errorf("failed to close %s: %w", h.name, err))
+	}
+	p.release(h.w)
+}
+
+func (p *handlePool) release(w *bufio.Writer) {
+	w.Reset(nil)
+	p.free = append(p.free, w)
+}
+
+// flushAll flushes every open file, and closes those last written before
+// idleBefore.
+func (p *handlePool) flushAll(sync bool, idleBefore time.Time) {
+	for el := p.lru.Front(); el != nil; {
+		next := el.Next()
+		h := el.Value.(*handle)
+		if h.lastWrite.Before(idleBefore) {
+			p.remove(el)
+		} else {
+			p.flush(h.name, sync)
+		}
+		el = next
+	}
+}
+
+// closeAll flushes and closes every open file.
+func (p *handlePool) closeAll() {
+	for p.lru.Len() > 0 {
+		p.remove(p.lru.Front())
+	}
+}
+
+// len returns the number of open files.
+func (p *handlePool) len() int {
+	return p.lru.Len()
+}
@@ -1,34 +1,105 @@
 package file
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/predatorx7/logtopus/pkg/broker"
 	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/segment"
 )
 
+// Rotation splits each session into numbered segments. With neither limit set
+// a session is written to a single session_<id>.log.
+type Rotation struct {
+	// MaxBytes starts a new segment once the current one reaches this size.
+	MaxBytes int64
+	// Interval starts a new segment for every window of this length, aligned
+	// to the Unix epoch. Segments of past windows are closed even when their
+	// session is idle.
+	Interval time.Duration
+	// Compression is applied to closed segments.
+	Compression segment.Compression
+}
+
+// Enabled reports whether segments are rotated at all.
+func (r Rotation) Enabled() bool {
+	return r.MaxBytes > 0 || r.Interval > 0
+}
+
+// window returns the number of the time window containing t.
+func (r Rotation) window(t time.Time) int64 {
+	if r.Interval <= 0 {
+		return 0
+	}
+	return t.UnixNano() / int64(r.Interval)
+}
+
+// activeSegment is the segment a session is currently written to. The file is
+// created on the first write.
+type activeSegment struct {
+	seq       int
+	size      int64
+	window    int64
+	lastWrite time.Time
+}
+
+// Stats reports the session file writer.
+type Stats struct {
+	OpenFiles int `json:"open_files"`
+	// WriteErrors counts entries that could not be encoded and files that
+	// could not be opened, written, flushed or synced.
+	WriteErrors uint64 `json:"write_errors"`
+	LastError   string `json:"last_error,omitempty"`
+}
+
+// FileSubscriber appends entries to one file per session. Files, segments and
+// the handle pool are only used by the Start goroutine.
 type FileSubscriber struct {
 	Broker    broker.Subscriber
 	OutputDir string
-	mu        sync.Mutex
+	// Options are passed to Subscribe, e.g. a backpressure policy.
+	Options  []broker.SubscribeOption
+	Rotation Rotation
+	Writes   WriteOptions
+
+	pool *handlePool
+	// line and enc encode one entry at a time.
+	line        bytes.Buffer
+	enc         *json.Encoder
+	segments    map[string]*activeSegment
+	compressing sync.WaitGroup
+	// pending holds the segments being compressed.
+	pendingMu sync.Mutex
+	pending   map[string]bool
+
+	statsMu sync.Mutex
+	stats   Stats
 }
 
 func NewSubscriber(b broker.Subscriber, outDir string) *FileSubscriber {
-	return &FileSubscriber{
+	s := &FileSubscriber{
 		Broker:    b,
 		OutputDir: outDir,
+		segments:  make(map[string]*activeSegment),
+		pending:   make(map[string]bool),
 	}
+	s.enc = json.NewEncoder(&s.line)
+	return s
 }
 
 func (s *FileSubscriber) Start(ctx context.Context) error {
 	log.Println("Starting File Subscriber...")
-	ch, err := s.Broker.Subscribe(ctx)
+	opts := append([]broker.SubscribeOption{broker.WithName("file")}, s.Options...)
+	ch, err := s.Broker.Subscribe(ctx, opts...)
 	if err != nil {
 		return fmt.Errorf("failed to subscribe: %w", err)
 	}
@@ -36,15 +107,206 @@ func (s *FileSubscriber) Start(ctx context.Context) error {
 	if err := os.MkdirAll(s.OutputDir, 0755); err != nil {
 		return fmt.Errorf("failed to create output dir: %w", err)
 	}
+	defer s.compressing.Wait()
+
+	s.Writes = s.Writes.withDefaults()
+	s.pool = newHandlePool(s.OutputDir, s.Writes, s.reportError)
+	defer func() {
+		s.pool.closeAll()
+		s.updateOpenFiles()
+	}()
+	flush := time.NewTicker(s.Writes.FlushInterval)
+	defer flush.Stop()
+
+	// Idle sessions are rotated out of past windows by a periodic sweep.
+	var sweep <-chan time.Time
+	if s.Rotation.Enabled() {
+		if err := s.recoverSegments(); err != nil {
+			return err
+		}
+		if s.Rotation.Interval > 0 {
+			ticker := time.NewTicker(min(s.Rotation.Interval, time.Minute))
+			defer ticker.Stop()
+			sweep = ticker.C
+		}
+	}
 
 	for {
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case batch := <-ch:
+		case now := <-sweep:
+			s.closeWindows(now)
+		case now := <-flush.C:
+			s.pool.flushAll(s.Writes.Fsync == FsyncInterval, now.Add(-s.Writes.IdleTimeout))
+			s.pruneSegments(now.Add(-s.Writes.IdleTimeout))
+			s.updateOpenFiles()
+		case batch, ok := <-ch:
+			if !ok {
+				log.Println("File Subscriber drained, exiting")
+				return nil
+			}
 			s.processBatch(batch)
+			if len(ch) == 0 {
+				// Nothing queued: write out now rather than at the next tick.
+				s.pool.flushAll(false, time.Time{})
+			}
+			s.updateOpenFiles()
+		}
+	}
+}
+
+// recoverSegments picks up the segments left by a previous run: writing
+// continues in the last uncompressed segment of each session, and any other
+// uncompressed segment is closed and compressed.
+func (s *FileSubscriber) recoverSegments() error {
+	entries, err := os.ReadDir(s.OutputDir)
+	if err != nil {
+		return fmt.Errorf("failed to read output dir: %w", err)
+	}
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".tmp") {
+			os.Remove(filepath.Join(s.OutputDir, entry.Name())) // interrupted compression
+		}
+	}
+
+	infos, err := segment.List(s.OutputDir)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for i, info := range infos {
+		sessionID, ok := strings.CutPrefix(info.Session, "session_")
+		if !ok {
+			continue
+		}
+		last := i == len(infos)-1 || infos[i+1].Session != info.Session
+		if last && info.Seq > 0 && info.Compression == segment.CompressionNone {
+			seg := &activeSegment{seq: info.Seq, window: s.Rotation.window(now)}
+			if fi, err := os.Stat(filepath.Join(s.OutputDir, info.File)); err == nil {
+				seg.size = fi.Size()
+				seg.window = s.Rotation.window(fi.ModTime())
+			}
+			s.segments[sessionID] = seg
+			continue
+		}
+		if info.Compression == segment.CompressionNone {
+			s.compress(info.File)
+		}
+		if last {
+			s.segments[sessionID] = &activeSegment{seq: info.Seq + 1, window: s.Rotation.window(now)}
+		}
+	}
+	return nil
+}
+
+// closeWindows rotates every session whose segment belongs to a past window.
+func (s *FileSubscriber) closeWindows(now time.Time) {
+	window := s.Rotation.window(now)
+	for sessionID, seg := range s.segments {
+		if seg.window != window {
+			s.rotate(sessionID, seg, window)
+		}
+	}
+}
+
+// rotate closes the current segment of a session and moves on to the next.
+func (s *FileSubscriber) rotate(sessionID string, seg *activeSegment, window int64) {
+	if seg.size > 0 {
+		name := segment.Name(sessionID, seg.seq)
+		s.pool.close(name)
+		s.compress(name)
+		seg.seq++
+		seg.size = 0
+	}
+	seg.window = window
+}
+
+// pruneSegments forgets sessions not written to since idleBefore whose state
+// can be read back from disk: their segment is closed and compressed, or
+// without an interval, is only closed once it is full. The next write to such
+// a session resumes from its files.
+func (s *FileSubscriber) pruneSegments(idleBefore time.Time) {
+	for sessionID, seg := range s.segments {
+		if !seg.lastWrite.Before(idleBefore) || (seg.size > 0 && s.Rotation.Interval > 0) {
+			continue
+		}
+		if seg.seq > 1 && s.isCompressing(segment.Name(sessionID, seg.seq-1)) {
+			continue
+		}
+		delete(s.segments, sessionID)
+	}
+}
+
+// resumeSegment returns the segment a session not in segments continues in:
+// its last segment if that is still uncompressed, or else the one after it.
+func (s *FileSubscriber) resumeSegment(sessionID string, now time.Time) *activeSegment {
+	seg := &activeSegment{seq: 1, window: s.Rotation.window(now)}
+	infos, err := segment.Session(s.OutputDir, sessionID)
+	if err != nil {
+		s.reportError(err)
+		return seg
+	}
+	if len(infos) == 0 {
+		return seg
+	}
+	last := infos[len(infos)-1]
+	if last.Seq > 0 && last.Compression == segment.CompressionNone {
+		seg.seq = last.Seq
+		if fi, err := os.Stat(filepath.Join(s.OutputDir, last.File)); err == nil {
+			seg.size = fi.Size()
+			seg.window = s.Rotation.window(fi.ModTime())
 		}
+		return seg
 	}
+	seg.seq = last.Seq + 1
+	return seg
+}
+
+// compress compresses a closed segment in the background.
+func (s *FileSubscriber) compress(file string) {
+	if s.Rotation.Compression == segment.CompressionNone {
+		return
+	}
+	s.pendingMu.Lock()
+	s.pending[file] = true
+	s.pendingMu.Unlock()
+	s.compressing.Add(1)
+	go func() {
+		defer s.compressing.Done()
+		defer func() {
+			s.pendingMu.Lock()
+			delete(s.pending, file)
+			s.pendingMu.Unlock()
+		}()
+		if err := segment.Compress(s.OutputDir, file, s.Rotation.Compression); err != nil {
+			log.Printf("Error compressing segment %s: %v", file, err)
+		}
+	}()
+}
+
+func (s *FileSubscriber) isCompressing(file string) bool {
+	s.pendingMu.Lock()
+	defer s.pendingMu.Unlock()
+	return s.pending[file]
+}
+
+// filename returns the file the next entry of a session goes to, rotating
+// first when the current segment is full or its window has passed.
+func (s *FileSubscriber) filename(sessionID string, now time.Time) string {
+	if !s.Rotation.Enabled() {
+		return "session_" + sessionID + ".log"
+	}
+	seg, ok := s.segments[sessionID]
+	if !ok {
+		seg = s.resumeSegment(sessionID, now)
+		s.segments[sessionID] = seg
+	}
+	window := s.Rotation.window(now)
+	if seg.window != window || (s.Rotation.MaxBytes > 0 && seg.size >= s.Rotation.MaxBytes) {
+		s.rotate(sessionID, seg, window)
+	}
+	return segment.Name(sessionID, seg.seq)
 }
 
 func (s *FileSubscriber) processBatch(batch []model.LogEntry) {
@@ -57,21 +319,64 @@ func (s *FileSubscriber) processBatch(batch []model.LogEntry) {
 		grouped[sid] = append(grouped[sid], entry)
 	}
 
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
+	now := time.Now()
+	var written []string
 	for sessionID, entries := range grouped {
-		filename := filepath.Join(s.OutputDir, fmt.Sprintf("session_%s.log", sessionID))
-		f, err := os.OpenFile(filename, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			log.Printf("Error opening file %s: %v", filename, err)
-			continue
+		var h *handle
+		for _, entry := range entries {
+			s.line.Reset()
+			if err := s.enc.Encode(entry); err != nil {
+				s.reportError(fmt.Errorf("failed to encode entry of session %s: %w", sessionID, err))
+				continue
+			}
+
+			name := s.filename(sessionID, now)
+			if h == nil || h.name != name {
+				var err error
+				if h, err = s.pool.get(name); err != nil {
+					s.reportError(err)
+					break
+				}
+				written = append(written, name)
+			}
+			if _, err := h.w.Write(s.line.Bytes()); err != nil {
+				s.reportError(fmt.Errorf("failed to write %s: %w", name, err))
+				s.pool.discard(name)
+				break
+			}
+			h.lastWrite = now
+			if seg, ok := s.segments[sessionID]; ok {
+				seg.size += int64(s.line.Len())
+				seg.lastWrite = now
+			}
 		}
+	}
 
-		for _, entry := range entries {
-			data, _ := json.Marshal(entry)
-			f.WriteString(string(data) + "\n")
+	if s.Writes.Fsync == FsyncBatch {
+		for _, name := range written {
+			s.pool.flush(name, true)
 		}
-		f.Close()
 	}
 }
+
+// reportError logs a write failure and counts it in Stats.
+func (s *FileSubscriber) reportError(err error) {
+	log.Printf("File Subscriber: %v", err)
+	s.statsMu.Lock()
+	s.stats.WriteErrors++
+	s.stats.LastError = err.Error()
+	s.statsMu.Unlock()
+}
+
+func (s *FileSubscriber) updateOpenFiles() {
+	s.statsMu.Lock()
+	s.stats.OpenFiles = s.pool.len()
+	s.statsMu.Unlock()
+}
+
+// Stats returns a snapshot of the writer counters.
+func (s *FileSubscriber) Stats() Stats {
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+	return s.stats
+}
@@ -0,0 +1,181 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/segment"
+)
+
+func newTestSubscriber(dir string, writes WriteOptions) *FileSubscriber {
+	s := NewSubscriber(nil, dir)
+	s.Writes = writes.withDefaults()
+	s.pool = newHandlePool(dir, s.Writes, s.reportError)
+	return s
+}
+
+func TestHandlePool_Eviction(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestSubscriber(dir, WriteOptions{MaxOpenFiles: 2})
+
+	for _, sid := range []string{"a", "b", "c", "a"} {
+		s.processBatch([]model.LogEntry{{SessionID: sid, Message: "m"}})
+	}
+	if n := s.pool.len(); n != 2 {
+		t.Errorf("Expected 2 open files, got %d", n)
+	}
+	// b was least recently used and evicted, so it is already written out.
+	if data, _ := os.ReadFile(filepath.Join(dir, "session_b.log")); !strings.Contains(string(data), `"session_id":"b"`) {
+		t.Errorf("Expected evicted file to be flushed, got %q", data)
+	}
+
+	s.pool.closeAll()
+	data, _ := os.ReadFile(filepath.Join(dir, "session_a.log"))
+	if lines := strings.Count(string(data), "\n"); lines != 2 {
+		t.Errorf("Expected 2 lines in session_a.log, got %d", lines)
+	}
+}
+
+func TestFileSubscriber_WriteErrors(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestSubscriber(dir, WriteOptions{})
+
+	// A session file that cannot be opened, and an entry that cannot be encoded.
+	if err := os.Mkdir(filepath.Join(dir, "session_blocked.log"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	s.processBatch([]model.LogEntry{
+		{SessionID: "blocked", Message: "lost"},
+		{SessionID: "ok", Message: "bad", Object: map[string]interface{}{"f": func() {}}},
+		{SessionID: "ok", Message: "good"},
+	})
+	s.pool.closeAll()
+
+	stats := s.Stats()
+	if stats.WriteErrors != 2 || stats.LastError == "" {
+		t.Errorf("Expected 2 write errors, got %+v", stats)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, "session_ok.log"))
+	if strings.Count(string(data), "\n") != 1 || !strings.Contains(string(data), "good") {
+		t.Errorf("Expected only the good entry, got %q", data)
+	}
+}
+
+func TestFileSubscriber_PruneSegments(t *testing.T) {
+	dir := t.TempDir()
+	s := newTestSubscriber(dir, WriteOptions{})
+	s.Rotation = Rotation{MaxBytes: 1, Compression: segment.CompressionGzip}
+
+	for range 3 {
+		s.processBatch([]model.LogEntry{{SessionID: "a", Message: "m"}})
+	}
+	s.compressing.Wait()
+	s.pool.closeAll()
+	s.pruneSegments(time.Now().Add(time.Hour))
+	if len(s.segments) != 0 {
+		t.Fatalf("Expected idle sessions to be pruned, got %d", len(s.segments))
+	}
+
+	// The session resumes after its last segment instead of at segment 1.
+	s.processBatch([]model.LogEntry{{SessionID: "a", Message: "m"}})
+	s.compressing.Wait()
+	s.pool.closeAll()
+	infos, err := segment.List(dir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var got []string
+	for _, info := range infos {
+		got = append(got, info.File)
+	}
+	want := []string{"session_a.000001.log.gz", "session_a.000002.log.gz", "session_a.000003.log.gz", "session_a.000004.log"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestParseFsyncPolicy(t *testing.T) {
+	for _, s := range []string{"", "none", "batch", "interval"} {
+		if _, err := ParseFsyncPolicy(s); err != nil {
+			t.Errorf("ParseFsyncPolicy(%q) failed: %v", s, err)
+		}
+	}
+	if _, err := ParseFsyncPolicy("always"); err == nil {
+		t.Errorf("Expected error for always")
+	}
+}
+
+// writeBatchUnpooled is the previous writer: every session file is opened,
+// written line by line and closed again for each batch.
+func writeBatchUnpooled(dir string, batch []model.LogEntry) {
+	grouped := make(map[string][]model.LogEntry)
+	for _, entry := range batch {
+		grouped[entry.SessionID] = append(grouped[entry.SessionID], entry)
+	}
+	for sessionID, entries := range grouped {
+		f, err := os.OpenFile(filepath.Join(dir, fmt.Sprintf("session_%s.log", sessionID)), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			data, _ := json.Marshal(entry)
+			f.WriteString(string(data) + "\n")
+		}
+		f.Close()
+	}
+}
+
+// benchBatch spreads n entries round robin over sessions.
+func benchBatch(n, sessions int) []model.LogEntry {
+	batch := make([]model.LogEntry, n)
+	for i := range batch {
+		batch[i] = model.LogEntry{
+			Time:      time.Now(),
+			Level:     model.LogLevelInfo,
+			Message:   "request handled",
+			SessionID: fmt.Sprintf("s%d", i%sessions),
+			ClientID:  "bench",
+		}
+	}
+	return batch
+}
+
+// BenchmarkWriteBatch compares the pooled writer with the previous one. Small
+// batches are the common case under many concurrent sessions; with 2000
+// sessions the pool of 256 files is exhausted on every entry.
+func BenchmarkWriteBatch(b *testing.B) {
+	for _, bc := range []struct{ entries, sessions int }{
+		{1000, 1}, {1000, 100}, {10, 10}, {100, 100}, {2000, 2000},
+	} {
+		batch := benchBatch(bc.entries, bc.sessions)
+		name := fmt.Sprintf("entries=%d/sessions=%d", bc.entries, bc.sessions)
+		report := func(b *testing.B) {
+			b.ReportMetric(float64(b.N*len(batch))/b.Elapsed().Seconds(), "entries/s")
+		}
+
+		b.Run("unpooled/"+name, func(b *testing.B) {
+			dir := b.TempDir()
+			for b.Loop() {
+				writeBatchUnpooled(dir, batch)
+			}
+			report(b)
+		})
+
+		b.Run("pooled/"+name, func(b *testing.B) {
+			s := newTestSubscriber(b.TempDir(), WriteOptions{})
+			for b.Loop() {
+				s.processBatch(batch)
+				// Flush like an idle Start loop would after every batch.
+				s.pool.flushAll(false, time.Time{})
+			}
+			s.pool.closeAll()
+			report(b)
+		})
+	}
+}
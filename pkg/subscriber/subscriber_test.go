@@ -4,10 +4,13 @@ import (
 	"context"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/predatorx7/logtopus/pkg/broker"
 	"github.com/predatorx7/logtopus/pkg/model"
+	"github.com/predatorx7/logtopus/pkg/segment"
 	"github.com/predatorx7/logtopus/pkg/subscriber/clickhouse"
 	"github.com/predatorx7/logtopus/pkg/subscriber/file"
 )
@@ -17,11 +20,13 @@ type MockSubscriberBroker struct {
 	SubCh chan []model.LogEntry
 }
 
-func (m *MockSubscriberBroker) Subscribe(ctx context.Context) (<-chan []model.LogEntry, error) {
+func (m *MockSubscriberBroker) Subscribe(ctx context.Context, opts ...broker.SubscribeOption) (<-chan []model.LogEntry, error) {
 	return m.SubCh, nil
 }
 func (m *MockSubscriberBroker) Publish(ctx context.Context, logs []model.LogEntry) error { return nil }
 func (m *MockSubscriberBroker) Stats() (uint64, uint64)                                  { return 0, 0 }
+func (m *MockSubscriberBroker) SubscriberStats() []broker.SubscriberStats                { return nil }
+func (m *MockSubscriberBroker) Close() error                                             { return nil }
 
 func TestFileSubscriber(t *testing.T) {
 	tmpDir := t.TempDir()
@@ -72,6 +77,57 @@ func TestFileSubscriber(t *testing.T) {
 	// Since we cancelled, we can test Start again or just trust the logic.
 }
 
+func TestFileSubscriber_Rotation(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	ch := make(chan []model.LogEntry, 1)
+	sub := file.NewSubscriber(&MockSubscriberBroker{SubCh: ch}, tmpDir)
+	sub.Rotation = file.Rotation{MaxBytes: 1, Compression: segment.CompressionGzip}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- sub.Start(ctx) }()
+
+	ch <- []model.LogEntry{
+		{SessionID: "sess_1", Message: "one", Time: time.Now()},
+		{SessionID: "sess_1", Message: "two", Time: time.Now()},
+		{SessionID: "sess_1", Message: "three", Time: time.Now()},
+	}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done // waits for compression
+
+	// Every entry fills a segment; closed ones are compressed.
+	infos, err := segment.List(tmpDir)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var got []string
+	for _, info := range infos {
+		got = append(got, info.File)
+	}
+	want := []string{"session_sess_1.000001.log.gz", "session_sess_1.000002.log.gz", "session_sess_1.000003.log"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Expected segments %v, got %v", want, got)
+	}
+
+	// A restart continues in the last segment.
+	ch = make(chan []model.LogEntry, 1)
+	sub = file.NewSubscriber(&MockSubscriberBroker{SubCh: ch}, tmpDir)
+	sub.Rotation = file.Rotation{MaxBytes: 1 << 20}
+	ctx, cancel = context.WithCancel(context.Background())
+	go func() { done <- sub.Start(ctx) }()
+	ch <- []model.LogEntry{{SessionID: "sess_1", Message: "four", Time: time.Now()}}
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	<-done
+
+	content, _ := os.ReadFile(filepath.Join(tmpDir, "session_sess_1.000003.log"))
+	if !strings.Contains(string(content), "three") || !strings.Contains(string(content), "four") {
+		t.Errorf("Expected the restart to append to the last segment, got %q", content)
+	}
+}
+
 func TestClickHouseSubscriber(t *testing.T) {
 	ch := make(chan []model.LogEntry, 1)
 	mockBroker := &MockSubscriberBroker{SubCh: ch}
@@ -3,11 +3,14 @@ const BUFFER = 10;
 
 const state = {
     logs: [],
+    nextCursor: null,
+    live: null,
     isLoading: false,
     params: {
         limit: 1000,
         search: '',
         level: '',
+        min_level: '',
         session_id: '',
         subscriber_type: 'file' // Default,
     },
@@ -33,9 +36,11 @@ document.addEventListener('DOMContentLoaded', () => {
     elems.dialogBody = document.getElementById('dialog-body');
 
     // Bind Controls
-    document.getElementById('btn-refresh').addEventListener('click', fetchLogs);
+    document.getElementById('btn-refresh').addEventListener('click', () => fetchLogs());
+    document.getElementById('btn-more').addEventListener('click', () => fetchLogs(true));
+    document.getElementById('btn-live').addEventListener('click', toggleLive);
 
-    ['search', 'level', 'session_id', 'client_id', 'limit', 'subscriber_type', 'context', 'before_context', 'after_context'].forEach(id => {
+    ['search', 'q', 'level', 'min_level', 'session_id', 'client_id', 'limit', 'order', 'subscriber_type', 'context', 'before_context', 'after_context'].forEach(id => {
         const el = document.getElementById(id);
         if (!el) return;
         el.addEventListener('change', (e) => {
@@ -50,6 +55,19 @@ document.addEventListener('DOMContentLoaded', () => {
         }
     });
 
+    // API Key is kept out of the query string and remembered locally
+    const apiKeyInput = document.getElementById('api_key');
+    apiKeyInput.value = localStorage.getItem('logtopus_api_key') || '';
+    apiKeyInput.addEventListener('change', (e) => {
+        localStorage.setItem('logtopus_api_key', e.target.value);
+    });
+    apiKeyInput.addEventListener('keydown', (e) => {
+        if (e.key === 'Enter') {
+            localStorage.setItem('logtopus_api_key', e.target.value);
+            fetchLogs();
+        }
+    });
+
     // Close Dialog
     document.getElementById('btn-close').addEventListener('click', () => {
         elems.dialog.classList.remove('open');
@@ -64,26 +82,30 @@ document.addEventListener('DOMContentLoaded', () => {
     fetchLogs();
 });
 
-async function fetchLogs() {
+// fetchLogs runs the search, or with append fetches the page after the
+// loaded logs using the cursor of the previous response.
+async function fetchLogs(append = false) {
+    if (append && !state.nextCursor) return;
     state.isLoading = true;
     renderStatus("Loading...");
 
-    // Filter empty params
-    const activeParams = {};
-    Object.keys(state.params).forEach(key => {
-        if (state.params[key]) activeParams[key] = state.params[key];
-    });
+    const activeParams = activeSearchParams();
+    if (append) activeParams.cursor = state.nextCursor;
 
     const qs = new URLSearchParams(activeParams).toString();
     try {
         console.info('Fetching logs', state.params);
-        const res = await fetch(`/v1/logs?${qs}`);
+        const res = await fetch(`/v1/logs?${qs}`, {
+            headers: { 'X-API-Key': localStorage.getItem('logtopus_api_key') || '' }
+        });
         if (!res.ok) throw new Error(await res.text());
         const data = await res.json();
 
         console.info('Received resonse', Array.isArray(data) ? data.length : 'No results');
 
-        state.logs = data || [];
+        state.logs = append ? state.logs.concat(data || []) : (data || []);
+        state.nextCursor = res.headers.get('X-Next-Cursor');
+        document.getElementById('btn-more').disabled = !state.nextCursor;
 
         console.info('Rendering virtual list');
 
@@ -110,6 +132,75 @@ async function fetchLogs() {
     }
 }
 
+// activeSearchParams returns the non-empty search parameters.
+function activeSearchParams() {
+    const activeParams = {};
+    Object.keys(state.params).forEach(key => {
+        if (state.params[key]) activeParams[key] = state.params[key];
+    });
+    return activeParams;
+}
+
+// toggleLive starts or stops following new entries of the current search
+// through the /v1/tail event stream. fetch is used rather than EventSource so
+// the API key can be sent as a header.
+async function toggleLive() {
+    const btn = document.getElementById('btn-live');
+    if (state.live) {
+        state.live.abort();
+        return;
+    }
+
+    const params = activeSearchParams();
+    delete params.limit;
+    delete params.order;
+    const qs = new URLSearchParams(params).toString();
+
+    state.live = new AbortController();
+    btn.classList.add('primary');
+    try {
+        const res = await fetch(`/v1/tail?${qs}`, {
+            headers: { 'X-API-Key': localStorage.getItem('logtopus_api_key') || '' },
+            signal: state.live.signal
+        });
+        if (!res.ok) throw new Error(await res.text());
+
+        const reader = res.body.pipeThrough(new TextDecoderStream()).getReader();
+        let buffer = '';
+        for (;;) {
+            const { value, done } = await reader.read();
+            if (done) break;
+            buffer += value;
+            let end;
+            while ((end = buffer.indexOf('\n\n')) >= 0) {
+                const lines = buffer.slice(0, end).split('\n');
+                buffer = buffer.slice(end + 2);
+                if (!lines.includes('event: log')) continue;
+                const data = lines.filter(l => l.startsWith('data: ')).map(l => l.slice(6)).join('\n');
+                addLiveLog(JSON.parse(data));
+            }
+        }
+    } catch (err) {
+        if (err.name !== 'AbortError') {
+            console.error(err);
+            renderStatus("Live tail stopped: " + err.message);
+        }
+    } finally {
+        state.live = null;
+        btn.classList.remove('primary');
+    }
+}
+
+function addLiveLog(log) {
+    if (state.params.order === 'asc') {
+        state.logs.push(log);
+    } else {
+        state.logs.unshift(log);
+    }
+    elems.spacer.style.height = `${state.logs.length * ITEM_HEIGHT}px`;
+    renderVirtualList();
+}
+
 function renderStatus(msg) {
     elems.list.innerHTML = `<div style="padding:20px; text-align:center">${msg}</div>`;
 }
@@ -201,6 +292,10 @@ window.showDetails = function (index) {
             <span class="meta-label">Source</span>
             <span class="meta-value">${log.source || '-'}</span>
         </div>
+        <div class="meta-item">
+            <span class="meta-label">Trace ID</span>
+            <input class="meta-value" readonly value="${log.trace_id || '-'}" onclick="this.select()" />
+        </div>
     </div>
     `;
 
@@ -11,37 +11,52 @@ sleep 5
 # 2. Generate API Key
 if [ -f .env ]; then export $(grep -v '^#' .env | xargs); fi
 AUTH_SECRET=${AUTH_SECRET:-dev-secret}
-API_KEY=$(make apikey CLIENT=adv-test SECRET="$AUTH_SECRET" | tail -n 1)
+# Entries are stamped with the key's client ID, whatever client_id they claim.
+CLIENT_ID=adv-test
+API_KEY=$(make apikey CLIENT=$CLIENT_ID SECRET="$AUTH_SECRET" | tail -n 1)
 echo "API Key: $API_KEY"
 
+# query GETs a query service URL with the API key, printing the body and
+# failing unless the status is 200.
+query() {
+    local response status
+    response=$(curl -s -w "\n%{http_code}" -H "X-API-Key: $API_KEY" "$1")
+    status=${response##*$'\n'}
+    if [ "$status" -ne 200 ]; then
+        echo "FAIL: GET $1 returned $status: ${response%$'\n'*}" >&2
+        exit 1
+    fi
+    echo "${response%$'\n'*}"
+}
+
 # 3. Ingest Logs with distinctive fields
 INGEST_URL="http://localhost:8080/v1/logs"
 
 echo "Ingesting logs..."
 # Log 1: Context Before
-curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"Ctx 1", "level":"INFO", "session_id":"sess-123", "client_id":"client-A", "sequence":1}]'
+curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"Ctx 1", "level":"INFO", "session_id":"sess-123", "client_id":"'$CLIENT_ID'", "sequence":1}]'
 sleep 0.1
 # Log 2: Context Before
-curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"Ctx 2", "level":"INFO", "session_id":"sess-123", "client_id":"client-A", "sequence":2}]'
+curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"Ctx 2", "level":"INFO", "session_id":"sess-123", "client_id":"'$CLIENT_ID'", "sequence":2}]'
 sleep 0.1
 # Log 3: Target Match (with SessionID)
-curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"TARGET MATCH", "level":"ERROR", "session_id":"sess-123", "client_id":"client-A", "error":"NullPointer", "sequence":3}]'
+curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"TARGET MATCH", "level":"ERROR", "session_id":"sess-123", "client_id":"'$CLIENT_ID'", "error":"NullPointer", "sequence":3}]'
 sleep 0.1
 # Log 4: Context After
-curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"Ctx 4", "level":"INFO", "session_id":"sess-123", "client_id":"client-A", "sequence":4}]'
+curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"Ctx 4", "level":"INFO", "session_id":"sess-123", "client_id":"'$CLIENT_ID'", "sequence":4}]'
 sleep 0.1
 # Log 5: Context After
-curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"Ctx 5", "level":"INFO", "session_id":"sess-123", "client_id":"client-A", "sequence":5}]'
+curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"Ctx 5", "level":"INFO", "session_id":"sess-123", "client_id":"'$CLIENT_ID'", "sequence":5}]'
 
 # Log 6: Control Log (Different Session)
-curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"Control Log", "level":"INFO", "session_id":"sess-other", "client_id":"client-A", "sequence":6}]'
+curl -s -X POST $INGEST_URL -H "X-API-Key: $API_KEY" -d '[{"message":"Control Log", "level":"INFO", "session_id":"sess-other", "client_id":"'$CLIENT_ID'", "sequence":6}]'
 
 sleep 2 # Ensure flush
 
 # 4. Verify Filters
 echo "--- Verifying Session ID Filter ---"
 # Should match sess-123 logs (Target + Ctx), but NOT sess-other
-SESS_RES=$(curl -s "http://localhost:8081/v1/logs?subscriber_type=file&session_id=sess-123")
+SESS_RES=$(query "http://localhost:8081/v1/logs?subscriber_type=file&session_id=sess-123")
 if echo "$SESS_RES" | grep -q "sess-123" && ! echo "$SESS_RES" | grep -q "Control Log"; then
     echo "PASS: Session ID Filter"
 else
@@ -51,7 +66,7 @@ fi
 
 echo "--- Verifying Context Validation ---"
 # Request context without session_id AND without client_id -> Should Fail (400)
-FAIL_RES=$(curl -s -w "%{http_code}" -o /dev/null "http://localhost:8081/v1/logs?subscriber_type=file&search=TARGET&context=2")
+FAIL_RES=$(curl -s -w "%{http_code}" -o /dev/null -H "X-API-Key: $API_KEY" "http://localhost:8081/v1/logs?subscriber_type=file&search=TARGET&context=2")
 if [ "$FAIL_RES" -eq 400 ]; then
      echo "PASS: Context Validation (Missing IDs Rejected)"
 else
@@ -61,7 +76,7 @@ fi
 
 echo "--- Verifying Context (Session ID Only) ---"
 # Valid request with ONLY session_id (should work now)
-CTX_SESS_RES=$(curl -s "http://localhost:8081/v1/logs?subscriber_type=file&search=TARGET&context=2&session_id=sess-123")
+CTX_SESS_RES=$(query "http://localhost:8081/v1/logs?subscriber_type=file&search=TARGET&context=2&session_id=sess-123")
 COUNT_SESS=$(echo "$CTX_SESS_RES" | grep -o "message" | wc -l)
 if [[ "$COUNT_SESS" -ge 5 ]]; then
      echo "PASS: Context (Session ID Only, Got $COUNT_SESS logs)"
@@ -72,7 +87,7 @@ fi
 
 echo "--- Verifying Context (Client ID Only) ---"
 # Valid request with ONLY client_id (should work now)
-CTX_CLIENT_RES=$(curl -s "http://localhost:8081/v1/logs?subscriber_type=file&search=TARGET&context=2&client_id=client-A")
+CTX_CLIENT_RES=$(query "http://localhost:8081/v1/logs?subscriber_type=file&search=TARGET&context=2&client_id=$CLIENT_ID")
 COUNT_CLIENT=$(echo "$CTX_CLIENT_RES" | grep -o "message" | wc -l)
 if [[ "$COUNT_CLIENT" -ge 5 ]]; then
      echo "PASS: Context (Client ID Only, Got $COUNT_CLIENT logs)"
@@ -83,7 +98,7 @@ fi
 
 echo "--- Verifying Case-Insensitivity ---"
 # 1. Level: Query "info" (lowercase) should match "INFO" logs but NO "ERROR" logs
-LEVEL_RES=$(curl -s "http://localhost:8081/v1/logs?subscriber_type=file&level=info&limit=10")
+LEVEL_RES=$(query "http://localhost:8081/v1/logs?subscriber_type=file&level=info&limit=10")
 if echo "$LEVEL_RES" | grep -q "INFO" && ! echo "$LEVEL_RES" | grep -q "TARGET MATCH"; then
     echo "PASS: Level Case-Insensitivity"
 else
@@ -92,7 +107,7 @@ else
 fi
 
 # 2. Search: Query "target" (lowercase) should match "TARGET"
-SEARCH_RES=$(curl -s "http://localhost:8081/v1/logs?subscriber_type=file&search=target")
+SEARCH_RES=$(query "http://localhost:8081/v1/logs?subscriber_type=file&search=target")
 if echo "$SEARCH_RES" | grep -q "TARGET MATCH"; then
     echo "PASS: Search Case-Insensitivity"
 else
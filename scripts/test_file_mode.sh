@@ -18,9 +18,22 @@ fi
 AUTH_SECRET=${AUTH_SECRET:-dev-secret}
 echo "Using Secret: $AUTH_SECRET"
 
-API_KEY=$(./scripts/create_api_key.sh -client test-file -secret "$AUTH_SECRET" | grep -oE 'test-file\.[a-zA-Z0-9_-]+')
+API_KEY=$(./scripts/create_api_key.sh -client test-file -secret "$AUTH_SECRET" | tail -n 1)
 echo "API Key: $API_KEY"
 
+# query GETs a query service URL with the API key, printing the body and
+# failing unless the status is 200.
+query() {
+    local response status
+    response=$(curl -s -w "\n%{http_code}" -H "X-API-Key: $API_KEY" "$1")
+    status=${response##*$'\n'}
+    if [ "$status" -ne 200 ]; then
+        echo "FAIL: GET $1 returned $status: ${response%$'\n'*}" >&2
+        exit 1
+    fi
+    echo "${response%$'\n'*}"
+}
+
 # 3. Ingest Log
 echo "Ingesting log..."
 RESPONSE=$(curl -s -o /dev/null -w "%{http_code}" -X POST http://localhost:8080/v1/logs \
@@ -36,7 +49,7 @@ echo "Ingestion accepted."
 # 4. Query Log
 echo "Querying log..."
 sleep 2 # buffer flush
-QUERY_RESULT=$(curl -s "http://localhost:8081/v1/logs?subscriber_type=file&search=Automated")
+QUERY_RESULT=$(query "http://localhost:8081/v1/logs?subscriber_type=file&search=Automated")
 echo "Query Result: $QUERY_RESULT"
 
 if echo "$QUERY_RESULT" | grep -q "Automated FILE test"; then